@@ -0,0 +1,165 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/fatih/color"
+	"github.com/google/uuid"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+)
+
+func isGitHubAction() bool {
+	return os.Getenv("GITHUB_ACTIONS") == "true"
+}
+
+// exportGitHubOutput sets a step output. Multiline values use the heredoc syntax, with a
+// random delimiter so the value cannot end the block early.
+func exportGitHubOutput(key, value string) error {
+	outputPath := os.Getenv("GITHUB_OUTPUT")
+	if outputPath == "" {
+		return fmt.Errorf("GITHUB_OUTPUT not set")
+	}
+
+	f, err := os.OpenFile(outputPath, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open GITHUB_OUTPUT file: %w", err)
+	}
+	defer func(f *os.File) {
+		_ = f.Close()
+	}(f)
+
+	if strings.ContainsAny(value, "\r\n") {
+		delimiter := "ghadelimiter_" + uuid.NewString()
+		_, err = fmt.Fprintf(f, "%s<<%s\n%s\n%s\n", key, delimiter, value, delimiter)
+		return err
+	}
+	_, err = fmt.Fprintf(f, "%s=%s\n", key, value)
+	return err
+}
+
+func writeStepSummary(markdown string) error {
+	summaryPath := os.Getenv("GITHUB_STEP_SUMMARY")
+	if summaryPath == "" {
+		return fmt.Errorf("GITHUB_STEP_SUMMARY not set")
+	}
+
+	f, err := os.OpenFile(summaryPath, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open GITHUB_STEP_SUMMARY file: %w", err)
+	}
+	defer func(f *os.File) {
+		_ = f.Close()
+	}(f)
+
+	_, err = f.WriteString(markdown)
+	return err
+}
+
+// escapeWorkflowData escapes the message of a workflow command, which has to fit on one line.
+func escapeWorkflowData(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A").Replace(s)
+}
+
+// warn reports a problem that does not stop the run. Inside Actions it is also
+// annotated, so it shows up on the workflow run.
+func warn(message string) {
+	log.Println(color.New(color.FgYellow).Sprintf("⚠️  %s", message))
+	if isGitHubAction() {
+		_, _ = fmt.Fprintf(out, "::warning title=gh-commit::%s\n", escapeWorkflowData(message))
+	}
+}
+
+// annotateError reports the error that stopped the run as an Actions annotation.
+func annotateError(err error) {
+	if isGitHubAction() {
+		_, _ = fmt.Fprintf(out, "::error title=gh-commit::%s\n", escapeWorkflowData(err.Error()))
+	}
+}
+
+// ExportGitHubActions sets every step output of a run and adds it to the job summary.
+// Dry runs leave out the commit and PR outputs, as nothing was created, and set dry-run
+// instead. An output that cannot be set does not keep the others or the summary from
+// being written. It does nothing outside of Actions.
+func (r *RunResult) ExportGitHubActions() {
+	if !isGitHubAction() {
+		return
+	}
+
+	// Selected files that already match the remote are left out
+	files := r.ChangedFiles()
+	outputs := [][2]string{
+		{"branch", r.Branch},
+		{"changed-files", strconv.Itoa(len(files))},
+		{"files", strings.Join(files, "\n")},
+		{"no-changes", strconv.FormatBool(r.NoChanges)},
+		{"dry-run", strconv.FormatBool(r.DryRun)},
+	}
+	if !r.DryRun {
+		outputs = append([][2]string{
+			{"sha", r.CommitSha},
+			{"commit-url", r.CommitUrl},
+			{"tree-sha", r.TreeSha},
+		}, outputs...)
+		if r.PullRequest != nil {
+			outputs = append(outputs,
+				[2]string{"pr-number", strconv.Itoa(r.PullRequest.Number)},
+				[2]string{"pr-url", r.PullRequest.Url},
+			)
+		}
+	}
+
+	var failed []string
+	for _, output := range outputs {
+		if output[1] == "" {
+			continue
+		}
+		if err := exportGitHubOutput(output[0], output[1]); err != nil {
+			failed = append(failed, fmt.Sprintf("%s (%s)", output[0], err))
+		}
+	}
+	if len(failed) > 0 {
+		warn(fmt.Sprintf("Could not set the outputs %s", strings.Join(failed, ", ")))
+	}
+
+	if err := writeStepSummary(r.StepSummary()); err != nil {
+		warn(fmt.Sprintf("Could not write the job summary: %s", err))
+	}
+}
+
+// StepSummary renders the run as markdown for the job summary.
+func (r *RunResult) StepSummary() string {
+	builder := &strings.Builder{}
+	switch {
+	case r.DryRun:
+		_, _ = fmt.Fprintf(builder, "### gh-commit: dry run against `%s`\n\n", r.Branch)
+	case r.NoChanges:
+		_, _ = fmt.Fprintf(builder, "### gh-commit: no changes to commit to `%s`\n\n", r.Branch)
+	default:
+		_, _ = fmt.Fprintf(builder, "### gh-commit: committed to `%s`\n\n", r.Branch)
+	}
+
+	if r.CommitSha != "" {
+		_, _ = fmt.Fprintf(builder, "- Commit: [`%s`](%s) in %s\n", shortSha(r.CommitSha), r.CommitUrl, r.Repository)
+	}
+	if r.PullRequest != nil {
+		_, _ = fmt.Fprintf(builder, "- Pull request: [#%d](%s) into `%s`\n", r.PullRequest.Number, r.PullRequest.Url, r.BaseBranch)
+	}
+
+	if len(r.Files) > 0 {
+		builder.WriteString("\n| File | Status |\n|------|--------|\n")
+		for _, file := range r.Files {
+			_, _ = fmt.Fprintf(builder, "| `%s` | %s |\n", strings.ReplaceAll(file.Path, "|", "\\|"), file.Status)
+		}
+	}
+	builder.WriteString("\n")
+	return builder.String()
+}
+
+func shortSha(sha string) string {
+	if len(sha) > 7 {
+		return sha[:7]
+	}
+	return sha
+}
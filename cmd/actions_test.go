@@ -0,0 +1,138 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestExportGitHubActions(t *testing.T) {
+	dir := t.TempDir()
+	outputPath := filepath.Join(dir, "output")
+	summaryPath := filepath.Join(dir, "summary")
+	for _, p := range []string{outputPath, summaryPath} {
+		if err := os.WriteFile(p, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("GITHUB_ACTIONS", "true")
+	t.Setenv("GITHUB_OUTPUT", outputPath)
+	t.Setenv("GITHUB_STEP_SUMMARY", summaryPath)
+
+	result := &RunResult{
+		Repository:  "kassett/gh-commit",
+		Branch:      "main-0190",
+		BaseBranch:  "main",
+		CommitSha:   "0123456789abcdef0123456789abcdef01234567",
+		CommitUrl:   "https://github.com/kassett/gh-commit/commit/0123456789abcdef0123456789abcdef01234567",
+		TreeSha:     "fedcba9876543210fedcba9876543210fedcba98",
+		Files:       []FileResult{{Path: "a.txt", Status: "updated"}, {Path: "b|c.txt", Status: "deleted"}},
+		PullRequest: &PullRequestResult{Number: 7, Url: "https://github.com/kassett/gh-commit/pull/7"},
+	}
+	result.ExportGitHubActions()
+
+	output, err := os.ReadFile(outputPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := regexp.MustCompile(`^sha=0123456789abcdef0123456789abcdef01234567
+commit-url=https://github.com/kassett/gh-commit/commit/0123456789abcdef0123456789abcdef01234567
+tree-sha=fedcba9876543210fedcba9876543210fedcba98
+branch=main-0190
+changed-files=2
+files<<(ghadelimiter_[0-9a-f-]+)
+a.txt
+b\|c.txt
+(ghadelimiter_[0-9a-f-]+)
+no-changes=false
+dry-run=false
+pr-number=7
+pr-url=https://github.com/kassett/gh-commit/pull/7
+$`)
+	match := expected.FindStringSubmatch(string(output))
+	if match == nil || match[1] != match[2] {
+		t.Errorf("unexpected outputs:\n%s", output)
+	}
+
+	summary, err := os.ReadFile(summaryPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		"### gh-commit: committed to `main-0190`",
+		"- Commit: [`0123456`](https://github.com/kassett/gh-commit/commit/0123456789abcdef0123456789abcdef01234567) in kassett/gh-commit",
+		"- Pull request: [#7](https://github.com/kassett/gh-commit/pull/7) into `main`",
+		"| `b\\|c.txt` | deleted |",
+	} {
+		if !strings.Contains(string(summary), line) {
+			t.Errorf("expected the summary to contain %q, got:\n%s", line, summary)
+		}
+	}
+}
+
+func TestExportGitHubActionsDryRun(t *testing.T) {
+	dir := t.TempDir()
+	outputPath := filepath.Join(dir, "output")
+	summaryPath := filepath.Join(dir, "summary")
+	for _, p := range []string{outputPath, summaryPath} {
+		if err := os.WriteFile(p, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("GITHUB_ACTIONS", "true")
+	t.Setenv("GITHUB_OUTPUT", outputPath)
+	t.Setenv("GITHUB_STEP_SUMMARY", summaryPath)
+
+	result := &RunResult{
+		Repository: "kassett/gh-commit",
+		Branch:     "main",
+		DryRun:     true,
+		TreeSha:    "fedcba9876543210fedcba9876543210fedcba98",
+		Files:      []FileResult{{Path: "a.txt", Status: "modified"}, {Path: "b.txt", Status: "unchanged"}},
+	}
+	result.ExportGitHubActions()
+
+	output, err := os.ReadFile(outputPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "branch=main\nchanged-files=1\nfiles=a.txt\nno-changes=false\ndry-run=true\n"
+	if string(output) != expected {
+		t.Errorf("expected outputs %q, got %q", expected, output)
+	}
+}
+
+func TestExportGitHubActionsOutputFailure(t *testing.T) {
+	dir := t.TempDir()
+	summaryPath := filepath.Join(dir, "summary")
+	if err := os.WriteFile(summaryPath, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("GITHUB_ACTIONS", "true")
+	t.Setenv("GITHUB_OUTPUT", filepath.Join(dir, "missing", "output"))
+	t.Setenv("GITHUB_STEP_SUMMARY", summaryPath)
+	originalOut := out
+	defer func() { out = originalOut }()
+	out = &bytes.Buffer{}
+
+	result := &RunResult{Repository: "kassett/gh-commit", Branch: "main", NoChanges: true}
+	result.ExportGitHubActions()
+
+	summary, err := os.ReadFile(summaryPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(summary), "### gh-commit: no changes to commit to `main`") {
+		t.Errorf("expected the summary to be written despite the outputs failing, got:\n%s", summary)
+	}
+}
+
+func TestEscapeWorkflowData(t *testing.T) {
+	escaped := escapeWorkflowData("100% failed\nsee logs\r")
+	if escaped != "100%25 failed%0Asee logs%0D" {
+		t.Errorf("unexpected escaping: %q", escaped)
+	}
+}
@@ -0,0 +1,599 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+var applyFlags = []Flag{
+	BranchFlag,
+	MessageFlag,
+	UsePrFlag,
+	HeadRefFlag,
+	PrTitleFlag,
+	PrDescFlag,
+	PrLabelFlag,
+	DryRun,
+	RepoFlag,
+	RemoteFlag,
+	ProfileFlag,
+	PrintConfig,
+	JSONFlag,
+	AllowEmpty,
+	DiffFlag,
+	YesFlag,
+	ProtectFlag,
+	AutoPrFlag,
+	KeepFlag,
+	TimeoutFlag,
+	VerboseFlag,
+}
+
+const applyHelpText = `gh-commit apply: Apply a patch or a plan to a remote branch without a checkout.
+
+The patch is either a unified diff, in which case --message is required, or
+an mbox written by git format-patch, in which case every patch becomes its
+own commit, with the author and message taken from the patch headers.
+
+A plan written by gh commit plan already holds the repository, branch,
+message and PR settings. It is only committed if the base branch is still at
+the commit the plan was made against, and every file matches its blob SHA.
+Its repository must be the one of the current checkout, or be given with
+--repo.
+
+Synopsis:
+  gh commit apply <file.patch|-> -B <branch> [flags]
+  gh commit apply <plan.json|-> [flags]
+
+Flags:
+`
+
+// PatchCommit is a patch resolved against the remote tree, ready to be committed.
+type PatchCommit struct {
+	Message string
+	Author  *CommitAuthor
+	Changes []FileChange
+}
+
+type patchedFile struct {
+	content []byte
+	mode    string
+	deleted bool
+}
+
+// PatchTree applies a series of patches in memory. Files are looked up in the remote
+// tree lazily, one directory at a time, so large repositories are never listed in full.
+type PatchTree struct {
+	rootSha  string
+	listTree func(treeSha string) ([]TreeEntry, error)
+	getBlob  func(blobSha string) ([]byte, error)
+	trees    map[string][]TreeEntry
+	files    map[string]*patchedFile
+}
+
+func NewPatchTree(rootSha string, listTree func(string) ([]TreeEntry, error), getBlob func(string) ([]byte, error)) *PatchTree {
+	return &PatchTree{
+		rootSha:  rootSha,
+		listTree: listTree,
+		getBlob:  getBlob,
+		trees:    make(map[string][]TreeEntry),
+		files:    make(map[string]*patchedFile),
+	}
+}
+
+// read returns the current content of a file, taking earlier patches into account.
+func (pt *PatchTree) read(p string) (*patchedFile, error) {
+	if file, ok := pt.files[p]; ok {
+		if file.deleted {
+			return nil, nil
+		}
+		return file, nil
+	}
+
+	found, err := pt.Entry(p)
+	if err != nil || found == nil || found.Type != "blob" {
+		return nil, err
+	}
+	content, err := pt.getBlob(found.Sha)
+	if err != nil {
+		return nil, err
+	}
+	file := &patchedFile{content: content, mode: found.Mode}
+	pt.files[p] = file
+	return file, nil
+}
+
+// Entry looks a path up in the remote tree, ignoring patches, and returns nil if it does
+// not exist. Blobs are not downloaded.
+func (pt *PatchTree) Entry(p string) (*TreeEntry, error) {
+	treeSha := pt.rootSha
+	parts := strings.Split(p, "/")
+	for i, part := range parts {
+		entries, ok := pt.trees[treeSha]
+		if !ok {
+			var err error
+			entries, err = pt.listTree(treeSha)
+			if err != nil {
+				return nil, err
+			}
+			pt.trees[treeSha] = entries
+		}
+
+		var found *TreeEntry
+		for j := range entries {
+			if entries[j].Path == part {
+				found = &entries[j]
+				break
+			}
+		}
+		if found == nil {
+			return nil, nil
+		}
+
+		if i < len(parts)-1 {
+			if found.Type != "tree" {
+				return nil, nil
+			}
+			treeSha = found.Sha
+			continue
+		}
+		return found, nil
+	}
+	return nil, nil
+}
+
+// Apply applies a patch on top of the previous ones and returns the resulting changes.
+func (pt *PatchTree) Apply(patch Patch) ([]FileChange, error) {
+	var changes []FileChange
+	for _, fd := range patch.Files {
+		var original *patchedFile
+		if !fd.NewFile {
+			var err error
+			original, err = pt.read(fd.OldPath)
+			if err != nil {
+				return nil, err
+			}
+			if original == nil {
+				return nil, fmt.Errorf("%s does not exist on the remote branch", fd.OldPath)
+			}
+		} else if existing, err := pt.read(fd.NewPath); err != nil {
+			return nil, err
+		} else if existing != nil {
+			return nil, fmt.Errorf("%s already exists on the remote branch", fd.NewPath)
+		}
+
+		var content []byte
+		mode := fd.NewMode
+		if original != nil {
+			content = original.content
+			if mode == "" {
+				mode = original.mode
+			}
+		}
+		if mode == "" {
+			mode = "100644"
+		}
+
+		if len(fd.Hunks) > 0 {
+			var err error
+			content, err = ApplyHunks(content, fd.Hunks)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", fd.path(), err)
+			}
+		}
+
+		if fd.Deleted || (!fd.NewFile && fd.OldPath != fd.NewPath) {
+			pt.files[fd.OldPath] = &patchedFile{deleted: true}
+			changes = append(changes, FileChange{Path: fd.OldPath, Deleted: true})
+		}
+		if !fd.Deleted {
+			if content == nil {
+				content = []byte{}
+			}
+			pt.files[fd.NewPath] = &patchedFile{content: content, mode: mode}
+			changes = append(changes, FileChange{Path: fd.NewPath, Mode: mode, Content: content})
+		}
+	}
+	return changes, nil
+}
+
+// netChanges keeps the last change of every path, in the order the paths were first
+// changed, which is what the patches do to the tree as a whole.
+func netChanges(changes []FileChange) []FileChange {
+	index := make(map[string]int)
+	var net []FileChange
+	for _, change := range changes {
+		if i, ok := index[change.Path]; ok {
+			net[i] = change
+			continue
+		}
+		index[change.Path] = len(net)
+		net = append(net, change)
+	}
+	return net
+}
+
+func readPatchInput(source string) ([]byte, error) {
+	if source == "-" {
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read patch from stdin: %w", err)
+		}
+		return data, nil
+	}
+
+	data, err := os.ReadFile(source)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read patch: %w", err)
+	}
+	return data, nil
+}
+
+// CommitPatches applies the patches in memory against the target branch, then creates one
+// commit per patch. Nothing is written until every patch applies cleanly, and a run that
+// fails afterwards is rolled back.
+func (rn *RunSettings) CommitPatches(ctx context.Context, patches []Patch) error {
+	return rn.RollBack(ctx, rn.commitPatches(ctx, patches))
+}
+
+func (rn *RunSettings) commitPatches(ctx context.Context, patches []Patch) error {
+	if err := rn.GuardBranch(ctx); err != nil {
+		return err
+	}
+	baseBranch := rn.baseBranch()
+
+	start := time.Now()
+	baseSha, err := rn.ResolveBase(ctx)
+	if err != nil {
+		return err
+	}
+
+	baseTreeSha, err := GetTreeTip(ctx, baseSha)
+	if err != nil {
+		return err
+	}
+
+	patchTree := NewPatchTree(
+		baseTreeSha,
+		func(treeSha string) ([]TreeEntry, error) { return GetRemoteTree(ctx, treeSha, false) },
+		func(blobSha string) ([]byte, error) { return GetBlob(ctx, blobSha) },
+	)
+
+	commits := make([]PatchCommit, 0, len(patches))
+	for i, patch := range patches {
+		changes, err := patchTree.Apply(patch)
+		if err != nil {
+			return fmt.Errorf("patch %d does not apply: %w", i+1, err)
+		}
+		commits = append(commits, PatchCommit{Message: patch.Message, Author: patch.Author, Changes: changes})
+	}
+	rn.Result.BaseSha = baseSha
+	rn.Result.Track("apply", start)
+
+	for _, commit := range commits {
+		subject, _, _ := strings.Cut(commit.Message, "\n")
+		fmt.Fprintf(out, "%s %s\n", color.New(color.FgCyan, color.Bold).Sprint("📝"), subject)
+
+		w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		for i, change := range commit.Changes {
+			index := color.New(color.FgYellow).Sprintf("%d.", i+1)
+			name := color.New(color.FgWhite).Sprint(change.Path)
+			if change.Deleted {
+				name = color.New(color.FgRed).Sprintf("%s (deleted)", change.Path)
+			}
+			_, _ = fmt.Fprintf(w, "   %s\t%s\n", index, name)
+		}
+		_ = w.Flush()
+	}
+
+	var allChanges []FileChange
+	for _, commit := range commits {
+		allChanges = append(allChanges, commit.Changes...)
+	}
+
+	// Patches that were applied already, or undo each other, leave the tree as it is
+	planned, err := PlanChanges(netChanges(allChanges), patchTree.Entry)
+	if err != nil {
+		return err
+	}
+	rn.Result.SetPlan(planned)
+
+	if err = rn.Preflight(ctx, allChanges); err != nil {
+		return err
+	}
+
+	if !rn.AllowEmpty && !slices.ContainsFunc(planned, func(plan PlannedChange) bool { return plan.Status != "unchanged" }) {
+		fmt.Fprintf(out, "%s Nothing to commit, the tree of %s would not change\n",
+			color.New(color.FgGreen).Sprint("✨"), baseBranch)
+		rn.Result.NoChanges = true
+	}
+
+	if rn.DryRun {
+		fmt.Fprintf(out, "%s %d patch(es) apply cleanly to %s\n",
+			color.New(color.FgGreen).Sprint("✅"), len(commits), baseBranch)
+		if rn.PrSettings != nil && len(rn.PrSettings.Labels) > 0 {
+			missing, err := MissingLabels(ctx, rn.PrSettings.Labels)
+			if err != nil {
+				return err
+			}
+			for _, label := range missing {
+				rn.Result.Problems = append(rn.Result.Problems, fmt.Sprintf("the label %s does not exist", label))
+			}
+		}
+		if len(rn.Result.Problems) > 0 {
+			fmt.Fprintf(out, "\n%s\n", color.New(color.FgRed, color.Bold).Sprint("❌ Blocking problems:"))
+			for _, problem := range rn.Result.Problems {
+				fmt.Fprintf(out, "   - %s\n", problem)
+			}
+		}
+		return nil
+	}
+	if rn.Result.NoChanges {
+		return nil
+	}
+
+	if err = rn.Confirm(); err != nil {
+		return err
+	}
+
+	// From here on, the run writes to the remote, and only stops between steps
+	progress := NewProgress("create the branches")
+	for i := range commits {
+		progress.Add(fmt.Sprintf("create commit %d of %d", i+1, len(commits)))
+	}
+	progress.Add(fmt.Sprintf("move %s to the last commit", rn.CommitSettings.CommitToBranch))
+	progress.Add(rn.prSteps()...)
+
+	if err = progress.Next(ctx); err != nil {
+		return err
+	}
+	commitSha, err := rn.EnsureBranches(ctx)
+	if err != nil {
+		return err
+	}
+	if commitSha != baseSha {
+		return fmt.Errorf("%s moved while the patches were being applied, try again", baseBranch)
+	}
+
+	start = time.Now()
+	treeSha := baseTreeSha
+	for _, commit := range commits {
+		if err = progress.Next(ctx); err != nil {
+			return err
+		}
+		blobs, err := CreateBlobs(ctx, commit.Changes)
+		if err != nil {
+			return err
+		}
+
+		treeSha, err = CreateTree(ctx, treeSha, blobs)
+		if err != nil {
+			return err
+		}
+
+		commitSha, err = CreateCommitFromTree(ctx, commitSha, treeSha, commit.Message, commit.Author)
+		if err != nil {
+			return err
+		}
+	}
+
+	rn.Result.TreeSha = treeSha
+	rn.Result.SetCommit(commitSha)
+	rn.Result.Track("commit", start)
+
+	if err = progress.Next(ctx); err != nil {
+		return err
+	}
+	start = time.Now()
+	err = AssociateCommitWithBranch(ctx, rn.CommitSettings.CommitToBranch, baseSha, commitSha)
+	if err != nil {
+		return err
+	}
+	rn.Result.Track("ref", start)
+
+	return rn.OpenPullRequest(ctx, progress)
+}
+
+// applyPlan commits a plan made by `gh commit plan`, with the settings recorded in it.
+func applyPlan(ctx context.Context, cmd *cobra.Command, plan *CommitPlan) error {
+	for _, flag := range []Flag{BranchFlag, MessageFlag, UsePrFlag, HeadRefFlag, PrTitleFlag, PrDescFlag, PrLabelFlag} {
+		if cmd.Flags().Changed(flag.Long) {
+			return fmt.Errorf("`%s` cannot be used with a plan, which sets the branch, message and PR", flag.Long)
+		}
+	}
+
+	// The contents are checked before anything is requested
+	changes, err := plan.Changes()
+	if err != nil {
+		return err
+	}
+
+	repoName, _ := cmd.Flags().GetString(RepoFlag.Long)
+	remoteName, _ := cmd.Flags().GetString(RemoteFlag.Long)
+	target, err := planTarget(plan, repoName, remoteName)
+	if err != nil {
+		return err
+	}
+
+	repoSettings, err := ValidateGitRemote(ctx, target)
+	if err != nil {
+		return err
+	}
+
+	settings := plan.RunSettings(repoSettings, changes)
+	settings.DryRun, _ = cmd.Flags().GetBool(DryRun.Long)
+	settings.JSON, _ = cmd.Flags().GetBool(JSONFlag.Long)
+	settings.Diff, _ = cmd.Flags().GetBool(DiffFlag.Long)
+	settings.Yes, _ = cmd.Flags().GetBool(YesFlag.Long)
+	settings.AllowProtected, _ = cmd.Flags().GetBool(ProtectFlag.Long)
+	settings.KeepOnFailure, _ = cmd.Flags().GetBool(KeepFlag.Long)
+	if settings.PrSettings == nil {
+		if autoPr, _ := cmd.Flags().GetBool(AutoPrFlag.Long); autoPr {
+			settings.AutoPr = newPrSettings(cmd, plan.Branch, plan.Message)
+			settings.AutoPr.Title, _, _ = strings.Cut(plan.Message, "\n")
+		}
+	}
+	settings.Result = settings.NewRunResult()
+	settings.Result.SetFiles(changes)
+
+	fmt.Fprintf(out, "%s Applying a plan of %d file(s) to %s @ %s\n",
+		color.New(color.FgGreen).Sprint("📋"), len(changes), plan.Branch, shortSha(plan.BaseSha))
+
+	if !settings.DryRun && settings.PrSettings != nil && len(settings.PrSettings.Labels) > 0 {
+		err = ValidateAllLabels(ctx, settings.PrSettings.Labels)
+		if err != nil {
+			return err
+		}
+	}
+
+	if settings.DryRun {
+		err = settings.ExecuteDryRun(ctx)
+	} else {
+		err = settings.Commit(ctx)
+	}
+	if err != nil {
+		return err
+	}
+	return settings.Report()
+}
+
+var applyCmd = &cobra.Command{
+	Use:   "apply <file.patch|plan.json|->",
+	Short: "Apply a unified diff, format-patch mbox or commit plan to a remote branch",
+	Args:  cobra.ExactArgs(1),
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		sources, err := LoadConfig(cmd, applyFlags)
+		if err != nil {
+			return err
+		}
+		if printConfig, _ := cmd.Flags().GetBool(PrintConfig.Long); printConfig {
+			PrintResolvedConfig(cmd, applyFlags, sources)
+			os.Exit(0)
+		}
+		if jsonOutput, _ := cmd.Flags().GetBool(JSONFlag.Long); jsonOutput {
+			UseJSONOutput()
+		}
+
+		repoName, _ := cmd.Flags().GetString(RepoFlag.Long)
+		remoteName, _ := cmd.Flags().GetString(RemoteFlag.Long)
+		if repoName != "" && remoteName != "" {
+			return errors.New("`repo` and `remote` cannot be used together")
+		}
+		return nil
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx, finishRun, err := StartRun(cmd)
+		if err != nil {
+			return err
+		}
+		defer finishRun()
+
+		data, err := readPatchInput(args[0])
+		if err != nil {
+			return err
+		}
+
+		plan, isPlan, err := ParseCommitPlan(data)
+		if err != nil {
+			return err
+		}
+		if isPlan {
+			return applyPlan(ctx, cmd, plan)
+		}
+
+		// Patches do not say where they go, so the branch is only required for them
+		branch, _ := cmd.Flags().GetString(BranchFlag.Long)
+		if branch == "" {
+			return fmt.Errorf("--branch is a required flag, or %s", EnvName(BranchFlag))
+		}
+		if diff, _ := cmd.Flags().GetBool(DiffFlag.Long); diff {
+			return errors.New("`diff` can only be used when applying a plan")
+		}
+
+		patches, err := ParsePatches(data)
+		if err != nil {
+			return err
+		}
+
+		// Plain diffs carry no message, so one has to be given
+		message, _ := cmd.Flags().GetString(MessageFlag.Long)
+		for i := range patches {
+			if patches[i].Message == "" {
+				if message == "" {
+					return errors.New("--message is required when the patch has no commit message")
+				}
+				patches[i].Message = message
+			}
+		}
+
+		repoName, _ := cmd.Flags().GetString(RepoFlag.Long)
+		remoteName, _ := cmd.Flags().GetString(RemoteFlag.Long)
+		target, err := ResolveTargetRepository(repoName, remoteName)
+		if err != nil {
+			return err
+		}
+
+		repoSettings, err := ValidateGitRemote(ctx, target)
+		if err != nil {
+			return err
+		}
+
+		prMessage := message
+		if prMessage == "" {
+			prMessage = patches[0].Message
+		}
+		prSettings, commitSettings := ConfigureBranches(cmd, prMessage)
+		if prSettings != nil {
+			if title, _ := cmd.Flags().GetString(PrTitleFlag.Long); title == "" {
+				prSettings.Title, _, _ = strings.Cut(prMessage, "\n")
+			}
+
+		}
+
+		// A dry run reports missing labels among its problems instead
+		dryRun, _ := cmd.Flags().GetBool(DryRun.Long)
+		if !dryRun && prSettings != nil && len(prSettings.Labels) > 0 {
+			err = ValidateAllLabels(ctx, prSettings.Labels)
+			if err != nil {
+				return err
+			}
+		}
+
+		jsonOutput, _ := cmd.Flags().GetBool(JSONFlag.Long)
+		allowEmpty, _ := cmd.Flags().GetBool(AllowEmpty.Long)
+		yes, _ := cmd.Flags().GetBool(YesFlag.Long)
+		allowProtected, _ := cmd.Flags().GetBool(ProtectFlag.Long)
+		keepOnFailure, _ := cmd.Flags().GetBool(KeepFlag.Long)
+		settings := &RunSettings{
+			PrSettings:     prSettings,
+			CommitSettings: commitSettings,
+			RepoSettings:   repoSettings,
+			DryRun:         dryRun,
+			JSON:           jsonOutput,
+			AllowEmpty:     allowEmpty,
+			Yes:            yes,
+			AllowProtected: allowProtected,
+			KeepOnFailure:  keepOnFailure,
+			AutoPr:         AutoPrSettings(cmd, prMessage),
+		}
+		if settings.AutoPr != nil {
+			if title, _ := cmd.Flags().GetString(PrTitleFlag.Long); title == "" {
+				settings.AutoPr.Title, _, _ = strings.Cut(prMessage, "\n")
+			}
+		}
+		settings.Result = settings.NewRunResult()
+		if err = settings.CommitPatches(ctx, patches); err != nil {
+			return err
+		}
+		return settings.Report()
+	},
+}
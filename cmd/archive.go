@@ -0,0 +1,187 @@
+package cmd
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+)
+
+// ReadArchiveFile reads a .tar, .tar.gz or .zip archive from a file, or from stdin for "-".
+func ReadArchiveFile(source string) ([]FileChange, error) {
+	var data []byte
+	var err error
+	if source == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(source)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read archive: %w", err)
+	}
+
+	return ReadArchive(data)
+}
+
+// ReadArchive turns the entries of an archive into changes. The format is detected from
+// the content rather than the file name, so archives can be piped in.
+func ReadArchive(data []byte) ([]FileChange, error) {
+	switch {
+	case bytes.HasPrefix(data, []byte{0x1f, 0x8b}):
+		gz, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("invalid gzip archive: %w", err)
+		}
+		defer func(gz *gzip.Reader) {
+			_ = gz.Close()
+		}(gz)
+		return readTar(gz)
+	case bytes.HasPrefix(data, []byte("PK\x03\x04")), bytes.HasPrefix(data, []byte("PK\x05\x06")):
+		return readZip(data)
+	default:
+		return readTar(bytes.NewReader(data))
+	}
+}
+
+func readTar(r io.Reader) ([]FileChange, error) {
+	var changes []FileChange
+	contents := make(map[string][]byte)
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid tar archive: %w", err)
+		}
+
+		name, err := archivePath(hdr.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		var change FileChange
+		switch hdr.Typeflag {
+		case tar.TypeReg, tar.TypeRegA:
+			content, err := io.ReadAll(tr)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read %s from archive: %w", hdr.Name, err)
+			}
+			contents[name] = content
+			change = FileChange{Path: name, LocalPath: name, Mode: archiveFileMode(hdr.FileInfo().Mode()), Content: content}
+		case tar.TypeSymlink:
+			change = FileChange{Path: name, LocalPath: name, Mode: "120000", Content: []byte(hdr.Linkname)}
+		case tar.TypeLink:
+			// Hard links point at an earlier entry of the archive
+			target, err := archivePath(hdr.Linkname)
+			if err != nil {
+				return nil, err
+			}
+			content, ok := contents[target]
+			if !ok {
+				return nil, fmt.Errorf("%s links to %s, which is not in the archive", hdr.Name, hdr.Linkname)
+			}
+			change = FileChange{Path: name, LocalPath: name, Mode: archiveFileMode(hdr.FileInfo().Mode()), Content: content}
+		default:
+			// Directories are implied by the files in them, and devices cannot be committed
+			continue
+		}
+		changes = append(changes, change)
+	}
+	return changes, nil
+}
+
+func readZip(data []byte) ([]FileChange, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid zip archive: %w", err)
+	}
+
+	var changes []FileChange
+	for _, f := range zr.File {
+		mode := f.Mode()
+		if mode.IsDir() {
+			continue
+		}
+
+		name, err := archivePath(f.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		rc, err := f.Open()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s from archive: %w", f.Name, err)
+		}
+		content, err := io.ReadAll(rc)
+		_ = rc.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s from archive: %w", f.Name, err)
+		}
+
+		// Zip stores the symlink target as the content of the entry
+		fileMode := archiveFileMode(mode)
+		if mode&os.ModeSymlink != 0 {
+			fileMode = "120000"
+		} else if !mode.IsRegular() {
+			continue
+		}
+		changes = append(changes, FileChange{Path: name, LocalPath: name, Mode: fileMode, Content: content})
+	}
+	return changes, nil
+}
+
+// archivePath normalizes the name of an entry, refusing names that escape the archive root.
+func archivePath(name string) (string, error) {
+	cleaned := path.Clean(strings.TrimPrefix(strings.ReplaceAll(name, "\\", "/"), "./"))
+	if path.IsAbs(cleaned) || cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return "", fmt.Errorf("the archive entry %s points outside of the archive", name)
+	}
+	if cleaned == "." {
+		return "", errors.New("the archive contains an entry without a name")
+	}
+	return cleaned, nil
+}
+
+func archiveFileMode(mode os.FileMode) string {
+	if mode&0o111 != 0 {
+		return "100755"
+	}
+	return "100644"
+}
+
+// GetArchiveSelection selects the entries of an archive, optionally filtered by pathspecs.
+func GetArchiveSelection(source string, patterns []string) ([]FileChange, error) {
+	entries, err := ReadArchiveFile(source)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(patterns) == 0 {
+		return entries, nil
+	}
+
+	pathspecs, err := CompilePathspecs(patterns)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []FileChange
+	for _, entry := range entries {
+		if MatchPathspecs(pathspecs, entry.Path) {
+			changes = append(changes, entry)
+		}
+	}
+	if len(changes) == 0 {
+		return nil, errors.New("the pattern(s) did not match any files")
+	}
+	return changes, nil
+}
@@ -0,0 +1,126 @@
+package cmd
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"os"
+	"testing"
+)
+
+func buildTarGz(t *testing.T, headers []*tar.Header, contents []string) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for i, hdr := range headers {
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(contents[i])); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestReadArchiveTar(t *testing.T) {
+	data := buildTarGz(t,
+		[]*tar.Header{
+			{Name: "./dist/", Typeflag: tar.TypeDir, Mode: 0o755},
+			{Name: "./dist/app", Typeflag: tar.TypeReg, Mode: 0o755, Size: 3},
+			{Name: "./dist/README", Typeflag: tar.TypeReg, Mode: 0o644, Size: 5},
+			{Name: "./dist/latest", Typeflag: tar.TypeSymlink, Linkname: "app"},
+			{Name: "./dist/copy", Typeflag: tar.TypeLink, Linkname: "./dist/README", Mode: 0o644},
+		},
+		[]string{"", "bin", "hello", "", ""},
+	)
+
+	changes, err := ReadArchive(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []FileChange{
+		{Path: "dist/app", Mode: "100755", Content: []byte("bin")},
+		{Path: "dist/README", Mode: "100644", Content: []byte("hello")},
+		{Path: "dist/latest", Mode: "120000", Content: []byte("app")},
+		{Path: "dist/copy", Mode: "100644", Content: []byte("hello")},
+	}
+	if len(changes) != len(expected) {
+		t.Fatalf("expected %d changes, got %+v", len(expected), changes)
+	}
+	for i, change := range changes {
+		e := expected[i]
+		if change.Path != e.Path || change.Mode != e.Mode || string(change.Content) != string(e.Content) {
+			t.Errorf("change %d: expected %+v, got %+v", i, e, change)
+		}
+	}
+}
+
+func TestReadArchiveZip(t *testing.T) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, entry := range []struct {
+		name    string
+		mode    os.FileMode
+		content string
+	}{
+		{name: "bin/", mode: os.ModeDir | 0o755},
+		{name: "bin/run.sh", mode: 0o755, content: "#!/bin/sh\n"},
+		{name: "bin/run", mode: os.ModeSymlink | 0o777, content: "run.sh"},
+		{name: "empty.txt", mode: 0o644, content: ""},
+	} {
+		hdr := &zip.FileHeader{Name: entry.name}
+		hdr.SetMode(entry.mode)
+		w, err := zw.CreateHeader(hdr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = w.Write([]byte(entry.content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	changes, err := ReadArchive(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []FileChange{
+		{Path: "bin/run.sh", Mode: "100755", Content: []byte("#!/bin/sh\n")},
+		{Path: "bin/run", Mode: "120000", Content: []byte("run.sh")},
+		{Path: "empty.txt", Mode: "100644", Content: []byte{}},
+	}
+	if len(changes) != len(expected) {
+		t.Fatalf("expected %d changes, got %+v", len(expected), changes)
+	}
+	for i, change := range changes {
+		e := expected[i]
+		if change.Path != e.Path || change.Mode != e.Mode || string(change.Content) != string(e.Content) || change.Content == nil {
+			t.Errorf("change %d: expected %+v, got %+v", i, e, change)
+		}
+	}
+}
+
+func TestReadArchiveEscapingEntry(t *testing.T) {
+	data := buildTarGz(t,
+		[]*tar.Header{{Name: "../etc/passwd", Typeflag: tar.TypeReg, Mode: 0o644, Size: 1}},
+		[]string{"x"},
+	)
+
+	expectedError := errors.New("the archive entry ../etc/passwd points outside of the archive")
+	if _, err := ReadArchive(data); err == nil || err.Error() != expectedError.Error() {
+		t.Errorf("expected error %v, got %v", expectedError, err)
+	}
+}
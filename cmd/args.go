@@ -1,15 +1,15 @@
 package cmd
 
 import (
+	"context"
 	"errors"
 	"fmt"
-	"github.com/cli/go-gh"
 	"github.com/fatih/color"
 	"github.com/google/uuid"
 	"github.com/olekukonko/tablewriter"
 	"github.com/spf13/cobra"
-	"log"
 	"os"
+	"path/filepath"
 	"strings"
 	"text/tabwriter"
 )
@@ -58,7 +58,33 @@ var (
 	PrLabelFlag = Flag{Short: "l", Long: "label", Description: "A list of labels to add to the PR created. Only relevant if used in conjunction with the --use-pr flag. Labels can be added recursively -- i.e. -l feature -l blocked.", Type: "stringSlice"}
 	AllFlag     = Flag{Short: "A", Long: "all", Description: "Commit all tracked files that have changed. Only relevant if the target branch is the same as the local branch.", Type: "bool", Default: "false"}
 	Untracked   = Flag{Short: "U", Long: "untracked", Description: "Include untracked files in the commit. Only relevant if used in conjunction with the --all flag.", Type: "bool", Default: "false"}
-	DryRun      = Flag{Short: "d", Long: "dry-run", Description: "Show which files would be committed.", Type: "bool", Default: "false"}
+	DryRun      = Flag{Short: "d", Long: "dry-run", Description: "Show which files would be committed, and how they differ from the remote tree, without writing anything. Refs, push permissions, rulesets and labels are checked, and the run fails if any of them would block the commit.", Type: "bool", Default: "false"}
+	ForkFlag    = Flag{Short: "F", Long: "fork", Description: "Push the head ref and commit to a fork of the repository and open the PR against the upstream base. The fork is created if it does not exist yet. Only relevant if used in conjunction with the --use-pr flag.", Type: "bool", Default: "false"}
+	RepoFlag    = Flag{Short: "R", Long: "repo", Description: "The repository to commit to, in the format of [HOST/]OWNER/NAME. Defaults to the repository inferred from the git remotes. GitHub Enterprise Server hosts use the token configured for that host.", Type: "string"}
+	RemoteFlag  = Flag{Long: "remote", Description: "The name of the git remote whose repository to commit to, e.g. upstream. Cannot be used with --repo.", Type: "string"}
+	SourceDir   = Flag{Long: "source-dir", Description: "Select files from a plain directory instead of a git checkout, in the format of <local-dir>[:<remote-dir>]. Files are matched relative to the directory and committed under <remote-dir>, if given. Requires --repo.", Type: "string"}
+	PrefixFlag  = Flag{Long: "prefix", Description: "Commit the selected files under this directory of the remote tree rather than at their local paths.", Type: "string"}
+	MapFlag     = Flag{Long: "map", Description: "Commit the files below a local directory under a different remote directory, in the format of local/dir:remote/dir. Can be repeated, in which case the most specific mapping wins. Files that no mapping covers are placed under --prefix.", Type: "stringSlice"}
+	MirrorFlag  = Flag{Long: "mirror", Description: "Make a remote directory exactly match a local directory, in the format of <local-dir>[:<remote-dir>]. Only new or changed files are uploaded, and remote files that no longer exist locally are deleted. Cannot be used with explicit file selection.", Type: "string"}
+	ArchiveFlag = Flag{Long: "archive", Description: "Commit the entries of a .tar, .tar.gz or .zip archive instead of local files. Use - to read the archive from stdin. Executable bits and symlinks are preserved, explicit file selection filters the entries, and --prefix places them under a remote directory.", Type: "string"}
+	SpecFile    = Flag{Long: "pathspec-from-file", Description: "Read the file selection from a file instead of positional arguments, one pathspec per line. Use - to read from stdin.", Type: "string"}
+	SinceFlag   = Flag{Long: "since", Description: "Commit the files that changed in the work tree relative to this ref, including deletions and renames, instead of matching patterns. Explicit file selection narrows the changed files down.", Type: "string"}
+	RangeFlag   = Flag{Long: "range", Description: "Commit the files that changed within a commit range, in the format of A..B, with their content at B. Explicit file selection narrows the changed files down.", Type: "string"}
+	SpecFileNul = Flag{Long: "pathspec-file-nul", Description: "Pathspecs read with --pathspec-from-file are separated by NUL characters rather than newlines, as written by find -print0 or git diff -z.", Type: "bool", Default: "false"}
+	ExcludeFlag = Flag{Long: "exclude", Description: "Leave out the selected files matching this glob. Can be repeated. Like .gitignore, a pattern without a slash matches a file or directory of that name at any depth, e.g. --exclude '*.lock' or --exclude node_modules. With --mirror, excluded remote files are left untouched.", Type: "stringSlice"}
+	ProfileFlag = Flag{Long: "profile", Description: "Apply the options of a named profile from the config files on top of their defaults, e.g. --profile nightly.", Type: "string"}
+	PrintConfig = Flag{Long: "print-config", Description: "Print the resolved value of every option and where it came from, then exit.", Type: "bool", Default: "false"}
+	JSONFlag    = Flag{Long: "json", Description: "Print a JSON document describing the run to stdout, with the repository, branch, base, tree and commit SHAs, the files, the PR and timings. Human-readable output goes to stderr instead.", Type: "bool", Default: "false"}
+	DiffFlag    = Flag{Long: "diff", Description: "Print a colored unified diff of every file against the remote branch, with added and removed line counts. Shown by --dry-run, or before committing, where a terminal is asked to confirm.", Type: "bool", Default: "false"}
+	AllowEmpty  = Flag{Long: "allow-empty", Description: "Commit even if nothing would change. By default, runs that would not change the tree of the branch create no commit, branch or PR, and exit with code 3.", Type: "bool", Default: "false"}
+	Interactive = Flag{Short: "i", Long: "interactive", Description: "Pick the files to commit from the changed, staged and untracked files of the work tree, with a diff of each on request, and confirm before anything is pushed. Requires a terminal.", Type: "bool", Default: "false"}
+	YesFlag     = Flag{Short: "y", Long: "yes", Description: "Do not ask for confirmation. In a terminal, commits made directly to the default branch of the repository are confirmed first, as are runs with --interactive or --diff.", Type: "bool", Default: "false"}
+	ProtectFlag = Flag{Long: "allow-protected", Description: "Commit directly to the default branch, or to a branch protected by branch protection or rulesets, which is refused otherwise. Only useful if the token may bypass the protection.", Type: "bool", Default: "false"}
+	KeepFlag    = Flag{Long: "keep-on-failure", Description: "Leave the branches, ref updates and PR of a failed run in place. By default, a run failing halfway deletes the branches it created, moves branches it updated back, if they still point where the run left them, and closes the PR it opened.", Type: "bool", Default: "false"}
+	TimeoutFlag = Flag{Long: "timeout", Description: "Give up on the run after this long, e.g. 90s or 10m, cutting off requests that hang. What was already changed on the remote is rolled back, as for any failed run.", Type: "string"}
+	VerboseFlag = Flag{Short: "v", Long: "verbose", Description: "Report the rate-limit budget left at the end of the run, and how many requests were retried.", Type: "bool", Default: "false"}
+	AutoPrFlag  = Flag{Long: "auto-pr", Description: "Open a PR instead of committing directly when the branch is the default branch, or protected in a way a PR gets around. The PR is set up as with --use-pr.", Type: "bool", Default: "false"}
+	ForkOwner   = Flag{Long: "fork-owner", Description: "The organization that owns (or should own) the fork. Defaults to the authenticated user. Only relevant if used in conjunction with the --fork flag.", Type: "string"}
 )
 
 var allFlags = []Flag{
@@ -72,6 +98,32 @@ var allFlags = []Flag{
 	AllFlag,
 	Untracked,
 	DryRun,
+	ForkFlag,
+	ForkOwner,
+	RepoFlag,
+	RemoteFlag,
+	SourceDir,
+	PrefixFlag,
+	MapFlag,
+	MirrorFlag,
+	ArchiveFlag,
+	SpecFile,
+	SpecFileNul,
+	SinceFlag,
+	RangeFlag,
+	ExcludeFlag,
+	ProfileFlag,
+	PrintConfig,
+	JSONFlag,
+	AllowEmpty,
+	DiffFlag,
+	Interactive,
+	YesFlag,
+	ProtectFlag,
+	AutoPrFlag,
+	KeepFlag,
+	TimeoutFlag,
+	VerboseFlag,
 }
 
 type PrSettings struct {
@@ -90,14 +142,32 @@ type CommitSettings struct {
 type RepoSettings struct {
 	DefaultBranch    string
 	DefaultBranchSha string
+	Private          bool
+	Permissions      *RepoPermissions
 }
 
 type RunSettings struct {
 	PrSettings     *PrSettings
 	CommitSettings *CommitSettings
 	RepoSettings   *RepoSettings
-	FileSelection  []string
+	FileSelection  []FileChange
+	Mirror         *MirrorSettings
 	DryRun         bool
+	AllowEmpty     bool
+	Diff           bool
+	Interactive    bool
+	Yes            bool
+	AllowProtected bool
+	KeepOnFailure  bool
+	Fork           bool
+	ForkOwner      string
+	JSON           bool
+	Result         *RunResult
+
+	// ExpectedBaseSha is the base commit a plan was made against, if one is applied
+	ExpectedBaseSha string
+	// AutoPr is the PR to open instead of committing directly to a protected branch, with --auto-pr
+	AutoPr *PrSettings
 }
 
 func GetFileSelection(args []string, commitAll bool, commitUntracked bool) ([]string, error) {
@@ -106,20 +176,19 @@ func GetFileSelection(args []string, commitAll bool, commitUntracked bool) ([]st
 	}
 
 	if len(args) == 0 {
-		fmt.Println(color.New(color.FgYellow).Sprintf("⚠️  No explicit file selection."))
+		fmt.Fprintln(out, color.New(color.FgYellow).Sprintf("⚠️  No explicit file selection."))
 
 		if !commitAll {
 			return nil, fmt.Errorf("%s %s",
 				color.New(color.FgRed, color.Bold).Sprint("❌ Error:"),
-				"No files were selected for commit",
+				"No files were selected for commit; pass files, --all, or --interactive to pick them",
 			)
 		}
 	}
 
 	stagedFiles, err := ListStagedFiles()
 	if err == nil && len(stagedFiles) > 0 {
-		warn := color.New(color.FgYellow, color.Bold).Sprintf("⚠️  %d file(s) are already staged for commit", len(stagedFiles))
-		log.Println(warn)
+		warn(fmt.Sprintf("%d file(s) are already staged for commit", len(stagedFiles)))
 	}
 
 	untrackedFiles, err := ListUntrackedFiles()
@@ -155,88 +224,206 @@ func GetFileSelection(args []string, commitAll bool, commitUntracked bool) ([]st
 	return append(filesToAdd, stagedFiles...), nil
 }
 
-func ValidateAndConfigureRun(args []string, cmd *cobra.Command, rs *RepoSettings) (*RunSettings, error) {
-	fileSelection, err := GetFileSelection(
-		args,
-		func() bool { b, _ := cmd.Flags().GetBool(AllFlag.Long); return b }(),
-		func() bool { b, _ := cmd.Flags().GetBool(Untracked.Long); return b }(),
-	)
-	if err != nil {
-		return nil, err
+// GetChangedFileSelection selects the files that changed since a ref, in the work tree,
+// or within a commit range, in which case the content is taken from the end of the range.
+func GetChangedFileSelection(since, commitRange string, pathspecs []string) ([]FileChange, error) {
+	revisions := []string{since}
+	if commitRange != "" {
+		if !strings.Contains(commitRange, "..") {
+			return nil, fmt.Errorf("invalid range %q, expected the format A..B", commitRange)
+		}
+		revisions = []string{commitRange}
 	}
 
-	fmt.Printf("%s Selected %d file(s) for commit\n",
-		color.New(color.FgGreen).Sprint("✅"),
-		len(fileSelection),
-	)
-
-	if len(fileSelection) == 0 {
-		os.Exit(0)
+	changedFiles, err := ListChangedFiles(revisions, pathspecs)
+	if err != nil {
+		return nil, err
 	}
 
-	var prSettings *PrSettings
-	var commitSettings *CommitSettings
-	dryRun, _ := cmd.Flags().GetBool(DryRun.Long)
-	usePr, _ := cmd.Flags().GetBool(UsePrFlag.Long)
-	branch, _ := cmd.Flags().GetString(BranchFlag.Long)
-	commitMessage, _ := cmd.Flags().GetString(MessageFlag.Long)
+	var changes []FileChange
+	for _, file := range changedFiles {
+		if file.OldPath != "" && file.Status == 'R' {
+			changes = append(changes, FileChange{Path: file.OldPath, Deleted: true})
+		}
+		if file.Status == 'D' {
+			changes = append(changes, FileChange{Path: file.Path, Deleted: true})
+			continue
+		}
+		// Submodules cannot be committed as blobs
+		if file.Mode == "160000" {
+			continue
+		}
 
-	if usePr {
-		headRef, _ := cmd.Flags().GetString(HeadRefFlag.Long)
-		if headRef == "" {
-			uuidValue, _ := uuid.NewV7()
-			headRef = fmt.Sprintf("%s-%s", branch, uuidValue)
+		var content []byte
+		if commitRange != "" {
+			content, err = ReadBlob(file.Sha)
+		} else {
+			content, _, err = ReadLocalFile(filepath.Join(rootPath, filepath.FromSlash(file.Path)))
+		}
+		if err != nil {
+			return nil, err
+		}
+		if content == nil {
+			content = []byte{}
 		}
 
-		labels, _ := cmd.Flags().GetStringSlice(PrLabelFlag.Long)
-		title, _ := cmd.Flags().GetString(PrTitleFlag.Long)
-		description, _ := cmd.Flags().GetString(PrDescFlag.Long)
+		changes = append(changes, FileChange{Path: file.Path, LocalPath: file.Path, Mode: file.Mode, Content: content})
+	}
+	return changes, nil
+}
 
-		if title == "" {
-			title = commitMessage
+func ValidateAndConfigureRun(args []string, cmd *cobra.Command, rs *RepoSettings) (*RunSettings, error) {
+	if pathspecFile, _ := cmd.Flags().GetString(SpecFile.Long); pathspecFile != "" {
+		if len(args) > 0 {
+			return nil, errors.New("`pathspec-from-file` cannot be used with explicit file selection")
+		}
+		if archive, _ := cmd.Flags().GetString(ArchiveFlag.Long); archive == "-" && pathspecFile == "-" {
+			return nil, errors.New("`pathspec-from-file` and `archive` cannot both read from stdin")
 		}
 
-		if description == "" {
-			description = commitMessage
+		nul, _ := cmd.Flags().GetBool(SpecFileNul.Long)
+		pathspecs, err := ReadPathspecs(pathspecFile, nul)
+		if err != nil {
+			return nil, err
+		}
+		if len(pathspecs) == 0 {
+			return nil, errors.New("no pathspecs were read from " + pathspecFile)
 		}
+		args = pathspecs
+	}
 
-		prSettings = &PrSettings{
-			BaseRef:     branch,
-			HeadRef:     headRef,
-			Labels:      labels,
-			Description: description,
-			Title:       title,
+	var fileSelection []FileChange
+	var mirror *MirrorSettings
+	commitAll, _ := cmd.Flags().GetBool(AllFlag.Long)
+	sourceDir, _ := cmd.Flags().GetString(SourceDir.Long)
+	mirrorDir, _ := cmd.Flags().GetString(MirrorFlag.Long)
+	archive, _ := cmd.Flags().GetString(ArchiveFlag.Long)
+	since, _ := cmd.Flags().GetString(SinceFlag.Long)
+	commitRange, _ := cmd.Flags().GetString(RangeFlag.Long)
+	prefix, _ := cmd.Flags().GetString(PrefixFlag.Long)
+	maps, _ := cmd.Flags().GetStringSlice(MapFlag.Long)
+	excludes, _ := cmd.Flags().GetStringSlice(ExcludeFlag.Long)
+	interactive, _ := cmd.Flags().GetBool(Interactive.Long)
+
+	if since != "" || commitRange != "" {
+		changes, err := GetChangedFileSelection(since, commitRange, args)
+		if err != nil {
+			return nil, err
+		}
+		fileSelection = changes
+	} else if archive != "" {
+		changes, err := GetArchiveSelection(archive, args)
+		if err != nil {
+			return nil, err
 		}
+		fileSelection = changes
+	} else if mirrorDir != "" {
+		localDir, remoteDir := SplitDirMapping(mirrorDir)
+		mirror = &MirrorSettings{LocalDir: localDir, RemoteDir: remoteDir, Exclude: excludes}
 
-		commitSettings = &CommitSettings{
-			CommitMessage:  commitMessage,
-			CommitToBranch: headRef,
+		changes, err := mirror.Selection()
+		if err != nil {
+			return nil, err
+		}
+		fileSelection = changes
+	} else if sourceDir != "" {
+		localDir, remoteDir := SplitDirMapping(sourceDir)
+		if remoteDir != "" {
+			if prefix != "" {
+				return nil, errors.New("a remote directory in `source-dir` cannot be used with `prefix`")
+			}
+			prefix = remoteDir
 		}
 
+		changes, err := GetSourceDirSelection(localDir, args, commitAll)
+		if err != nil {
+			return nil, err
+		}
+		fileSelection = changes
+	} else if interactive {
+		commitUntracked, _ := cmd.Flags().GetBool(Untracked.Long)
+		files, err := SelectFilesInteractively(commitUntracked)
+		if err != nil {
+			return nil, err
+		}
+		fileSelection = ChangesFromPaths(files)
 	} else {
-		prSettings = nil
-		commitSettings = &CommitSettings{
-			CommitMessage:  commitMessage,
-			CommitToBranch: branch,
+		files, err := GetFileSelection(
+			args,
+			commitAll,
+			func() bool { b, _ := cmd.Flags().GetBool(Untracked.Long); return b }(),
+		)
+		if err != nil {
+			return nil, err
 		}
+		fileSelection = ChangesFromPaths(files)
 	}
 
+	mapping, err := ParsePathMapping(prefix, maps)
+	if err != nil {
+		return nil, err
+	}
+	if mirror == nil {
+		// Excludes match the paths as they were selected, before any mapping
+		fileSelection = mapping.Apply(ApplyExcludes(fileSelection, excludes))
+	}
+
+	fmt.Fprintf(out, "%s Selected %d file(s) for commit\n",
+		color.New(color.FgGreen).Sprint("✅"),
+		len(fileSelection),
+	)
+
+	dryRun, _ := cmd.Flags().GetBool(DryRun.Long)
+	jsonOutput, _ := cmd.Flags().GetBool(JSONFlag.Long)
+	allowEmpty, _ := cmd.Flags().GetBool(AllowEmpty.Long)
+	diff, _ := cmd.Flags().GetBool(DiffFlag.Long)
+	yes, _ := cmd.Flags().GetBool(YesFlag.Long)
+	allowProtected, _ := cmd.Flags().GetBool(ProtectFlag.Long)
+	keepOnFailure, _ := cmd.Flags().GetBool(KeepFlag.Long)
+	fork, _ := cmd.Flags().GetBool(ForkFlag.Long)
+	forkOwner, _ := cmd.Flags().GetString(ForkOwner.Long)
+	commitMessage, _ := cmd.Flags().GetString(MessageFlag.Long)
+	prSettings, commitSettings := ConfigureBranches(cmd, commitMessage)
+
 	runSettings := &RunSettings{
 		PrSettings:     prSettings,
 		CommitSettings: commitSettings,
 		FileSelection:  fileSelection,
+		Mirror:         mirror,
 		DryRun:         dryRun,
+		AllowEmpty:     allowEmpty,
+		Diff:           diff,
+		Interactive:    interactive,
+		Yes:            yes,
+		AllowProtected: allowProtected,
+		KeepOnFailure:  keepOnFailure,
+		AutoPr:         AutoPrSettings(cmd, commitMessage),
+		Fork:           fork,
+		ForkOwner:      forkOwner,
+		JSON:           jsonOutput,
 		RepoSettings:   rs,
 	}
+	runSettings.Result = runSettings.NewRunResult()
+	runSettings.Result.SetFiles(fileSelection)
+
+	// An empty mirror still has to delete whatever exists remotely
+	if len(fileSelection) == 0 && mirror == nil && !allowEmpty {
+		runSettings.Result.NoChanges = true
+		runSettings.Result.ExportGitHubActions()
+		if jsonOutput {
+			_ = runSettings.Result.Write()
+		}
+		os.Exit(ExitNoChanges)
+	}
 
 	if len(fileSelection) > 0 {
 		header := color.New(color.FgCyan, color.Bold).Sprint("📦 Files selected for commit:")
-		fmt.Println(header)
+		fmt.Fprintln(out, header)
 
-		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
 		for i, file := range fileSelection {
 			index := color.New(color.FgYellow).Sprintf("%d.", i+1)
-			name := color.New(color.FgWhite).Sprint(file)
+			name := color.New(color.FgWhite).Sprint(file.Describe())
 			_, _ = fmt.Fprintf(w, "%s\t%s\n", index, name)
 		}
 		_ = w.Flush()
@@ -244,9 +431,76 @@ func ValidateAndConfigureRun(args []string, cmd *cobra.Command, rs *RepoSettings
 	return runSettings, nil
 }
 
-func generateHelpText() string {
-	builder := &strings.Builder{}
-	builder.WriteString(`gh-commit: Commit files using the GitHub API.
+// ConfigureBranches decides where the commit goes: straight to --branch, or to a head
+// ref that a PR against --branch is opened from.
+func ConfigureBranches(cmd *cobra.Command, commitMessage string) (*PrSettings, *CommitSettings) {
+	var prSettings *PrSettings
+	var commitSettings *CommitSettings
+	usePr, _ := cmd.Flags().GetBool(UsePrFlag.Long)
+	branch, _ := cmd.Flags().GetString(BranchFlag.Long)
+
+	if usePr {
+		prSettings = newPrSettings(cmd, branch, commitMessage)
+		headRef := prSettings.HeadRef
+
+		commitSettings = &CommitSettings{
+			CommitMessage:  commitMessage,
+			CommitToBranch: headRef,
+		}
+
+	} else {
+		prSettings = nil
+		commitSettings = &CommitSettings{
+			CommitMessage:  commitMessage,
+			CommitToBranch: branch,
+		}
+	}
+
+	return prSettings, commitSettings
+}
+
+// AutoPrSettings sets up the PR that --auto-pr falls back to, if it is given.
+func AutoPrSettings(cmd *cobra.Command, commitMessage string) *PrSettings {
+	autoPr, _ := cmd.Flags().GetBool(AutoPrFlag.Long)
+	usePr, _ := cmd.Flags().GetBool(UsePrFlag.Long)
+	if !autoPr || usePr {
+		return nil
+	}
+	branch, _ := cmd.Flags().GetString(BranchFlag.Long)
+	return newPrSettings(cmd, branch, commitMessage)
+}
+
+// newPrSettings sets up a PR into branch from the PR flags. Unless a head ref is given,
+// one is generated in the format of <BASE REF>-<UUIDv7>.
+func newPrSettings(cmd *cobra.Command, branch, commitMessage string) *PrSettings {
+	headRef, _ := cmd.Flags().GetString(HeadRefFlag.Long)
+	if headRef == "" {
+		uuidValue, _ := uuid.NewV7()
+		headRef = fmt.Sprintf("%s-%s", branch, uuidValue)
+	}
+
+	labels, _ := cmd.Flags().GetStringSlice(PrLabelFlag.Long)
+	title, _ := cmd.Flags().GetString(PrTitleFlag.Long)
+	description, _ := cmd.Flags().GetString(PrDescFlag.Long)
+
+	if title == "" {
+		title = commitMessage
+	}
+
+	if description == "" {
+		description = commitMessage
+	}
+
+	return &PrSettings{
+		BaseRef:     branch,
+		HeadRef:     headRef,
+		Labels:      labels,
+		Description: description,
+		Title:       title,
+	}
+}
+
+const rootHelpText = `gh-commit: Commit files using the GitHub API.
 
 Commits made via the API will be recognized as signed if used in a GitHub
 Actions runner. Commits made with a Personal Access Token (PAT) will also
@@ -254,9 +508,25 @@ appear as signed.
 
 Synopsis:
   gh commit [files] -B <branch> -m <message> [flags]
+  gh commit apply <file.patch|-> -B <branch> [flags]
+  gh commit plan [files] -B <branch> -m <message> -o <plan.json|-> [flags]
+  gh commit apply <plan.json|-> [flags]
+  gh commit doctor [flags]
+  gh commit prune [--dry-run] [flags]
+
+Defaults for any flag can be set in a .gh-commit.yml at the repository root,
+or in gh-commit.yml under the gh config dir, with named sets of options under
+"profiles". Every flag can also be set through a GH_COMMIT_<LONG_NAME>
+environment variable, e.g. GH_COMMIT_USE_PR=true, with lists separated by
+commas or newlines. Command-line flags take precedence over the environment,
+which takes precedence over the config files.
 
 Flags:
-`)
+`
+
+func generateHelpText(intro string, flags []Flag) string {
+	builder := &strings.Builder{}
+	builder.WriteString(intro)
 
 	table := tablewriter.NewWriter(builder)
 	table.SetAutoWrapText(true)
@@ -269,9 +539,13 @@ Flags:
 	table.SetTablePadding("  ") // pad columns with 2 spaces
 	table.SetNoWhiteSpace(true)
 
-	for _, f := range allFlags {
+	for _, f := range flags {
+		short := ""
+		if f.Short != "" {
+			short = "-" + f.Short + ","
+		}
 		table.Append([]string{
-			"-" + f.Short + ",", "--" + f.Long, f.Description,
+			short, "--" + f.Long, f.Description,
 		})
 	}
 	table.Append([]string{"-V,", "--version", "Print current version"})
@@ -281,13 +555,123 @@ Flags:
 	return builder.String()
 }
 
+// validateRunFlags rejects combinations of the selection and branch flags that cannot
+// work together, before anything is read or requested.
+func validateRunFlags(cmd *cobra.Command, args []string) error {
+	message, _ := cmd.Flags().GetString(MessageFlag.Long)
+	branch, _ := cmd.Flags().GetString(BranchFlag.Long)
+	if message == "" || branch == "" {
+		return fmt.Errorf("--message and --branch are both required flags, or %s and %s", EnvName(MessageFlag), EnvName(BranchFlag))
+	}
+
+	repoName, _ := cmd.Flags().GetString(RepoFlag.Long)
+	remoteName, _ := cmd.Flags().GetString(RemoteFlag.Long)
+	if repoName != "" && remoteName != "" {
+		return errors.New("`repo` and `remote` cannot be used together")
+	}
+
+	sourceDir, _ := cmd.Flags().GetString(SourceDir.Long)
+	if sourceDir != "" {
+		if repoName == "" {
+			return errors.New("`source-dir` requires `repo`, as there is no local repository to infer it from")
+		}
+		if untracked, _ := cmd.Flags().GetBool(Untracked.Long); untracked {
+			return errors.New("`untracked` cannot be used with `source-dir`")
+		}
+	}
+
+	fork, _ := cmd.Flags().GetBool(ForkFlag.Long)
+	usePr, _ := cmd.Flags().GetBool(UsePrFlag.Long)
+	if fork && !usePr {
+		return errors.New("`fork` can only be used in conjunction with `use-pr`")
+	}
+	if autoPr, _ := cmd.Flags().GetBool(AutoPrFlag.Long); autoPr && usePr {
+		return errors.New("`auto-pr` cannot be used with `use-pr`, which always opens a PR")
+	}
+
+	since, _ := cmd.Flags().GetString(SinceFlag.Long)
+	commitRange, _ := cmd.Flags().GetString(RangeFlag.Long)
+	if since != "" || commitRange != "" {
+		commitAll, _ := cmd.Flags().GetBool(AllFlag.Long)
+		untracked, _ := cmd.Flags().GetBool(Untracked.Long)
+		mirrorDir, _ := cmd.Flags().GetString(MirrorFlag.Long)
+		archive, _ := cmd.Flags().GetString(ArchiveFlag.Long)
+		if since != "" && commitRange != "" {
+			return errors.New("`since` and `range` cannot be used together")
+		}
+		if commitAll || untracked || sourceDir != "" || mirrorDir != "" || archive != "" {
+			return errors.New("`since` and `range` cannot be used with `source-dir`, `mirror`, `archive`, `all` or `untracked`")
+		}
+	}
+
+	if archive, _ := cmd.Flags().GetString(ArchiveFlag.Long); archive != "" {
+		commitAll, _ := cmd.Flags().GetBool(AllFlag.Long)
+		untracked, _ := cmd.Flags().GetBool(Untracked.Long)
+		mirrorDir, _ := cmd.Flags().GetString(MirrorFlag.Long)
+		if commitAll || untracked || sourceDir != "" || mirrorDir != "" {
+			return errors.New("`archive` cannot be used with `source-dir`, `mirror`, `all` or `untracked`")
+		}
+	}
+
+	if interactive, _ := cmd.Flags().GetBool(Interactive.Long); interactive {
+		commitAll, _ := cmd.Flags().GetBool(AllFlag.Long)
+		mirrorDir, _ := cmd.Flags().GetString(MirrorFlag.Long)
+		archive, _ := cmd.Flags().GetString(ArchiveFlag.Long)
+		pathspecFile, _ := cmd.Flags().GetString(SpecFile.Long)
+		if len(args) > 0 || commitAll || sourceDir != "" || mirrorDir != "" || archive != "" || since != "" || commitRange != "" || pathspecFile != "" {
+			return errors.New("`interactive` cannot be used with `all`, `source-dir`, `mirror`, `archive`, `since`, `range`, `pathspec-from-file` or explicit file selection")
+		}
+		if !isInteractive() {
+			return errors.New("`interactive` needs a terminal to pick the files in")
+		}
+	}
+
+	if mirrorDir, _ := cmd.Flags().GetString(MirrorFlag.Long); mirrorDir != "" {
+		commitAll, _ := cmd.Flags().GetBool(AllFlag.Long)
+		prefix, _ := cmd.Flags().GetString(PrefixFlag.Long)
+		maps, _ := cmd.Flags().GetStringSlice(MapFlag.Long)
+		if len(args) > 0 || commitAll || sourceDir != "" {
+			return errors.New("`mirror` cannot be used with `source-dir`, `all` or explicit file selection")
+		}
+		if prefix != "" || len(maps) > 0 {
+			return errors.New("`mirror` cannot be used with `prefix` or `map`; use <local-dir>:<remote-dir> instead")
+		}
+	}
+
+	return nil
+}
+
+// connectRun finds the local checkout, if files are selected from one, and the repository
+// to commit to.
+func connectRun(ctx context.Context, cmd *cobra.Command) (*RepoSettings, error) {
+	// Without a source or mirror directory, or an archive, files are selected from the local checkout
+	sourceDir, _ := cmd.Flags().GetString(SourceDir.Long)
+	mirrorDir, _ := cmd.Flags().GetString(MirrorFlag.Long)
+	archive, _ := cmd.Flags().GetString(ArchiveFlag.Long)
+	if sourceDir == "" && mirrorDir == "" && archive == "" {
+		path, err := ValidateLocalGit()
+		if err != nil {
+			return nil, err
+		} else {
+			rootPath = path
+		}
+	}
+
+	repoName, _ := cmd.Flags().GetString(RepoFlag.Long)
+	remoteName, _ := cmd.Flags().GetString(RemoteFlag.Long)
+	target, err := ResolveTargetRepository(repoName, remoteName)
+	if err != nil {
+		return nil, err
+	}
+	return ValidateGitRemote(ctx, target)
+}
+
 var rootCmd = &cobra.Command{
 	Use:   "gh-commit",
+	Args:  cobra.ArbitraryArgs,
 	Short: "gh-commit: commit files easily to git using the Github API",
 	Long:  "gh-commit: a CLI tool for committing changes via the Github API, especially useful for working in ephemeral environments.",
 	PreRunE: func(cmd *cobra.Command, args []string) error {
-		message, _ := cmd.Flags().GetString(MessageFlag.Long)
-		branch, _ := cmd.Flags().GetString(BranchFlag.Long)
 		versionFlag, _ := cmd.Flags().GetBool("version")
 
 		if versionFlag {
@@ -298,27 +682,28 @@ var rootCmd = &cobra.Command{
 			os.Exit(0)
 		}
 
-		if message == "" || branch == "" {
-			return fmt.Errorf("--message and --branch are both required flags")
-		}
-
-		return nil
-	},
-	RunE: func(cmd *cobra.Command, args []string) error {
-
-		path, err := ValidateLocalGit()
+		sources, err := LoadConfig(cmd, allFlags)
 		if err != nil {
 			return err
-		} else {
-			rootPath = path
+		}
+		if printConfig, _ := cmd.Flags().GetBool(PrintConfig.Long); printConfig {
+			PrintResolvedConfig(cmd, allFlags, sources)
+			os.Exit(0)
+		}
+		if jsonOutput, _ := cmd.Flags().GetBool(JSONFlag.Long); jsonOutput {
+			UseJSONOutput()
 		}
 
-		repoSettings, err := ValidateGitRemote()
+		return validateRunFlags(cmd, args)
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx, finishRun, err := StartRun(cmd)
 		if err != nil {
 			return err
 		}
+		defer finishRun()
 
-		_, err = gh.CurrentRepository()
+		repoSettings, err := connectRun(ctx, cmd)
 		if err != nil {
 			return err
 		}
@@ -328,21 +713,22 @@ var rootCmd = &cobra.Command{
 			return err
 		}
 
-		// Check all labels exist
-		if settings.PrSettings != nil && len(settings.PrSettings.Labels) > 0 {
-			err = ValidateAllLabels(settings.PrSettings.Labels)
+		// Check all labels exist. A dry run reports missing labels along with everything else.
+		if !settings.DryRun && settings.PrSettings != nil && len(settings.PrSettings.Labels) > 0 {
+			err = ValidateAllLabels(ctx, settings.PrSettings.Labels)
 			if err != nil {
 				return err
 			}
 		}
 
 		if settings.DryRun {
-			settings.ExecuteDryRun()
+			err = settings.ExecuteDryRun(ctx)
 		} else {
-			err := settings.Commit()
+			err = settings.Commit(ctx)
+		}
+		if err != nil {
 			return err
 		}
-
-		return nil
+		return settings.Report()
 	},
 }
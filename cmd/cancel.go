@@ -0,0 +1,110 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// stopContext is cancelled on SIGINT or SIGTERM. Requests in flight are not cut off, as
+// the run would not know whether they went through, so the run stops at the next safe
+// point instead.
+var stopContext = context.Background()
+
+// trapSignals is only done once the run starts writing. Until then, nothing needs undoing
+// and an interrupt ends the process as usual.
+var trapSignals sync.Once
+
+// rollbackTimeout bounds undoing a run, which cannot use the context of the run once that
+// timed out.
+const rollbackTimeout = 30 * time.Second
+
+// StartRun starts the clock of --timeout, if given, and turns on --verbose. The returned
+// context bounds every API request of the run, and the returned function stops the clock
+// and, with --verbose, reports the rate-limit budget left.
+func StartRun(cmd *cobra.Command) (context.Context, func(), error) {
+	verbose, _ = cmd.Flags().GetBool(VerboseFlag.Long)
+
+	value, _ := cmd.Flags().GetString(TimeoutFlag.Long)
+	if value == "" {
+		return context.Background(), PrintRateLimit, nil
+	}
+
+	timeout, err := time.ParseDuration(value)
+	if err != nil || timeout <= 0 {
+		return nil, nil, fmt.Errorf("invalid timeout %q, expected e.g. 90s or 10m", value)
+	}
+	ctx, cancel := context.WithTimeoutCause(context.Background(), timeout, fmt.Errorf("the run timed out after %s", timeout))
+	return ctx, func() {
+		cancel()
+		PrintRateLimit()
+	}, nil
+}
+
+// handleSignals stops the run at the next safe point on SIGINT or SIGTERM. In a terminal, a
+// second interrupt quits right away. CI runners follow up with SIGKILL on their own.
+func handleSignals() {
+	var stop context.CancelCauseFunc
+	stopContext, stop = context.WithCancelCause(context.Background())
+
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		received := <-signals
+		stop(fmt.Errorf("the run was interrupted by %s", received))
+		if !isInteractive() {
+			return
+		}
+		warn("Stopping at the next safe point, interrupt again to quit right away")
+		<-signals
+		os.Exit(130)
+	}()
+}
+
+// Progress follows the steps of a run that write to the remote. Between two steps, nothing
+// is half done, which makes it a safe point to stop at.
+type Progress struct {
+	Steps []string
+	next  int
+}
+
+// NewProgress starts following the steps of a run, and from then on stops the run at a safe
+// point rather than wherever it is when interrupted.
+func NewProgress(steps ...string) *Progress {
+	trapSignals.Do(handleSignals)
+	return &Progress{Steps: steps}
+}
+
+// Add adds steps to the end of the run.
+func (p *Progress) Add(steps ...string) {
+	p.Steps = append(p.Steps, steps...)
+}
+
+// Next is called before each step. It stops the run if it was interrupted or its context
+// timed out, reporting which steps were completed and which were not.
+func (p *Progress) Next(ctx context.Context) error {
+	cause := context.Cause(stopContext)
+	if cause == nil {
+		cause = context.Cause(ctx)
+	}
+	if cause == nil {
+		p.next++
+		return nil
+	}
+
+	fmt.Fprintf(out, "%s\n", color.New(color.FgRed, color.Bold).Sprintf("🛑 Stopping at a safe point, %s:", cause))
+	for i, step := range p.Steps {
+		if i < p.next {
+			fmt.Fprintf(out, "   %s %s\n", color.New(color.FgGreen).Sprint("✔"), step)
+		} else {
+			fmt.Fprintf(out, "   %s %s\n", color.New(color.FgHiBlack).Sprint("✘"), color.New(color.FgHiBlack).Sprintf("%s (not done)", step))
+		}
+	}
+	return cause
+}
@@ -0,0 +1,234 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/cli/go-gh/pkg/api"
+	"github.com/cli/go-gh/pkg/repository"
+	"github.com/spf13/cobra"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// contextRecorder is an api.RESTClient that records the context of every request.
+type contextRecorder struct {
+	api.RESTClient
+	contexts []context.Context
+}
+
+func (c *contextRecorder) DoWithContext(ctx context.Context, method string, path string, body io.Reader, response interface{}) error {
+	c.contexts = append(c.contexts, ctx)
+	return nil
+}
+
+func (c *contextRecorder) RequestWithContext(ctx context.Context, method string, path string, body io.Reader) (*http.Response, error) {
+	c.contexts = append(c.contexts, ctx)
+	return &http.Response{Body: http.NoBody}, nil
+}
+
+func TestHelpersUseContext(t *testing.T) {
+	target, err := repository.Parse("kassett/gh-commit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	originalRepo, originalClient := repo, client
+	defer func() { repo, client = originalRepo, originalClient }()
+	repo = target
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	recorder := &contextRecorder{}
+	client = recorder
+	_, _ = GetTreeTip(ctx, "abc")
+	_, _ = CreateBlob(ctx, []byte("hello"))
+	_, _ = CreateTree(ctx, "abc", nil)
+	_, _ = CreateCommitFromTree(ctx, "abc", "def", "chore: update", nil)
+	_ = ClosePullRequest(ctx, target, 1)
+	_ = LabelPullRequest(ctx, 1, []string{"automated"})
+	_, _ = InspectToken(ctx)
+
+	if len(recorder.contexts) != 7 {
+		t.Fatalf("expected 7 requests, got %d", len(recorder.contexts))
+	}
+	for i, requestCtx := range recorder.contexts {
+		if requestCtx != ctx {
+			t.Errorf("request %d was not sent with the context of the run", i+1)
+		}
+	}
+}
+
+func TestStartRun(t *testing.T) {
+	tests := []struct {
+		value       string
+		expectError bool
+		expectLimit bool
+	}{
+		{value: ""},
+		{value: "10m", expectLimit: true},
+		{value: "0s", expectError: true},
+		{value: "ten minutes", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			cmd := &cobra.Command{}
+			registerFlags(cmd, []Flag{TimeoutFlag, VerboseFlag})
+			_ = cmd.Flags().Set(TimeoutFlag.Long, tt.value)
+
+			ctx, stop, err := StartRun(cmd)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			defer stop()
+
+			if _, limited := ctx.Deadline(); limited != tt.expectLimit {
+				t.Errorf("expected a deadline: %v", tt.expectLimit)
+			}
+		})
+	}
+}
+
+func TestProgressNext(t *testing.T) {
+	originalOut, originalStop := out, stopContext
+	defer func() { out, stopContext = originalOut, originalStop }()
+
+	interrupted := errors.New("the run was interrupted by interrupt")
+	timedOut := errors.New("the run timed out after 1m0s")
+
+	tests := []struct {
+		name          string
+		stop          error
+		timeout       error
+		expectedErr   error
+		expectedLines []string
+	}{
+		{name: "Not stopped"},
+		{
+			name:        "Interrupted",
+			stop:        interrupted,
+			expectedErr: interrupted,
+			expectedLines: []string{
+				"🛑 Stopping at a safe point, the run was interrupted by interrupt:",
+				"   ✔ upload the blobs",
+				"   ✔ create the tree",
+				"   ✘ create the commit (not done)",
+				"   ✘ move main to the commit (not done)",
+			},
+		},
+		{
+			name:        "Timed out",
+			timeout:     timedOut,
+			expectedErr: timedOut,
+			expectedLines: []string{
+				"🛑 Stopping at a safe point, the run timed out after 1m0s:",
+				"   ✔ upload the blobs",
+				"   ✔ create the tree",
+				"   ✘ create the commit (not done)",
+				"   ✘ move main to the commit (not done)",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buffer := &bytes.Buffer{}
+			out = buffer
+			ctx := context.Background()
+			stopContext = context.Background()
+
+			progress := &Progress{Steps: []string{"upload the blobs", "create the tree", "create the commit"}}
+			progress.Add("move main to the commit")
+			for i := 0; i < 2; i++ {
+				if err := progress.Next(ctx); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			}
+
+			if tt.stop != nil {
+				stopped, stop := context.WithCancelCause(context.Background())
+				stop(tt.stop)
+				stopContext = stopped
+			}
+			if tt.timeout != nil {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithDeadlineCause(ctx, time.Now(), tt.timeout)
+				defer cancel()
+			}
+
+			err := progress.Next(ctx)
+			if !errors.Is(err, tt.expectedErr) {
+				t.Errorf("expected error %v, got %v", tt.expectedErr, err)
+			}
+			var lines []string
+			if output := strings.TrimSuffix(buffer.String(), "\n"); output != "" {
+				lines = strings.Split(output, "\n")
+			}
+			if !equal(lines, tt.expectedLines) {
+				t.Errorf("expected output %q, got %q", tt.expectedLines, lines)
+			}
+		})
+	}
+}
+
+// hookClient is a MockRESTClient that calls after once a request was answered.
+type hookClient struct {
+	*MockRESTClient
+	after func(method, path string)
+}
+
+func (h *hookClient) DoWithContext(ctx context.Context, method string, path string, body io.Reader, response interface{}) error {
+	err := h.MockRESTClient.DoWithContext(ctx, method, path, body, response)
+	h.after(method, path)
+	return err
+}
+
+func TestOpenPullRequestStopsBeforeLabels(t *testing.T) {
+	target, err := repository.Parse("kassett/gh-commit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	originalRepo, originalUpstream, originalClient, originalJournal, originalOut, originalStop := repo, upstream, client, journal, out, stopContext
+	defer func() {
+		repo, upstream, client, journal, out, stopContext = originalRepo, originalUpstream, originalClient, originalJournal, originalOut, originalStop
+	}()
+	repo, upstream, journal, out, stopContext = target, nil, &Journal{}, &bytes.Buffer{}, context.Background()
+
+	timedOut := errors.New("the run timed out after 1m0s")
+	ctx, cancel := context.WithCancelCause(context.Background())
+	defer cancel(nil)
+	mock := &MockRESTClient{Responses: map[string]string{
+		"POST repos/kassett/gh-commit/pulls": `{"number": 7, "html_url": "https://github.com/kassett/gh-commit/pull/7"}`,
+	}}
+	client = &hookClient{MockRESTClient: mock, after: func(method, path string) {
+		if strings.HasSuffix(path, "/pulls") {
+			cancel(timedOut)
+		}
+	}}
+
+	rn := &RunSettings{
+		PrSettings: &PrSettings{BaseRef: "main", HeadRef: "main-1", Title: "chore: update", Labels: []string{"automated"}},
+		Result:     &RunResult{TimingsMs: map[string]int64{}},
+	}
+	progress := &Progress{Steps: rn.prSteps()}
+	err = rn.OpenPullRequest(ctx, progress)
+	if !errors.Is(err, timedOut) {
+		t.Errorf("expected the run to stop before labelling, got %v", err)
+	}
+	if len(mock.Calls) != 1 || !strings.HasPrefix(mock.Calls[0], "POST repos/kassett/gh-commit/pulls") {
+		t.Errorf("expected only the pull request to be opened, got %v", mock.Calls)
+	}
+	if len(journal.Mutations) != 1 {
+		t.Errorf("expected the pull request to be journaled for rolling back")
+	}
+}
@@ -0,0 +1,279 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"github.com/cli/go-gh/pkg/config"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+const (
+	repoConfigName = ".gh-commit.yml"
+	userConfigName = "gh-commit.yml"
+	envPrefix      = "GH_COMMIT_"
+	envSource      = "environment"
+)
+
+// ConfigLayer holds the flag values set by one part of a config file: its top-level
+// defaults, or one of its profiles.
+type ConfigLayer struct {
+	Source string
+	Values map[string][]string
+}
+
+// configPaths lists the config files from the least to the most specific: the user's,
+// under the gh config dir, then the one at the root of the current repository.
+func configPaths() []string {
+	paths := []string{filepath.Join(config.ConfigDir(), userConfigName)}
+
+	out, err := executor.RunCommand("git", "rev-parse", "--show-toplevel")
+	if err == nil {
+		if root := strings.TrimSpace(string(out)); root != "" {
+			paths = append(paths, filepath.Join(root, repoConfigName))
+		}
+	}
+	return paths
+}
+
+// ParseConfig reads the defaults of a config file, followed by the named profile, and
+// reports whether the profile was found.
+func ParseConfig(data []byte, source, profile string) ([]ConfigLayer, bool, error) {
+	var raw map[string]interface{}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, false, fmt.Errorf("invalid config file %s: %w", source, err)
+	}
+
+	profiles := raw["profiles"]
+	delete(raw, "profiles")
+
+	defaults, err := configValues(raw, source)
+	if err != nil {
+		return nil, false, err
+	}
+	layers := []ConfigLayer{{Source: source, Values: defaults}}
+
+	if profiles == nil || profile == "" {
+		return layers, false, nil
+	}
+	profileMap, ok := profiles.(map[string]interface{})
+	if !ok {
+		return nil, false, fmt.Errorf("`profiles` in %s must map profile names to options", source)
+	}
+
+	settings, found := profileMap[profile]
+	if !found {
+		return layers, false, nil
+	}
+	settingsMap, ok := settings.(map[string]interface{})
+	if !ok && settings != nil {
+		return nil, false, fmt.Errorf("the profile %s in %s must map options to values", profile, source)
+	}
+
+	profileSource := fmt.Sprintf("%s (profile %s)", source, profile)
+	values, err := configValues(settingsMap, profileSource)
+	if err != nil {
+		return nil, false, err
+	}
+	return append(layers, ConfigLayer{Source: profileSource, Values: values}), true, nil
+}
+
+func configValues(raw map[string]interface{}, source string) (map[string][]string, error) {
+	values := make(map[string][]string, len(raw))
+	for key, value := range raw {
+		flag, ok := configurableFlag(key)
+		if !ok {
+			return nil, fmt.Errorf("unknown option %q in %s", key, source)
+		}
+
+		switch v := value.(type) {
+		case nil:
+			continue
+		case map[string]interface{}:
+			return nil, fmt.Errorf("%s in %s must be a value, not a mapping", key, source)
+		case []interface{}:
+			if flag.Type != "stringSlice" {
+				return nil, fmt.Errorf("%s in %s takes a single value", key, source)
+			}
+			items := make([]string, 0, len(v))
+			for _, item := range v {
+				items = append(items, fmt.Sprint(item))
+			}
+			values[key] = items
+		default:
+			s := fmt.Sprint(v)
+			if flag.Type == "bool" {
+				if _, err := strconv.ParseBool(s); err != nil {
+					return nil, fmt.Errorf("%s in %s must be true or false", key, source)
+				}
+			}
+			values[key] = []string{s}
+		}
+	}
+	return values, nil
+}
+
+// configurableFlag finds the flag for a config key. Selecting the config itself is
+// only possible from the command line.
+func configurableFlag(name string) (Flag, bool) {
+	if name == ProfileFlag.Long || name == PrintConfig.Long {
+		return Flag{}, false
+	}
+	for _, flag := range allFlags {
+		if flag.Long == name {
+			return flag, true
+		}
+	}
+	return Flag{}, false
+}
+
+// EnvName is the environment variable bound to a flag, e.g. GH_COMMIT_USE_PR for --use-pr.
+func EnvName(flag Flag) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(flag.Long, "-", "_"))
+}
+
+// EnvLayer reads the environment variables bound to the flags. Empty variables count as
+// unset, as workflow inputs that were not given expand to nothing.
+func EnvLayer(flags []Flag, lookup func(string) (string, bool)) (ConfigLayer, error) {
+	layer := ConfigLayer{Source: envSource, Values: make(map[string][]string)}
+	for _, flag := range flags {
+		name := EnvName(flag)
+		value, ok := lookup(name)
+		if !ok || strings.TrimSpace(value) == "" {
+			continue
+		}
+
+		switch flag.Type {
+		case "stringSlice":
+			var items []string
+			for _, item := range strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == '\n' }) {
+				if item = strings.TrimSpace(item); item != "" {
+					items = append(items, item)
+				}
+			}
+			layer.Values[flag.Long] = items
+		case "bool":
+			if _, err := strconv.ParseBool(strings.TrimSpace(value)); err != nil {
+				return ConfigLayer{}, fmt.Errorf("%s must be true or false", name)
+			}
+			layer.Values[flag.Long] = []string{strings.TrimSpace(value)}
+		default:
+			layer.Values[flag.Long] = []string{value}
+		}
+	}
+	return layer, nil
+}
+
+// LoadConfig applies the config files, then the environment, to the flags that were not
+// given on the command line, and returns where the value of each flag came from.
+func LoadConfig(cmd *cobra.Command, flags []Flag) (map[string]string, error) {
+	env, err := EnvLayer(flags, os.LookupEnv)
+	if err != nil {
+		return nil, err
+	}
+
+	profile, _ := cmd.Flags().GetString(ProfileFlag.Long)
+	if values, ok := env.Values[ProfileFlag.Long]; ok && !cmd.Flags().Changed(ProfileFlag.Long) {
+		profile = values[0]
+	}
+
+	var layers []ConfigLayer
+	profileFound := false
+	for _, path := range configPaths() {
+		data, err := os.ReadFile(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read config file: %w", err)
+		}
+
+		fileLayers, found, err := ParseConfig(data, path, profile)
+		if err != nil {
+			return nil, err
+		}
+		layers = append(layers, fileLayers...)
+		profileFound = profileFound || found
+	}
+
+	if profile != "" && !profileFound {
+		return nil, fmt.Errorf("the profile %s is not defined in %s or %s", profile, repoConfigName, userConfigName)
+	}
+
+	return ApplyConfigLayers(cmd, flags, append(layers, env))
+}
+
+// ApplyConfigLayers sets the flags from the layers in order, so later layers win. Flags
+// given on the command line are left alone.
+func ApplyConfigLayers(cmd *cobra.Command, flags []Flag, layers []ConfigLayer) (map[string]string, error) {
+	sources := make(map[string]string, len(flags))
+	for _, flag := range flags {
+		f := cmd.Flags().Lookup(flag.Long)
+		if f == nil {
+			continue
+		}
+		if f.Changed {
+			sources[flag.Long] = "command line"
+			continue
+		}
+
+		sources[flag.Long] = "default"
+		for _, layer := range layers {
+			values, ok := layer.Values[flag.Long]
+			if !ok {
+				continue
+			}
+			if err := setFlagValue(f, values); err != nil {
+				return nil, fmt.Errorf("invalid %s in %s: %w", flag.Long, layer.Source, err)
+			}
+			sources[flag.Long] = layer.Source
+		}
+	}
+	return sources, nil
+}
+
+// setFlagValue sets a flag without marking it as changed, which is reserved for flags
+// given on the command line.
+func setFlagValue(f *pflag.Flag, values []string) error {
+	if slice, ok := f.Value.(pflag.SliceValue); ok {
+		return slice.Replace(values)
+	}
+	if len(values) == 0 {
+		return nil
+	}
+	return f.Value.Set(values[0])
+}
+
+// PrintResolvedConfig shows the resolved value of every flag and where it came from.
+func PrintResolvedConfig(cmd *cobra.Command, flags []Flag, sources map[string]string) {
+	heading := color.New(color.FgCyan, color.Bold).SprintFunc()
+	fmt.Printf("%s\n\n", heading("Resolved configuration:"))
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, flag := range flags {
+		f := cmd.Flags().Lookup(flag.Long)
+		if f == nil || flag.Long == ProfileFlag.Long || flag.Long == PrintConfig.Long {
+			continue
+		}
+
+		value := f.Value.String()
+		if slice, ok := f.Value.(pflag.SliceValue); ok {
+			value = strings.Join(slice.GetSlice(), ", ")
+		}
+		source := sources[flag.Long]
+		_, _ = fmt.Fprintf(w, "   %s\t%s\t%s\n",
+			color.New(color.FgWhite).Sprint("--"+flag.Long),
+			value,
+			color.New(color.FgYellow).Sprint(source),
+		)
+	}
+	_ = w.Flush()
+}
@@ -0,0 +1,229 @@
+package cmd
+
+import (
+	"errors"
+	"github.com/spf13/cobra"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseConfig(t *testing.T) {
+	data := `
+branch: main
+label: [automated, bot]
+untracked: true
+profiles:
+  nightly:
+    branch: nightly
+    use-pr: true
+`
+
+	tests := []struct {
+		name           string
+		data           string
+		profile        string
+		expectedLayers []ConfigLayer
+		expectedFound  bool
+		expectedError  error
+	}{
+		{
+			name: "Defaults only",
+			data: data,
+			expectedLayers: []ConfigLayer{
+				{Source: "repo", Values: map[string][]string{"branch": {"main"}, "label": {"automated", "bot"}, "untracked": {"true"}}},
+			},
+		},
+		{
+			name:    "Defaults and profile",
+			data:    data,
+			profile: "nightly",
+			expectedLayers: []ConfigLayer{
+				{Source: "repo", Values: map[string][]string{"branch": {"main"}, "label": {"automated", "bot"}, "untracked": {"true"}}},
+				{Source: "repo (profile nightly)", Values: map[string][]string{"branch": {"nightly"}, "use-pr": {"true"}}},
+			},
+			expectedFound: true,
+		},
+		{
+			name:    "Missing profile",
+			data:    data,
+			profile: "weekly",
+			expectedLayers: []ConfigLayer{
+				{Source: "repo", Values: map[string][]string{"branch": {"main"}, "label": {"automated", "bot"}, "untracked": {"true"}}},
+			},
+		},
+		{
+			name:          "Unknown option",
+			data:          "brnch: main\n",
+			expectedError: errors.New("unknown option \"brnch\" in repo"),
+		},
+		{
+			name:          "Profile cannot be set from config",
+			data:          "profile: nightly\n",
+			expectedError: errors.New("unknown option \"profile\" in repo"),
+		},
+		{
+			name:          "List for a single value",
+			data:          "branch: [main, dev]\n",
+			expectedError: errors.New("branch in repo takes a single value"),
+		},
+		{
+			name:          "Invalid bool",
+			data:          "untracked: sometimes\n",
+			expectedError: errors.New("untracked in repo must be true or false"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			layers, found, err := ParseConfig([]byte(tt.data), "repo", tt.profile)
+
+			if err != nil && tt.expectedError != nil {
+				if err.Error() != tt.expectedError.Error() {
+					t.Errorf("expected error %v, got %v", tt.expectedError, err)
+				}
+			} else if err != nil || tt.expectedError != nil {
+				t.Errorf("expected error %v, got %v", tt.expectedError, err)
+			}
+
+			if !reflect.DeepEqual(layers, tt.expectedLayers) {
+				t.Errorf("expected layers %+v, got %+v", tt.expectedLayers, layers)
+			}
+			if found != tt.expectedFound {
+				t.Errorf("expected found to be %v, got %v", tt.expectedFound, found)
+			}
+		})
+	}
+}
+
+func TestApplyConfigLayers(t *testing.T) {
+	command := &cobra.Command{}
+	flags := []Flag{BranchFlag, MessageFlag, PrLabelFlag, Untracked}
+	registerFlags(command, flags)
+	if err := command.Flags().Parse([]string{"-m", "from the command line"}); err != nil {
+		t.Fatal(err)
+	}
+
+	layers := []ConfigLayer{
+		{Source: "user", Values: map[string][]string{"branch": {"main"}, "message": {"from config"}, "label": {"a", "b"}}},
+		{Source: "repo", Values: map[string][]string{"branch": {"develop"}}},
+	}
+	sources, err := ApplyConfigLayers(command, flags, layers)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	branch, _ := command.Flags().GetString(BranchFlag.Long)
+	message, _ := command.Flags().GetString(MessageFlag.Long)
+	labels, _ := command.Flags().GetStringSlice(PrLabelFlag.Long)
+	if branch != "develop" || message != "from the command line" || !equal(labels, []string{"a", "b"}) {
+		t.Errorf("unexpected values: branch=%q message=%q labels=%q", branch, message, labels)
+	}
+	if command.Flags().Changed(BranchFlag.Long) {
+		t.Errorf("expected config values not to be marked as changed")
+	}
+
+	expectedSources := map[string]string{"branch": "repo", "message": "command line", "label": "user", "untracked": "default"}
+	if !reflect.DeepEqual(sources, expectedSources) {
+		t.Errorf("expected sources %v, got %v", expectedSources, sources)
+	}
+}
+
+func TestEnvLayer(t *testing.T) {
+	tests := []struct {
+		name          string
+		env           map[string]string
+		expectedLayer ConfigLayer
+		expectedError error
+	}{
+		{
+			name: "Values of every type",
+			env: map[string]string{
+				"GH_COMMIT_BRANCH": "main",
+				"GH_COMMIT_USE_PR": "true",
+				"GH_COMMIT_LABEL":  "automated, bot\ndocs\n",
+			},
+			expectedLayer: ConfigLayer{Source: "environment", Values: map[string][]string{
+				"branch": {"main"},
+				"use-pr": {"true"},
+				"label":  {"automated", "bot", "docs"},
+			}},
+		},
+		{
+			name:          "Empty variables are unset",
+			env:           map[string]string{"GH_COMMIT_BRANCH": "", "GH_COMMIT_LABEL": " "},
+			expectedLayer: ConfigLayer{Source: "environment", Values: map[string][]string{}},
+		},
+		{
+			name:          "Invalid bool",
+			env:           map[string]string{"GH_COMMIT_USE_PR": "yes please"},
+			expectedError: errors.New("GH_COMMIT_USE_PR must be true or false"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lookup := func(name string) (string, bool) {
+				value, ok := tt.env[name]
+				return value, ok
+			}
+			layer, err := EnvLayer([]Flag{BranchFlag, UsePrFlag, PrLabelFlag}, lookup)
+
+			if err != nil && tt.expectedError != nil {
+				if err.Error() != tt.expectedError.Error() {
+					t.Errorf("expected error %v, got %v", tt.expectedError, err)
+				}
+			} else if err != nil || tt.expectedError != nil {
+				t.Errorf("expected error %v, got %v", tt.expectedError, err)
+			}
+
+			if !reflect.DeepEqual(layer, tt.expectedLayer) {
+				t.Errorf("expected layer %+v, got %+v", tt.expectedLayer, layer)
+			}
+		})
+	}
+}
+
+func TestLoadConfigPrecedence(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("GH_CONFIG_DIR", dir)
+	if err := os.WriteFile(filepath.Join(dir, userConfigName), []byte("branch: from-config\ntitle: from-config\nhead-ref: from-config\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("GH_COMMIT_BRANCH", "from-env")
+	t.Setenv("GH_COMMIT_TITLE", "from-env")
+	originalExecutor := executor
+	defer func() { executor = originalExecutor }()
+	executor = &MockCommandExecutor{Complex: map[string]*CommandOutput{
+		"git rev-parse --show-toplevel": {Err: errors.New("not a git repository")},
+	}}
+
+	command := &cobra.Command{}
+	flags := []Flag{BranchFlag, PrTitleFlag, HeadRefFlag, MessageFlag, ProfileFlag}
+	registerFlags(command, flags)
+	if err := command.Flags().Parse([]string{"--title", "from-flag"}); err != nil {
+		t.Fatal(err)
+	}
+
+	sources, err := LoadConfig(command, flags)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, expected := range map[string]string{"branch": "from-env", "title": "from-flag", "head-ref": "from-config", "message": ""} {
+		if value, _ := command.Flags().GetString(name); value != expected {
+			t.Errorf("expected %s to be %q, got %q", name, expected, value)
+		}
+	}
+	expectedSources := map[string]string{
+		"branch":   "environment",
+		"title":    "command line",
+		"head-ref": filepath.Join(dir, userConfigName),
+		"message":  "default",
+		"profile":  "default",
+	}
+	if !reflect.DeepEqual(sources, expectedSources) {
+		t.Errorf("expected sources %v, got %v", expectedSources, sources)
+	}
+}
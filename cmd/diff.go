@@ -0,0 +1,302 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/fatih/color"
+	"strings"
+	"text/tabwriter"
+)
+
+// diffContext is the number of unchanged lines shown around each change.
+const diffContext = 3
+
+// maxDiffLines and maxDiffEdits bound the lines the diff algorithm compares and the edits
+// it looks for. Files beyond either are shown as replaced entirely. The algorithm keeps
+// O(edits²) state, a few MB at most, and takes O(lines × edits) time.
+const (
+	maxDiffLines = 10000
+	maxDiffEdits = 1000
+)
+
+type diffOp struct {
+	kind byte // ' ', '-' or '+'
+	line string
+}
+
+// isBinary uses the same heuristic as git: a NUL byte in the first 8000 bytes.
+func isBinary(data []byte) bool {
+	if len(data) > 8000 {
+		data = data[:8000]
+	}
+	return bytes.IndexByte(data, 0) >= 0
+}
+
+// splitLines keeps the line endings, so a missing newline at the end counts as a change.
+func splitLines(data []byte) []string {
+	lines := strings.SplitAfter(string(data), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// diffLines finds the shortest edit script between two lists of lines with Myers'
+// algorithm.
+func diffLines(a, b []string) []diffOp {
+	n, m := len(a), len(b)
+	if n+m > maxDiffLines {
+		return replaceLines(a, b)
+	}
+
+	limit := n + m
+	offset := limit + 1
+	v := make([]int, 2*limit+3)
+	// trace[d] holds the diagonals -d-1 to d+1 of v before step d, which is all that walking
+	// back through step d reads
+	var trace [][]int
+
+search:
+	for d := 0; d <= limit; d++ {
+		if d > maxDiffEdits {
+			return replaceLines(a, b)
+		}
+		trace = append(trace, append([]int(nil), v[offset-d-1:offset+d+2]...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				break search
+			}
+		}
+	}
+
+	// Walk back through the snapshots to recover the edits
+	var ops []diffOp
+	x, y := n, m
+	for d := len(trace) - 1; d >= 0; d-- {
+		v, offset := trace[d], d+1
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := v[offset+prevK]
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			ops = append(ops, diffOp{' ', a[x-1]})
+			x--
+			y--
+		}
+		if d > 0 {
+			if x == prevX {
+				ops = append(ops, diffOp{'+', b[y-1]})
+				y--
+			} else {
+				ops = append(ops, diffOp{'-', a[x-1]})
+				x--
+			}
+		}
+	}
+
+	for i, j := 0, len(ops)-1; i < j; i, j = i+1, j-1 {
+		ops[i], ops[j] = ops[j], ops[i]
+	}
+	return ops
+}
+
+// replaceLines is the edit script that removes every line of a and adds every line of b.
+func replaceLines(a, b []string) []diffOp {
+	ops := make([]diffOp, 0, len(a)+len(b))
+	for _, line := range a {
+		ops = append(ops, diffOp{'-', line})
+	}
+	for _, line := range b {
+		ops = append(ops, diffOp{'+', line})
+	}
+	return ops
+}
+
+// UnifiedDiff renders the hunks of a unified diff between two contents, without the file
+// header, and counts the added and removed lines.
+func UnifiedDiff(oldContent, newContent []byte) (string, int, int) {
+	ops := diffLines(splitLines(oldContent), splitLines(newContent))
+
+	var changes []int
+	added, removed := 0, 0
+	for i, op := range ops {
+		switch op.kind {
+		case '+':
+			added++
+			changes = append(changes, i)
+		case '-':
+			removed++
+			changes = append(changes, i)
+		}
+	}
+
+	builder := &strings.Builder{}
+	for start := 0; start < len(changes); {
+		// Changes separated by at most twice the context share a hunk
+		end := start
+		for end+1 < len(changes) && changes[end+1]-changes[end] <= 2*diffContext+1 {
+			end++
+		}
+		from := max(changes[start]-diffContext, 0)
+		to := min(changes[end]+diffContext, len(ops)-1)
+
+		oldLine, newLine := 1, 1
+		for _, op := range ops[:from] {
+			if op.kind != '+' {
+				oldLine++
+			}
+			if op.kind != '-' {
+				newLine++
+			}
+		}
+
+		oldCount, newCount := 0, 0
+		for _, op := range ops[from : to+1] {
+			if op.kind != '+' {
+				oldCount++
+			}
+			if op.kind != '-' {
+				newCount++
+			}
+		}
+		_, _ = fmt.Fprintf(builder, "@@ -%s +%s @@\n", hunkRange(oldLine, oldCount), hunkRange(newLine, newCount))
+
+		for _, op := range ops[from : to+1] {
+			builder.WriteByte(op.kind)
+			builder.WriteString(op.line)
+			if !strings.HasSuffix(op.line, "\n") {
+				builder.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+		start = end + 1
+	}
+	return builder.String(), added, removed
+}
+
+// hunkRange formats one side of a hunk header. Empty ranges point at the line before.
+func hunkRange(start, count int) string {
+	if count == 0 {
+		start--
+	}
+	if count == 1 {
+		return fmt.Sprint(start)
+	}
+	return fmt.Sprintf("%d,%d", start, count)
+}
+
+// PrintDiffs shows a colored unified diff of every planned change against the tree it was
+// planned against, whose blobs are read with getBlob, followed by the added and removed
+// line counts per file and in total.
+func PrintDiffs(planned []PlannedChange, getBlob func(string) ([]byte, error)) error {
+	bold := color.New(color.Bold)
+	type fileStat struct {
+		path           string
+		added, removed int
+		binary         bool
+	}
+	var stats []fileStat
+
+	for _, plan := range planned {
+		if plan.Status == "unchanged" {
+			continue
+		}
+
+		var oldContent, newContent []byte
+		var err error
+		if plan.RemoteSha != "" {
+			oldContent, err = getBlob(plan.RemoteSha)
+			if err != nil {
+				return err
+			}
+		}
+		if !plan.Deleted {
+			newContent, err = plan.Load()
+			if err != nil {
+				return err
+			}
+		}
+
+		oldName, newName := "a/"+plan.Path, "b/"+plan.Path
+		fmt.Fprintln(out, bold.Sprintf("diff --git %s %s", oldName, newName))
+		switch {
+		case plan.RemoteSha == "":
+			fmt.Fprintln(out, bold.Sprintf("new file mode %s", plan.Mode))
+			oldName = "/dev/null"
+		case plan.Deleted:
+			fmt.Fprintln(out, bold.Sprintf("deleted file mode %s", plan.RemoteMode))
+			newName = "/dev/null"
+		case plan.RemoteMode != plan.Mode:
+			fmt.Fprintln(out, bold.Sprintf("old mode %s", plan.RemoteMode))
+			fmt.Fprintln(out, bold.Sprintf("new mode %s", plan.Mode))
+		}
+
+		stat := fileStat{path: plan.Path}
+		if isBinary(oldContent) || isBinary(newContent) {
+			stat.binary = true
+			fmt.Fprintf(out, "Binary files %s and %s differ\n", oldName, newName)
+			stats = append(stats, stat)
+			continue
+		}
+
+		var diff string
+		diff, stat.added, stat.removed = UnifiedDiff(oldContent, newContent)
+		stats = append(stats, stat)
+		if diff == "" {
+			continue
+		}
+		fmt.Fprintln(out, bold.Sprintf("--- %s", oldName))
+		fmt.Fprintln(out, bold.Sprintf("+++ %s", newName))
+		for _, line := range strings.SplitAfter(strings.TrimSuffix(diff, "\n"), "\n") {
+			line = strings.TrimSuffix(line, "\n")
+			switch {
+			case strings.HasPrefix(line, "@@"):
+				line = color.New(color.FgCyan).Sprint(line)
+			case strings.HasPrefix(line, "+"):
+				line = color.New(color.FgGreen).Sprint(line)
+			case strings.HasPrefix(line, "-"):
+				line = color.New(color.FgRed).Sprint(line)
+			}
+			fmt.Fprintln(out, line)
+		}
+	}
+
+	if len(stats) == 0 {
+		return nil
+	}
+
+	totalAdded, totalRemoved := 0, 0
+	fmt.Fprintf(out, "\n%s\n", color.New(color.FgCyan, color.Bold).Sprint("📊 Changed lines:"))
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	for _, stat := range stats {
+		counts := "binary"
+		if !stat.binary {
+			counts = color.New(color.FgGreen).Sprintf("+%d", stat.added) + " " + color.New(color.FgRed).Sprintf("-%d", stat.removed)
+			totalAdded += stat.added
+			totalRemoved += stat.removed
+		}
+		_, _ = fmt.Fprintf(w, "   %s\t%s\n", stat.path, counts)
+	}
+	_ = w.Flush()
+	fmt.Fprintf(out, "   %d file(s) changed, %s, %s\n", len(stats),
+		color.New(color.FgGreen).Sprintf("%d insertion(s)(+)", totalAdded),
+		color.New(color.FgRed).Sprintf("%d deletion(s)(-)", totalRemoved))
+	return nil
+}
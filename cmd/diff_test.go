@@ -0,0 +1,184 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/fatih/color"
+	"strings"
+	"testing"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	tests := []struct {
+		name            string
+		old             string
+		new             string
+		expectedDiff    string
+		expectedAdded   int
+		expectedRemoved int
+	}{
+		{
+			name:         "Identical",
+			old:          "a\nb\n",
+			new:          "a\nb\n",
+			expectedDiff: "",
+		},
+		{
+			name:            "Changed line with context",
+			old:             "1\n2\n3\n4\n5\n6\n7\n8\n9\n",
+			new:             "1\n2\n3\n4\nfive\n6\n7\n8\n9\n",
+			expectedDiff:    "@@ -2,7 +2,7 @@\n 2\n 3\n 4\n-5\n+five\n 6\n 7\n 8\n",
+			expectedAdded:   1,
+			expectedRemoved: 1,
+		},
+		{
+			name:            "Close changes share a hunk",
+			old:             "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n",
+			new:             "1\ntwo\n3\n4\n5\n6\n7\n8\nnine\n10\n",
+			expectedDiff:    "@@ -1,10 +1,10 @@\n 1\n-2\n+two\n 3\n 4\n 5\n 6\n 7\n 8\n-9\n+nine\n 10\n",
+			expectedAdded:   2,
+			expectedRemoved: 2,
+		},
+		{
+			name:            "Separate hunks",
+			old:             "a\n1\n2\n3\n4\n5\n6\n7\nb\n",
+			new:             "A\n1\n2\n3\n4\n5\n6\n7\nB\n",
+			expectedDiff:    "@@ -1,4 +1,4 @@\n-a\n+A\n 1\n 2\n 3\n@@ -6,4 +6,4 @@\n 5\n 6\n 7\n-b\n+B\n",
+			expectedAdded:   2,
+			expectedRemoved: 2,
+		},
+		{
+			name:          "New file",
+			old:           "",
+			new:           "a\nb\n",
+			expectedDiff:  "@@ -0,0 +1,2 @@\n+a\n+b\n",
+			expectedAdded: 2,
+		},
+		{
+			name:            "Deleted file",
+			old:             "a\n",
+			new:             "",
+			expectedDiff:    "@@ -1 +0,0 @@\n-a\n",
+			expectedRemoved: 1,
+		},
+		{
+			name:            "Missing newline at the end",
+			old:             "a\nb",
+			new:             "a\nb\n",
+			expectedDiff:    "@@ -1,2 +1,2 @@\n a\n-b\n\\ No newline at end of file\n+b\n",
+			expectedAdded:   1,
+			expectedRemoved: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diff, added, removed := UnifiedDiff([]byte(tt.old), []byte(tt.new))
+			if diff != tt.expectedDiff {
+				t.Errorf("expected diff\n%s\ngot\n%s", tt.expectedDiff, diff)
+			}
+			if added != tt.expectedAdded || removed != tt.expectedRemoved {
+				t.Errorf("expected +%d -%d, got +%d -%d", tt.expectedAdded, tt.expectedRemoved, added, removed)
+			}
+		})
+	}
+}
+
+func TestDiffLinesIsMinimal(t *testing.T) {
+	a := strings.Split("a b c a b b a", " ")
+	b := strings.Split("c b a b a c", " ")
+
+	edits := 0
+	var rebuilt []string
+	for _, op := range diffLines(a, b) {
+		if op.kind != ' ' {
+			edits++
+		}
+		if op.kind != '-' {
+			rebuilt = append(rebuilt, op.line)
+		}
+	}
+	if edits != 5 {
+		t.Errorf("expected 5 edits, got %d", edits)
+	}
+	if !equal(rebuilt, b) {
+		t.Errorf("expected the edits to produce %q, got %q", b, rebuilt)
+	}
+}
+
+func TestIsBinary(t *testing.T) {
+	if isBinary([]byte("plain text\n")) {
+		t.Errorf("expected text not to be binary")
+	}
+	if !isBinary([]byte{0x89, 'P', 'N', 'G', 0x00}) {
+		t.Errorf("expected content with NUL bytes to be binary")
+	}
+}
+
+func TestPrintDiffs(t *testing.T) {
+	originalOut, originalNoColor := out, color.NoColor
+	defer func() { out, color.NoColor = originalOut, originalNoColor }()
+	buffer := &bytes.Buffer{}
+	out, color.NoColor = buffer, true
+
+	planned := []PlannedChange{
+		{FileChange: FileChange{Path: "new.txt", Content: []byte("one\ntwo\n"), Mode: "100644"}, Status: "added"},
+		{FileChange: FileChange{Path: "image.png", Content: []byte{0x89, 'P', 'N', 'G', 0x00}, Mode: "100644"}, Status: "added"},
+		{FileChange: FileChange{Path: "same.txt", Content: []byte("same\n"), Mode: "100644"}, Status: "unchanged"},
+	}
+	if err := PrintDiffs(planned, func(blobSha string) ([]byte, error) { return GetBlob(context.Background(), blobSha) }); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	output := buffer.String()
+	for _, expected := range []string{
+		"diff --git a/new.txt b/new.txt\nnew file mode 100644\n--- /dev/null\n+++ b/new.txt\n@@ -0,0 +1,2 @@\n+one\n+two\n",
+		"Binary files /dev/null and b/image.png differ",
+		"2 file(s) changed, 2 insertion(s)(+), 0 deletion(s)(-)",
+	} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("expected the output to contain %q, got:\n%s", expected, output)
+		}
+	}
+	if strings.Contains(output, "same.txt") {
+		t.Errorf("expected unchanged files to be skipped, got:\n%s", output)
+	}
+}
+
+func TestDiffLinesBounds(t *testing.T) {
+	lines := func(prefix string, count int) []string {
+		out := make([]string, count)
+		for i := range out {
+			out[i] = fmt.Sprintf("%s %d\n", prefix, i)
+		}
+		return out
+	}
+	count := func(ops []diffOp) (kept, changed int) {
+		for _, op := range ops {
+			if op.kind == ' ' {
+				kept++
+			} else {
+				changed++
+			}
+		}
+		return kept, changed
+	}
+
+	// A few edits in a file at the size limit are still found
+	a := lines("line", maxDiffLines/2)
+	b := append(append([]string(nil), a...), "appended\n")
+	b[10] = "changed\n"
+	b = b[1:]
+	if kept, changed := count(diffLines(a, b)); kept != len(a)-2 || changed != 4 {
+		t.Errorf("expected 4 edits, got %d kept and %d changed lines", kept, changed)
+	}
+
+	// Too many edits are shown as a replacement
+	a, b = lines("old", maxDiffEdits), lines("new", maxDiffEdits)
+	a = append(a, "shared\n")
+	b = append([]string{"shared\n"}, b...)
+	if kept, changed := count(diffLines(a, b)); kept != 0 || changed != len(a)+len(b) {
+		t.Errorf("expected a replacement, got %d kept and %d changed lines", kept, changed)
+	}
+}
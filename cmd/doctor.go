@@ -0,0 +1,300 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/cli/go-gh/pkg/api"
+	"github.com/cli/go-gh/pkg/auth"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"net/http"
+	"os"
+	"strings"
+	"text/tabwriter"
+)
+
+var doctorFlags = []Flag{
+	RepoFlag,
+	RemoteFlag,
+	TimeoutFlag,
+	VerboseFlag,
+	ProfileFlag,
+	PrintConfig,
+}
+
+// workflowsDir holds the workflows of GitHub Actions. Tokens need a right of their own to
+// change anything in it.
+const workflowsDir = ".github/workflows/"
+
+// tokenTypes tells tokens apart by their prefix.
+var tokenTypes = []struct {
+	Prefix string
+	Type   string
+}{
+	{"ghp_", "classic personal access token"},
+	{"github_pat_", "fine-grained personal access token"},
+	{"gho_", "OAuth token"},
+	{"ghu_", "GitHub App user token"},
+	{"ghs_", "GitHub App installation token"},
+}
+
+// tokenSources names the places gh finds a token in, other than environment variables.
+var tokenSources = map[string]string{
+	"oauth_token": "the gh config",
+	"gh":          "the gh keyring",
+}
+
+// TokenInfo describes the token a run authenticates with.
+type TokenInfo struct {
+	Type   string
+	Source string
+	// Scopes are only known for classic personal access tokens and OAuth tokens. Fine-grained
+	// and GitHub App tokens have permissions instead, which the API does not list.
+	Scopes      []string
+	ScopesKnown bool
+}
+
+// tokenType tells what kind of token it is from its prefix.
+func tokenType(token string) string {
+	for _, t := range tokenTypes {
+		if strings.HasPrefix(token, t.Prefix) {
+			return t.Type
+		}
+	}
+	return "token of an unknown type"
+}
+
+// parseScopes splits the X-OAuth-Scopes header, which is missing for tokens without scopes.
+func parseScopes(header []string) ([]string, bool) {
+	if len(header) == 0 {
+		return nil, false
+	}
+	scopes := []string{}
+	for _, scope := range strings.Split(strings.Join(header, ","), ",") {
+		if scope = strings.TrimSpace(scope); scope != "" {
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes, true
+}
+
+// InspectToken finds out which token the client uses, and its scopes.
+func InspectToken(ctx context.Context) (*TokenInfo, error) {
+	token, source := auth.TokenForHost(repo.Host())
+	info := &TokenInfo{Type: tokenType(token), Source: source}
+	if described, ok := tokenSources[source]; ok {
+		info.Source = described
+	}
+
+	// Every response to a token with scopes lists them
+	response, err := client.RequestWithContext(ctx, http.MethodGet, fmt.Sprintf("repos/%s/%s", repo.Owner(), repo.Name()), nil)
+	if err != nil {
+		if httpErr, ok := err.(api.HTTPError); ok && httpErr.StatusCode == http.StatusUnauthorized {
+			return nil, fmt.Errorf("the token for %s from %s was rejected, run `gh auth login` or set GH_TOKEN", repo.Host(), info.Source)
+		}
+		return nil, errors.New(fmt.Sprint("error inspecting the token: ", err))
+	}
+	defer response.Body.Close()
+
+	info.Scopes, info.ScopesKnown = parseScopes(response.Header.Values("X-OAuth-Scopes"))
+	return info, nil
+}
+
+// HasScope reports whether the token was granted a scope, directly or through a broader one.
+func (t *TokenInfo) HasScope(scope string) bool {
+	for _, granted := range t.Scopes {
+		if granted == scope || (granted == "repo" && scope == "public_repo") {
+			return true
+		}
+	}
+	return false
+}
+
+// touchesWorkflows reports whether any of the changes adds, changes or deletes a workflow.
+func touchesWorkflows(changes []FileChange) bool {
+	for _, change := range changes {
+		if strings.HasPrefix(change.Path, workflowsDir) {
+			return true
+		}
+	}
+	return false
+}
+
+// TokenProblems lists the rights the token lacks for the commit. Rights that cannot be
+// told from the outside are warned about instead.
+func (rn *RunSettings) TokenProblems(token *TokenInfo, changes []FileChange) []string {
+	var problems []string
+	target := fmt.Sprintf("%s/%s", repo.Owner(), repo.Name())
+
+	if token.ScopesKnown {
+		scope := "repo"
+		if !rn.RepoSettings.Private {
+			scope = "public_repo"
+		}
+		if !token.HasScope(scope) {
+			problems = append(problems, fmt.Sprintf("the token lacks the %s scope needed to write to %s", scope, target))
+		}
+	}
+
+	// Pushing to a fork needs no rights on the upstream
+	if !rn.Fork {
+		if perms := rn.RepoSettings.Permissions; perms == nil {
+			warn("Could not determine whether the token may push to the repository")
+		} else if !perms.Push {
+			problems = append(problems, fmt.Sprintf("the token cannot push to %s", target))
+		}
+	}
+
+	if touchesWorkflows(changes) {
+		switch {
+		case token.ScopesKnown && !token.HasScope("workflow"):
+			problems = append(problems, fmt.Sprintf("the token lacks the workflow scope needed to change %s, run `gh auth refresh -s workflow`", workflowsDir))
+		case !token.ScopesKnown:
+			warn(fmt.Sprintf("The commit changes %s, which a %s needs the workflows permission for. The GITHUB_TOKEN of Actions never has it", workflowsDir, token.Type))
+		}
+	}
+	return problems
+}
+
+// Preflight refuses to write anything the token lacks the rights for, so that a run does
+// not fail halfway with blobs and trees already created.
+func (rn *RunSettings) Preflight(ctx context.Context, changes []FileChange) error {
+	token, err := InspectToken(ctx)
+	if err != nil {
+		return err
+	}
+	problems := rn.TokenProblems(token, changes)
+	if len(problems) > 0 {
+		return fmt.Errorf("the token cannot make this commit: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// describeScopes lists the scopes of a token for people to read.
+func describeScopes(token *TokenInfo) string {
+	switch {
+	case !token.ScopesKnown:
+		return "none, the token has permissions instead"
+	case len(token.Scopes) == 0:
+		return "none"
+	}
+	return strings.Join(token.Scopes, ", ")
+}
+
+// describePermissions lists the rights of the token on the repository for people to read.
+func describePermissions(perms *RepoPermissions) string {
+	switch {
+	case perms == nil:
+		return "unknown"
+	case perms.Admin:
+		return "admin, push"
+	case perms.Push:
+		return "push"
+	}
+	return "read only"
+}
+
+// Doctor reports the token, its scopes and its rights on the repository, and lists
+// whatever would keep a commit from going through.
+func Doctor(ctx context.Context, repoSettings *RepoSettings) ([]string, error) {
+	token, err := InspectToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	heading := color.New(color.FgCyan, color.Bold).SprintFunc()
+	fmt.Fprintf(out, "%s\n\n", heading(fmt.Sprintf("🩺 Checking the token for %s/%s", repo.Owner(), repo.Name())))
+
+	workflows := color.New(color.FgGreen).Sprint("may be changed")
+	switch {
+	case !token.ScopesKnown:
+		workflows = color.New(color.FgYellow).Sprint("unknown, needs the workflows permission")
+	case !token.HasScope("workflow"):
+		workflows = color.New(color.FgRed).Sprint("may not be changed, needs the workflow scope")
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintf(w, "   Token\t%s, from %s\n", token.Type, token.Source)
+	_, _ = fmt.Fprintf(w, "   Scopes\t%s\n", describeScopes(token))
+	_, _ = fmt.Fprintf(w, "   Permissions\t%s\n", describePermissions(repoSettings.Permissions))
+	_, _ = fmt.Fprintf(w, "   Workflows\t%s\n", workflows)
+	_ = w.Flush()
+
+	rn := &RunSettings{RepoSettings: repoSettings}
+	problems := rn.TokenProblems(token, nil)
+	if len(problems) > 0 {
+		fmt.Fprintf(out, "\n%s\n", color.New(color.FgRed, color.Bold).Sprint("❌ Problems:"))
+		for _, problem := range problems {
+			fmt.Fprintf(out, "   - %s\n", problem)
+		}
+		if repoSettings.Permissions != nil && !repoSettings.Permissions.Push {
+			fmt.Fprintf(out, "   Use --use-pr --fork to commit to a fork instead\n")
+		}
+	} else {
+		fmt.Fprintf(out, "\n%s The token can commit to %s/%s\n", color.New(color.FgGreen).Sprint("✅"), repo.Owner(), repo.Name())
+	}
+	return problems, nil
+}
+
+const doctorHelpText = `gh-commit doctor: Check that the token can commit to the repository.
+
+Reports the type and source of the token, its scopes, its rights on the
+repository, and whether it may change workflows under .github/workflows,
+without writing anything. Commits run the same checks before the first write.
+
+Synopsis:
+  gh commit doctor [flags]
+
+Flags:
+`
+
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Check that the token can commit to the repository",
+	Args:  cobra.NoArgs,
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		sources, err := LoadConfig(cmd, doctorFlags)
+		if err != nil {
+			return err
+		}
+		if printConfig, _ := cmd.Flags().GetBool(PrintConfig.Long); printConfig {
+			PrintResolvedConfig(cmd, doctorFlags, sources)
+			os.Exit(0)
+		}
+
+		repoName, _ := cmd.Flags().GetString(RepoFlag.Long)
+		remoteName, _ := cmd.Flags().GetString(RemoteFlag.Long)
+		if repoName != "" && remoteName != "" {
+			return errors.New("`repo` and `remote` cannot be used together")
+		}
+		return nil
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx, finishRun, err := StartRun(cmd)
+		if err != nil {
+			return err
+		}
+		defer finishRun()
+
+		repoName, _ := cmd.Flags().GetString(RepoFlag.Long)
+		remoteName, _ := cmd.Flags().GetString(RemoteFlag.Long)
+		target, err := ResolveTargetRepository(repoName, remoteName)
+		if err != nil {
+			return err
+		}
+		repoSettings, err := ValidateGitRemote(ctx, target)
+		if err != nil {
+			return err
+		}
+
+		problems, err := Doctor(ctx, repoSettings)
+		if err != nil {
+			return err
+		}
+		if len(problems) > 0 {
+			return fmt.Errorf("the token cannot commit to %s/%s", repo.Owner(), repo.Name())
+		}
+		return nil
+	},
+}
@@ -0,0 +1,117 @@
+package cmd
+
+import (
+	"github.com/cli/go-gh/pkg/repository"
+	"testing"
+)
+
+func TestTokenType(t *testing.T) {
+	tests := []struct {
+		token    string
+		expected string
+	}{
+		{"ghp_abc", "classic personal access token"},
+		{"github_pat_abc", "fine-grained personal access token"},
+		{"gho_abc", "OAuth token"},
+		{"ghu_abc", "GitHub App user token"},
+		{"ghs_abc", "GitHub App installation token"},
+		{"0123456789abcdef", "token of an unknown type"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.token, func(t *testing.T) {
+			if actual := tokenType(tt.token); actual != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, actual)
+			}
+		})
+	}
+}
+
+func TestParseScopes(t *testing.T) {
+	tests := []struct {
+		name           string
+		header         []string
+		expectedScopes []string
+		expectedKnown  bool
+	}{
+		{name: "No header", header: nil},
+		{name: "No scopes", header: []string{""}, expectedKnown: true},
+		{name: "Scopes", header: []string{"repo, workflow,read:org"}, expectedScopes: []string{"repo", "workflow", "read:org"}, expectedKnown: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scopes, known := parseScopes(tt.header)
+			if !equal(scopes, tt.expectedScopes) || known != tt.expectedKnown {
+				t.Errorf("expected %v (known: %v), got %v (known: %v)", tt.expectedScopes, tt.expectedKnown, scopes, known)
+			}
+		})
+	}
+}
+
+func TestTokenProblems(t *testing.T) {
+	target, err := repository.Parse("kassett/gh-commit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	originalRepo := repo
+	defer func() { repo = originalRepo }()
+	repo = target
+
+	workflow := []FileChange{{Path: ".github/workflows/ci.yml"}}
+	readme := []FileChange{{Path: "README.md"}}
+	classic := func(scopes ...string) *TokenInfo {
+		return &TokenInfo{Type: "classic personal access token", Scopes: scopes, ScopesKnown: true}
+	}
+	app := &TokenInfo{Type: "GitHub App installation token"}
+
+	tests := []struct {
+		name             string
+		token            *TokenInfo
+		changes          []FileChange
+		private          bool
+		push             bool
+		fork             bool
+		expectedProblems []string
+	}{
+		{name: "Classic token with the repo scope", token: classic("repo"), changes: readme, private: true, push: true},
+		{name: "Public repository", token: classic("public_repo"), changes: readme, push: true},
+		{
+			name:             "Private repository without the repo scope",
+			token:            classic("public_repo"),
+			changes:          readme,
+			private:          true,
+			push:             true,
+			expectedProblems: []string{"the token lacks the repo scope needed to write to kassett/gh-commit"},
+		},
+		{
+			name:             "No push permission",
+			token:            app,
+			changes:          readme,
+			expectedProblems: []string{"the token cannot push to kassett/gh-commit"},
+		},
+		{name: "No push permission on the upstream of a fork", token: app, changes: readme, fork: true},
+		{
+			name:             "Workflow without the workflow scope",
+			token:            classic("repo"),
+			changes:          append(readme, workflow...),
+			push:             true,
+			expectedProblems: []string{"the token lacks the workflow scope needed to change .github/workflows/, run `gh auth refresh -s workflow`"},
+		},
+		{name: "Workflow with the workflow scope", token: classic("repo", "workflow"), changes: workflow, push: true},
+		{name: "Workflow with a token without scopes", token: app, changes: workflow, push: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rn := &RunSettings{
+				RepoSettings: &RepoSettings{Private: tt.private, Permissions: &RepoPermissions{Push: tt.push}},
+				Fork:         tt.fork,
+			}
+			problems := rn.TokenProblems(tt.token, tt.changes)
+			if !equal(problems, tt.expectedProblems) {
+				t.Errorf("expected problems %v, got %v", tt.expectedProblems, problems)
+			}
+		})
+	}
+}
@@ -0,0 +1,244 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"github.com/fatih/color"
+	"strings"
+	"text/tabwriter"
+)
+
+// PlannedChange is a file of the commit compared with the remote tree.
+type PlannedChange struct {
+	FileChange
+	Status     string
+	LocalSha   string
+	RemoteSha  string
+	RemoteMode string
+}
+
+// PlanChanges compares the changes with the remote tree, without uploading anything.
+func PlanChanges(changes []FileChange, lookup func(string) (*TreeEntry, error)) ([]PlannedChange, error) {
+	planned := make([]PlannedChange, 0, len(changes))
+	for _, change := range changes {
+		content, err := change.Load()
+		if err != nil {
+			return nil, err
+		}
+
+		remote, err := lookup(change.Path)
+		if err != nil {
+			return nil, err
+		}
+		if remote != nil && remote.Type != "blob" {
+			remote = nil
+		}
+
+		plan := PlannedChange{FileChange: change}
+		if remote != nil {
+			plan.RemoteSha = remote.Sha
+			plan.RemoteMode = remote.Mode
+		}
+
+		if content == nil {
+			plan.Deleted = true
+			plan.Status = "deleted"
+			if remote == nil {
+				// Deleting what does not exist leaves the tree as it is
+				plan.Status = "unchanged"
+			}
+			planned = append(planned, plan)
+			continue
+		}
+
+		if plan.Mode == "" {
+			plan.Mode = "100644"
+		}
+		plan.LocalSha = HashBlob(content)
+		switch {
+		case remote == nil:
+			plan.Status = "added"
+		case remote.Sha != plan.LocalSha:
+			plan.Status = "modified"
+		case remote.Mode != plan.Mode:
+			plan.Status = "mode changed"
+		default:
+			plan.Status = "unchanged"
+		}
+		planned = append(planned, plan)
+	}
+	return planned, nil
+}
+
+// ExecuteDryRun checks everything a commit needs without writing anything: the refs,
+// permissions, rulesets and labels, and which files actually differ from the remote tree.
+// Blocking problems are recorded on the result rather than returned.
+func (rn *RunSettings) ExecuteDryRun(ctx context.Context) error {
+	var problems []string
+	heading := color.New(color.FgCyan, color.Bold).SprintFunc()
+	fmt.Fprintf(out, "%s\n\n", heading(fmt.Sprintf("🔎 Dry run against %s/%s", repo.Owner(), repo.Name())))
+
+	baseBranch := rn.baseBranch()
+	baseSha, err := rn.ResolveBase(ctx)
+	if err != nil {
+		return err
+	}
+	rn.Result.BaseSha = baseSha
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	existingSha, err := GetBranchSha(ctx, baseBranch)
+	if err != nil {
+		return err
+	}
+	if existingSha != "" {
+		_, _ = fmt.Fprintf(w, "   Base\t%s @ %s\n", baseBranch, shortSha(baseSha))
+	} else if rn.Fork {
+		problems = append(problems, fmt.Sprintf("the base branch %s does not exist on %s/%s", baseBranch, repo.Owner(), repo.Name()))
+	} else {
+		_, _ = fmt.Fprintf(w, "   Base\t%s, created from %s @ %s\n", baseBranch, rn.RepoSettings.DefaultBranch, shortSha(baseSha))
+	}
+	_ = w.Flush()
+
+	// Rulesets only get in the way of the branch that is committed to, which is the
+	// head ref in PR mode. The fork is not created during a dry run, so its rules are unknown.
+	var guards []BranchGuard
+	if !rn.Fork {
+		guards, err = rn.BranchGuards(ctx)
+		if err != nil {
+			return err
+		}
+		if rn.switchToPr(guards) {
+			guards, err = rn.BranchGuards(ctx)
+			if err != nil {
+				return err
+			}
+		}
+		for _, guard := range guards {
+			problems = append(problems, guard.Problem)
+		}
+	}
+
+	w = tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	if rn.Fork {
+		// The fork is not created during a dry run, so its refs cannot be checked
+		_, _ = fmt.Fprintf(w, "   Head\t%s, on a fork of %s/%s, for a PR into %s\n", rn.PrSettings.HeadRef, repo.Owner(), repo.Name(), baseBranch)
+	} else if rn.PrSettings != nil {
+		headSha, err := GetBranchSha(ctx, rn.PrSettings.HeadRef)
+		if err != nil {
+			return err
+		}
+		if headSha != "" {
+			problems = append(problems, fmt.Sprintf("the head ref %s already exists", rn.PrSettings.HeadRef))
+		}
+		_, _ = fmt.Fprintf(w, "   Head\t%s, new branch for a PR into %s\n", rn.PrSettings.HeadRef, baseBranch)
+	}
+	_ = w.Flush()
+
+	if rn.PrSettings != nil && len(rn.PrSettings.Labels) > 0 {
+		missing, err := MissingLabels(ctx, rn.PrSettings.Labels)
+		if err != nil {
+			return err
+		}
+		for _, label := range missing {
+			problems = append(problems, fmt.Sprintf("the label %s does not exist", label))
+		}
+	}
+
+	baseTreeSha, err := GetTreeTip(ctx, baseSha)
+	if err != nil {
+		return err
+	}
+
+	if rn.Mirror != nil {
+		remoteTree, err := GetRemoteTree(ctx, baseTreeSha, true)
+		if err != nil {
+			return err
+		}
+		rn.FileSelection, err = rn.Mirror.Changes(remoteTree)
+		if err != nil {
+			return err
+		}
+	}
+
+	token, err := InspectToken(ctx)
+	if err != nil {
+		return err
+	}
+	w = tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintf(w, "   Token\t%s, from %s, scopes: %s\n", token.Type, token.Source, describeScopes(token))
+	_ = w.Flush()
+	problems = append(problems, rn.TokenProblems(token, rn.FileSelection)...)
+
+	patchTree := NewPatchTree(
+		baseTreeSha,
+		func(treeSha string) ([]TreeEntry, error) { return GetRemoteTree(ctx, treeSha, false) },
+		func(blobSha string) ([]byte, error) { return GetBlob(ctx, blobSha) },
+	)
+	planned, err := PlanChanges(rn.FileSelection, patchTree.Entry)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "\n%s\n", heading("📦 Planned tree change:"))
+	changed := printPlan(planned)
+	if changed == 0 && !rn.AllowEmpty {
+		fmt.Fprintf(out, "%s Nothing to commit, the tree of %s would not change\n",
+			color.New(color.FgGreen).Sprint("✨"), baseBranch)
+		rn.Result.NoChanges = true
+	}
+
+	if rn.Diff && changed > 0 {
+		fmt.Fprintln(out)
+		if err = PrintDiffs(planned, func(blobSha string) ([]byte, error) { return GetBlob(ctx, blobSha) }); err != nil {
+			return err
+		}
+	}
+
+	rn.Result.SetPlan(planned)
+	rn.Result.Problems = problems
+	if len(problems) > 0 {
+		fmt.Fprintf(out, "\n%s\n", color.New(color.FgRed, color.Bold).Sprint("❌ Blocking problems:"))
+		for _, problem := range problems {
+			fmt.Fprintf(out, "   - %s\n", problem)
+		}
+		if hint := guardHint(guards); hint != "" {
+			fmt.Fprintf(out, "   %s\n", strings.TrimPrefix(hint, ". "))
+		}
+	} else {
+		fmt.Fprintf(out, "\n%s No blocking problems found\n", color.New(color.FgGreen).Sprint("✅"))
+	}
+	return nil
+}
+
+// printPlan lists the planned changes with their status, and returns how many of them
+// change the tree.
+func printPlan(planned []PlannedChange) int {
+	counts := make(map[string]int)
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	for i, plan := range planned {
+		counts[plan.Status]++
+		index := color.New(color.FgYellow).Sprintf("%d.", i+1)
+		status := plan.Status
+		switch plan.Status {
+		case "added":
+			status = color.New(color.FgGreen).Sprint(status)
+		case "deleted":
+			status = color.New(color.FgRed).Sprint(status)
+		case "unchanged":
+			status = color.New(color.FgHiBlack).Sprint(status)
+		default:
+			status = color.New(color.FgYellow).Sprint(status)
+		}
+		_, _ = fmt.Fprintf(w, "   %s\t%s\t%s\t%s\n", index, status, plan.Describe(), shortSha(plan.LocalSha))
+	}
+	_ = w.Flush()
+
+	fmt.Fprintf(out, "   %d added, %d modified, %d deleted, %d unchanged\n",
+		counts["added"], counts["modified"]+counts["mode changed"], counts["deleted"], counts["unchanged"])
+	return len(planned) - counts["unchanged"]
+}
+
+// formatProblems turns the problems of a dry run into the error the run fails with.
+func formatProblems(problems []string) error {
+	return fmt.Errorf("the dry run found %d blocking problem(s): %s", len(problems), strings.Join(problems, "; "))
+}
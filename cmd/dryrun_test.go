@@ -0,0 +1,58 @@
+package cmd
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestPlanChanges(t *testing.T) {
+	remote := map[string]*TreeEntry{
+		"same.txt":    {Path: "same.txt", Mode: "100644", Type: "blob", Sha: HashBlob([]byte("same\n"))},
+		"changed.txt": {Path: "changed.txt", Mode: "100644", Type: "blob", Sha: HashBlob([]byte("old\n"))},
+		"run.sh":      {Path: "run.sh", Mode: "100644", Type: "blob", Sha: HashBlob([]byte("#!/bin/sh\n"))},
+		"old.txt":     {Path: "old.txt", Mode: "100644", Type: "blob", Sha: HashBlob([]byte("old\n"))},
+		"dir":         {Path: "dir", Mode: "040000", Type: "tree", Sha: "tree"},
+	}
+	lookup := func(p string) (*TreeEntry, error) {
+		return remote[p], nil
+	}
+
+	changes := []FileChange{
+		{Path: "same.txt", Content: []byte("same\n")},
+		{Path: "changed.txt", Content: []byte("new\n")},
+		{Path: "run.sh", Mode: "100755", Content: []byte("#!/bin/sh\n")},
+		{Path: "new.txt", Content: []byte("new\n")},
+		{Path: "old.txt", Deleted: true},
+		{Path: "never-existed.txt", Deleted: true},
+		{Path: "dir", Content: []byte("now a file\n")},
+	}
+
+	planned, err := PlanChanges(changes, lookup)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"unchanged", "modified", "mode changed", "added", "deleted", "unchanged", "added"}
+	if len(planned) != len(expected) {
+		t.Fatalf("expected %d planned changes, got %d", len(expected), len(planned))
+	}
+	for i, plan := range planned {
+		if plan.Status != expected[i] {
+			t.Errorf("expected %s to be %s, got %s", plan.Path, expected[i], plan.Status)
+		}
+	}
+	if planned[3].LocalSha != HashBlob([]byte("new\n")) || planned[3].Mode != "100644" {
+		t.Errorf("expected the local sha and default mode of new.txt, got %+v", planned[3])
+	}
+}
+
+func TestPlanChangesLookupError(t *testing.T) {
+	expectedError := errors.New("error getting tree description: 502")
+	_, err := PlanChanges(
+		[]FileChange{{Path: "a.txt", Content: []byte("a")}},
+		func(string) (*TreeEntry, error) { return nil, expectedError },
+	)
+	if err == nil || err.Error() != expectedError.Error() {
+		t.Errorf("expected error %v, got %v", expectedError, err)
+	}
+}
@@ -1,13 +1,14 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"github.com/cli/go-gh/pkg/api"
 	"github.com/cli/go-gh/pkg/repository"
 	"github.com/fatih/color"
 	"github.com/spf13/cobra"
 	"os"
-	"text/tabwriter"
+	"time"
 )
 
 // VERSION number: changed in CI
@@ -17,112 +18,383 @@ var rootPath string
 var repo repository.Repository
 var client api.RESTClient
 
+// upstream is only set when committing through a fork, in which case repo points
+// at the fork and upstream at the repository the PR is opened against.
+var upstream repository.Repository
+
 func Execute() {
-	cobra.CheckErr(rootCmd.Execute())
+	cmd, err := rootCmd.ExecuteC()
+	if err != nil {
+		annotateError(err)
+		if jsonOutput, _ := cmd.Flags().GetBool(JSONFlag.Long); jsonOutput {
+			WriteFailure(err)
+		}
+	}
+	cobra.CheckErr(err)
 }
 
 var executor CommandExecutor = &DefaultCommandExecutor{}
 
 func init() {
-	for _, flag := range allFlags {
+	registerFlags(rootCmd, allFlags)
+	rootCmd.Flags().BoolP("version", "V", false, "Print current version")
+	rootCmd.SetHelpTemplate(generateHelpText(rootHelpText, allFlags))
+
+	// Positional arguments are files, so keep the command namespace to a minimum
+	rootCmd.CompletionOptions.DisableDefaultCmd = true
+
+	registerFlags(applyCmd, applyFlags)
+	applyCmd.SetHelpTemplate(generateHelpText(applyHelpText, applyFlags))
+	rootCmd.AddCommand(applyCmd)
+
+	registerFlags(planCmd, planFlags)
+	planCmd.SetHelpTemplate(generateHelpText(planHelpText, planFlags))
+	rootCmd.AddCommand(planCmd)
+
+	registerFlags(doctorCmd, doctorFlags)
+	doctorCmd.SetHelpTemplate(generateHelpText(doctorHelpText, doctorFlags))
+	rootCmd.AddCommand(doctorCmd)
+
+	registerFlags(pruneCmd, pruneFlags)
+	pruneCmd.SetHelpTemplate(generateHelpText(pruneHelpText, pruneFlags))
+	rootCmd.AddCommand(pruneCmd)
+}
+
+func registerFlags(cmd *cobra.Command, flags []Flag) {
+	for _, flag := range flags {
 		switch flag.Type {
 		case "bool":
-			rootCmd.Flags().BoolP(flag.Long, flag.Short, flag.Default == "true", flag.Description)
+			cmd.Flags().BoolP(flag.Long, flag.Short, flag.Default == "true", flag.Description)
 		case "string":
-			rootCmd.Flags().StringP(flag.Long, flag.Short, flag.Default, flag.Description)
+			cmd.Flags().StringP(flag.Long, flag.Short, flag.Default, flag.Description)
 		case "stringSlice":
-			rootCmd.Flags().StringSliceP(flag.Long, flag.Short, []string{}, flag.Description)
+			cmd.Flags().StringSliceP(flag.Long, flag.Short, []string{}, flag.Description)
 		}
 	}
-
-	rootCmd.Flags().BoolP("version", "V", false, "Print current version")
-	rootCmd.SetHelpTemplate(generateHelpText())
 }
 
-func isGitHubAction() bool {
-	return os.Getenv("GITHUB_ACTIONS") == "true"
+// Commit makes the commit and, in PR mode, opens the PR. If that fails halfway, whatever
+// was already changed on the remote is rolled back.
+func (rn *RunSettings) Commit(ctx context.Context) error {
+	return rn.RollBack(ctx, rn.commit(ctx))
 }
 
-func exportGitHubOutput(key, value string) error {
-	outputPath := os.Getenv("GITHUB_OUTPUT")
-	if outputPath == "" {
-		return fmt.Errorf("GITHUB_OUTPUT not set")
+func (rn *RunSettings) commit(ctx context.Context) error {
+	if err := rn.GuardBranch(ctx); err != nil {
+		return err
 	}
 
-	f, err := os.OpenFile(outputPath, os.O_APPEND|os.O_WRONLY, 0644)
+	// Nothing is created until we know the commit changes something, so that a
+	// no-op run leaves no branches behind
+	start := time.Now()
+	baseSha, err := rn.ResolveBase(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to open GITHUB_OUTPUT file: %w", err)
+		return err
 	}
-	defer func(f *os.File) {
-		_ = f.Close()
-	}(f)
+	rn.Result.BaseSha = baseSha
 
-	_, err = fmt.Fprintf(f, "%s=%s\n", key, value)
-	return err
-}
+	// Commits reference trees. Trees have their own hashes. Get the hash
+	// of the tip of the tree that we are pushing to
+	currentTreeSha, err := GetTreeTip(ctx, baseSha)
+	if err != nil {
+		return err
+	}
+	rn.Result.Track("base", start)
+
+	if rn.Mirror != nil {
+		remoteTree, err := GetRemoteTree(ctx, currentTreeSha, true)
+		if err != nil {
+			return err
+		}
 
-func (rn *RunSettings) ExecuteDryRun() {
-	heading := color.New(color.FgCyan, color.Bold).SprintFunc()
-	fmt.Printf("%s\n\n", heading("The following files would be committed:"))
+		rn.FileSelection, err = rn.Mirror.Changes(remoteTree)
+		if err != nil {
+			return err
+		}
 
-	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
-	for i, item := range rn.FileSelection {
-		index := color.New(color.FgYellow).Sprintf("%d.", i+1)
-		filename := color.New(color.FgWhite).Sprint(item)
-		_, _ = fmt.Fprintf(w, "%s\t%s\n", index, filename)
+		fmt.Fprintf(out, "%s %d file(s) differ from %s\n",
+			color.New(color.FgGreen).Sprint("🪞"),
+			len(rn.FileSelection),
+			func() string {
+				if rn.Mirror.RemoteDir == "" {
+					return "the repository root"
+				}
+				return rn.Mirror.RemoteDir
+			}(),
+		)
 	}
-	_ = w.Flush()
-}
 
-func (rn *RunSettings) Commit() error {
-	var err error
-	var commitSha string
+	// The selection is only known now, but nothing has been written yet
+	if err = rn.Preflight(ctx, rn.FileSelection); err != nil {
+		return err
+	}
 
-	// Create branches so we don't have to worry about those errors later
-	if rn.PrSettings != nil {
-		commitSha, err = EnsureBranchesExist(rn.PrSettings.BaseRef, rn.PrSettings.HeadRef, rn.RepoSettings)
-	} else {
-		commitSha, err = EnsureBranchesExist(rn.CommitSettings.CommitToBranch, "", rn.RepoSettings)
+	// Show what would change and, in a terminal, give the chance to back out before
+	// anything is written
+	patchTree := NewPatchTree(
+		currentTreeSha,
+		func(treeSha string) ([]TreeEntry, error) { return GetRemoteTree(ctx, treeSha, false) },
+		func(blobSha string) ([]byte, error) { return GetBlob(ctx, blobSha) },
+	)
+	if rn.Diff {
+		planned, err := PlanChanges(rn.FileSelection, patchTree.Entry)
+		if err != nil {
+			return err
+		}
+		if err = PrintDiffs(planned, func(blobSha string) ([]byte, error) { return GetBlob(ctx, blobSha) }); err != nil {
+			return err
+		}
 	}
-	if err != nil {
+	if err = rn.Confirm(); err != nil {
 		return err
 	}
 
-	// Commits reference trees. Trees have their own hashes. Get the hash
-	// of the tip of the tree that we are pushing to
-	currentTreeSha, err := GetTreeTip(commitSha)
+	// From here on, the run writes to the remote, and only stops between steps
+	progress := NewProgress()
+	if rn.Fork {
+		progress.Add("set up the fork")
+	}
+	progress.Add("upload the blobs", "create the tree", "create the branches", "create the commit",
+		fmt.Sprintf("move %s to the commit", rn.CommitSettings.CommitToBranch))
+	progress.Add(rn.prSteps()...)
+
+	// Forking and syncing the fork are writes, so they wait until everything else has been
+	// checked. The base and its tree were read from the upstream, whose objects the fork
+	// shares.
+	if rn.Fork {
+		if err = progress.Next(ctx); err != nil {
+			return err
+		}
+		start = time.Now()
+		if err = SetupFork(ctx, rn.PrSettings.BaseRef, rn.ForkOwner); err != nil {
+			return err
+		}
+		rn.Result.Repository = fmt.Sprintf("%s/%s", repo.Owner(), repo.Name())
+		rn.Result.Track("fork", start)
+	}
+
+	if err = progress.Next(ctx); err != nil {
+		return err
+	}
+	start = time.Now()
+	blobs, err := CreateBlobs(ctx, rn.FileSelection)
 	if err != nil {
 		return err
 	}
+	rn.Result.SetBlobs(rn.FileSelection, blobs)
+	if err = rn.Result.MarkUnchanged(patchTree.Entry); err != nil {
+		return err
+	}
+	rn.Result.Track("blobs", start)
+
+	// An empty selection, allowed by --allow-empty, keeps the tree as it is
+	if err = progress.Next(ctx); err != nil {
+		return err
+	}
+	start = time.Now()
+	newTreeSha := currentTreeSha
+	if len(blobs) > 0 {
+		newTreeSha, err = CreateTree(ctx, currentTreeSha, blobs)
+		if err != nil {
+			return err
+		}
+	}
+	rn.Result.TreeSha = newTreeSha
+	rn.Result.Track("tree", start)
 
-	blobs, err := CreateBlobs(rn.FileSelection)
+	if newTreeSha == currentTreeSha && !rn.AllowEmpty {
+		fmt.Fprintf(out, "%s Nothing to commit, the tree of %s would not change\n",
+			color.New(color.FgGreen).Sprint("✨"), rn.baseBranch())
+		rn.Result.NoChanges = true
+		return nil
+	}
+
+	// Create branches so we don't have to worry about those errors later
+	if err = progress.Next(ctx); err != nil {
+		return err
+	}
+	start = time.Now()
+	commitSha, err := rn.EnsureBranches(ctx)
 	if err != nil {
 		return err
 	}
+	if commitSha != baseSha {
+		return fmt.Errorf("%s moved while the commit was being prepared, try again", rn.baseBranch())
+	}
+	rn.Result.Track("branches", start)
 
-	newTreeSha, err := CreateTree(currentTreeSha, blobs)
-	newCommit, err := CreateCommitFromTree(commitSha, newTreeSha, rn.CommitSettings.CommitMessage)
+	if err = progress.Next(ctx); err != nil {
+		return err
+	}
+	start = time.Now()
+	newCommit, err := CreateCommitFromTree(ctx, commitSha, newTreeSha, rn.CommitSettings.CommitMessage, nil)
+	if err != nil {
+		return err
+	}
+	rn.Result.SetCommit(newCommit)
+	rn.Result.Track("commit", start)
 
+	if err = progress.Next(ctx); err != nil {
+		return err
+	}
+	start = time.Now()
+	err = AssociateCommitWithBranch(ctx, rn.CommitSettings.CommitToBranch, baseSha, newCommit)
 	if err != nil {
 		return err
 	}
+	rn.Result.Track("ref", start)
+
+	return rn.OpenPullRequest(ctx, progress)
+}
+
+// confirmation is the question to ask in a terminal before anything is written, if any.
+// Commits made straight to the default branch are always confirmed, unless --yes is given.
+func (rn *RunSettings) confirmation() string {
+	if rn.Yes || rn.DryRun {
+		return ""
+	}
+
+	target := rn.CommitSettings.CommitToBranch
+	if rn.PrSettings == nil && target == rn.RepoSettings.DefaultBranch {
+		return fmt.Sprintf("Commit directly to %s, the default branch of %s/%s?", target, repo.Owner(), repo.Name())
+	}
+	if rn.Diff || rn.Interactive {
+		return fmt.Sprintf("Commit these changes to %s?", target)
+	}
+	return ""
+}
 
-	err = AssociateCommitWithBranch(rn.CommitSettings.CommitToBranch, newCommit)
+// Confirm asks the user to confirm the commit, when there is someone to ask.
+func (rn *RunSettings) Confirm() error {
+	question := rn.confirmation()
+	if question == "" || !isInteractive() {
+		return nil
+	}
+
+	confirmed, err := confirm(question)
 	if err != nil {
 		return err
 	}
+	if !confirmed {
+		return errCancelled
+	}
+	return nil
+}
+
+// Report hands the result of a finished run to Actions and, with --json, to stdout, then
+// fails the run if a dry run found problems, or exits with ExitNoChanges for no-op runs.
+func (rn *RunSettings) Report() error {
+	rn.Result.ExportGitHubActions()
+	if rn.JSON {
+		err := rn.Result.Write()
+		if err != nil {
+			return err
+		}
+	}
+	if len(rn.Result.Problems) > 0 {
+		return formatProblems(rn.Result.Problems)
+	}
+	if rn.Result.NoChanges {
+		PrintRateLimit()
+		os.Exit(ExitNoChanges)
+	}
+	return nil
+}
 
+func (rn *RunSettings) baseBranch() string {
 	if rn.PrSettings != nil {
-		err = CreatePullRequest(
-			rn.PrSettings.BaseRef,
-			rn.PrSettings.HeadRef,
-			rn.PrSettings.Title,
-			rn.PrSettings.Description,
-			rn.PrSettings.Labels)
+		return rn.PrSettings.BaseRef
+	}
+	return rn.CommitSettings.CommitToBranch
+}
+
+// ResolveBase finds the commit the new commit is built on, without creating any refs.
+// Branches that do not exist yet will be created from the default branch. When applying
+// a plan, the base must still be the commit the plan was made against.
+func (rn *RunSettings) ResolveBase(ctx context.Context) (string, error) {
+	sha, err := rn.resolveBase(ctx)
+	if err != nil {
+		return "", err
+	}
+	if rn.ExpectedBaseSha != "" && sha != rn.ExpectedBaseSha {
+		return "", fmt.Errorf("refusing to apply the plan: %s moved from %s to %s since it was made",
+			rn.baseBranch(), shortSha(rn.ExpectedBaseSha), shortSha(sha))
+	}
+	return sha, nil
+}
+
+func (rn *RunSettings) resolveBase(ctx context.Context) (string, error) {
+	if upstream != nil {
+		sha, err := getBranchSha(ctx, upstream, rn.PrSettings.BaseRef)
 		if err != nil {
+			return "", err
+		}
+		if sha == "" {
+			return "", fmt.Errorf("the base branch %s does not exist on %s/%s", rn.PrSettings.BaseRef, upstream.Owner(), upstream.Name())
+		}
+		return sha, nil
+	}
+
+	sha, err := GetBranchSha(ctx, rn.baseBranch())
+	if err != nil {
+		return "", err
+	}
+	if sha == "" {
+		return rn.RepoSettings.DefaultBranchSha, nil
+	}
+	return sha, nil
+}
+
+// EnsureBranches creates the branches the commit needs and returns the commit to build on.
+func (rn *RunSettings) EnsureBranches(ctx context.Context) (string, error) {
+	if upstream != nil {
+		return EnsureForkBranch(ctx, rn.PrSettings.BaseRef, rn.PrSettings.HeadRef)
+	} else if rn.PrSettings != nil {
+		return EnsureBranchesExist(ctx, rn.PrSettings.BaseRef, rn.PrSettings.HeadRef, rn.RepoSettings)
+	}
+	return EnsureBranchesExist(ctx, rn.CommitSettings.CommitToBranch, "", rn.RepoSettings)
+}
+
+func (rn *RunSettings) OpenPullRequest(ctx context.Context, progress *Progress) error {
+	if rn.PrSettings == nil {
+		return nil
+	}
+
+	if err := progress.Next(ctx); err != nil {
+		return err
+	}
+	start := time.Now()
+	pr, err := CreatePullRequest(ctx,
+		rn.PrSettings.BaseRef,
+		rn.PrSettings.HeadRef,
+		rn.PrSettings.Title,
+		rn.PrSettings.Description)
+	if err != nil {
+		return err
+	}
+	rn.Result.PullRequest = &PullRequestResult{Number: pr.Number, Url: pr.HtmlUrl}
+
+	// An open PR without its labels is a safe point too
+	if len(rn.PrSettings.Labels) > 0 {
+		if err = progress.Next(ctx); err != nil {
+			return err
+		}
+		if err = LabelPullRequest(ctx, pr.Number, rn.PrSettings.Labels); err != nil {
 			return err
 		}
 	}
 
+	rn.Result.Track("pull_request", start)
 	return nil
 }
+
+// prSteps are the steps of opening the pull request, if the run opens one.
+func (rn *RunSettings) prSteps() []string {
+	if rn.PrSettings == nil {
+		return nil
+	}
+	if len(rn.PrSettings.Labels) > 0 {
+		return []string{"open the pull request", "label the pull request"}
+	}
+	return []string{"open the pull request"}
+}
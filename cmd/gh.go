@@ -2,26 +2,52 @@ package cmd
 
 import (
 	"bytes"
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/cli/go-gh"
 	"github.com/cli/go-gh/pkg/api"
+	"github.com/cli/go-gh/pkg/repository"
 	"github.com/fatih/color"
 	"net/http"
-	"os"
-	"strconv"
+	"slices"
+	"strings"
+	"time"
 )
 
-func ValidateGitRemote() (*RepoSettings, error) {
-	restClient, err := gh.RESTClient(nil)
-	// Any error here is fatal
-	if err != nil {
-		return nil, err
+// ResolveTargetRepository determines the repository to commit to. An explicit repository
+// takes precedence over a named remote, which takes precedence over the inferred one.
+func ResolveTargetRepository(repoName, remoteName string) (repository.Repository, error) {
+	if repoName != "" {
+		return repository.Parse(repoName)
 	}
 
-	repoObj, err := gh.CurrentRepository()
+	if remoteName != "" {
+		url, err := GetRemoteUrl(remoteName)
+		if err != nil {
+			return nil, err
+		}
+		return repository.Parse(url)
+	}
+
+	return currentRepository()
+}
+
+// currentRepository infers the repository from the git remotes of the current directory.
+var currentRepository = gh.CurrentRepository
+
+// NewRESTClient builds a client for the given host. The token is resolved from the
+// environment or the gh config for that host, so GitHub Enterprise Server works as well.
+// Requests are retried when GitHub fails them in passing.
+func NewRESTClient(host string) (api.RESTClient, error) {
+	return gh.RESTClient(&api.ClientOptions{Host: host, Transport: transport})
+}
+
+func ValidateGitRemote(ctx context.Context, repoObj repository.Repository) (*RepoSettings, error) {
+	restClient, err := NewRESTClient(repoObj.Host())
+	// Any error here is fatal
 	if err != nil {
 		return nil, err
 	}
@@ -35,14 +61,14 @@ func ValidateGitRemote() (*RepoSettings, error) {
 
 	var repoDescriptionResult RepoDescriptionResponse
 	url := fmt.Sprintf("repos/%s/%s", owner, name)
-	err = client.Get(url, &repoDescriptionResult)
+	err = client.DoWithContext(ctx, http.MethodGet, url, nil, &repoDescriptionResult)
 	if err != nil {
 		return nil, errors.New(fmt.Sprint("Error getting repo description: ", err))
 	}
 
 	url = fmt.Sprintf("repos/%s/%s/branches/%s", owner, name, repoDescriptionResult.DefaultBranch)
 	var branchDescriptionResult BranchDescriptionResponse
-	err = client.Get(url, &branchDescriptionResult)
+	err = client.DoWithContext(ctx, http.MethodGet, url, nil, &branchDescriptionResult)
 	if err != nil {
 		return nil, errors.New("using the gh-commit extension requires the repo already having an initial commit")
 	}
@@ -50,22 +76,145 @@ func ValidateGitRemote() (*RepoSettings, error) {
 	repoSettings := &RepoSettings{
 		DefaultBranch:    repoDescriptionResult.DefaultBranch,
 		DefaultBranchSha: branchDescriptionResult.Commit.SHA,
+		Private:          repoDescriptionResult.Private,
+		Permissions:      repoDescriptionResult.Permissions,
 	}
 	// Now we get the HeadSha for the default branch
 	return repoSettings, nil
 }
 
-func EnsureBranchesExist(targetBranch, intermediateBranch string, repoSettings *RepoSettings) (string, error) {
+// forkPollInterval and forkPollAttempts bound how long the run waits for a new fork to
+// become available.
+var (
+	forkPollInterval = 2 * time.Second
+	forkPollAttempts = 10
+)
+
+// pause waits between polls, unless the run is cancelled or times out first. Tests replace
+// it, so that they run without waiting.
+var pause = sleepContext
+
+// SetupFork finds or creates the fork of the current repository and points the run at it.
+// The repository being forked is kept as the upstream, which is where the PR is opened.
+func SetupFork(ctx context.Context, baseBranch, forkOwner string) error {
+	body := map[string]interface{}{}
+	if forkOwner != "" {
+		body["organization"] = forkOwner
+	}
+	marshalled, _ := json.Marshal(body)
+
+	// Forking is idempotent: when the fork already exists, it is returned as is
+	var forkResponse ForkResponse
+	err := client.DoWithContext(ctx, http.MethodPost,
+		fmt.Sprintf("repos/%s/%s/forks", repo.Owner(), repo.Name()),
+		bytes.NewBuffer(marshalled),
+		&forkResponse)
+	if err != nil {
+		if httpErr, ok := err.(api.HTTPError); ok && (httpErr.StatusCode == http.StatusUnauthorized || httpErr.StatusCode == http.StatusForbidden) {
+			return errors.New(fmt.Sprintf("you are not authorized to fork %s/%s", repo.Owner(), repo.Name()))
+		}
+		return errors.New(fmt.Sprint("error creating fork: ", err))
+	}
+
+	forkRepo, err := repository.ParseWithHost(
+		fmt.Sprintf("%s/%s", forkResponse.Owner.Login, forkResponse.Name), repo.Host())
+	if err != nil {
+		return err
+	}
+
+	if forkRepo.Owner() == repo.Owner() && forkRepo.Name() == repo.Name() {
+		return errors.New("the fork resolved to the repository itself; use --use-pr without --fork instead")
+	}
+
+	// Fork creation happens asynchronously, so wait until its git data can be read
+	url := fmt.Sprintf("repos/%s/%s/branches/%s", forkRepo.Owner(), forkRepo.Name(), forkResponse.DefaultBranch)
+	for attempt := 0; ; attempt++ {
+		err = client.DoWithContext(ctx, http.MethodGet, url, nil, nil)
+		if err == nil {
+			break
+		}
+		if attempt >= forkPollAttempts {
+			return errors.New(fmt.Sprint("timed out waiting for the fork to become available: ", err))
+		}
+		if err = pause(ctx, forkPollInterval); err != nil {
+			return err
+		}
+	}
+
+	// Sync the base branch of the fork. This is best effort, as the head ref is created
+	// from the upstream base regardless.
+	marshalled, _ = json.Marshal(map[string]string{"branch": baseBranch})
+	err = client.DoWithContext(ctx, http.MethodPost,
+		fmt.Sprintf("repos/%s/%s/merge-upstream", forkRepo.Owner(), forkRepo.Name()),
+		bytes.NewBuffer(marshalled),
+		nil)
+	if err != nil {
+		warn(fmt.Sprintf("Could not sync %s on the fork: %s", baseBranch, err))
+	}
+
+	fmt.Fprintf(out, "%s Using fork %s/%s\n",
+		color.New(color.FgGreen).Sprint("🍴"),
+		forkRepo.Owner(), forkRepo.Name(),
+	)
+
+	upstream = repo
+	repo = forkRepo
+	return nil
+}
+
+// EnsureForkBranch creates the head ref on the fork, pointing at the tip of the upstream base ref.
+func EnsureForkBranch(ctx context.Context, baseRef, headRef string) (string, error) {
+	var baseBranchResponse BranchDescriptionResponse
+	err := client.DoWithContext(ctx, http.MethodGet,
+		fmt.Sprintf("repos/%s/%s/branches/%s", upstream.Owner(), upstream.Name(), baseRef),
+		nil,
+		&baseBranchResponse)
+	if err != nil {
+		if httpErr, ok := err.(api.HTTPError); ok && httpErr.StatusCode == http.StatusNotFound {
+			return "", errors.New(fmt.Sprintf("the base branch %s does not exist on %s/%s", baseRef, upstream.Owner(), upstream.Name()))
+		}
+		return "", errors.New(fmt.Sprint("Error getting branch description: ", err))
+	}
+
+	err = client.DoWithContext(ctx, http.MethodPost,
+		fmt.Sprintf("repos/%s/%s/git/refs", repo.Owner(), repo.Name()),
+		bytes.NewBuffer([]byte(
+			fmt.Sprintf(`{"ref": "refs/heads/%s", "sha": "%s"}`,
+				headRef, baseBranchResponse.Commit.SHA),
+		)),
+		nil,
+	)
+	if err != nil {
+		if httpErr, ok := err.(api.HTTPError); ok && (httpErr.StatusCode == http.StatusUnauthorized || httpErr.StatusCode == http.StatusForbidden) {
+			return "", errors.New(fmt.Sprintf("you are not authorized to create the ref %s on the fork", headRef))
+		}
+		return "", errors.New(fmt.Sprintf("error creating branch: %s", err))
+	}
+	recordCreatedBranch(headRef, baseBranchResponse.Commit.SHA)
+
+	return baseBranchResponse.Commit.SHA, nil
+}
+
+// prRepository is the repository that PRs and labels live in.
+func prRepository() repository.Repository {
+	if upstream != nil {
+		return upstream
+	}
+	return repo
+}
+
+func EnsureBranchesExist(ctx context.Context, targetBranch, intermediateBranch string, repoSettings *RepoSettings) (string, error) {
 	headShaForIntermediateBranch := repoSettings.DefaultBranchSha
 
 	var targetBranchResponse BranchDescriptionResponse
-	err := client.Get(
+	err := client.DoWithContext(ctx, http.MethodGet,
 		fmt.Sprintf("repos/%s/%s/branches/%s", repo.Owner(), repo.Name(), targetBranch),
+		nil,
 		&targetBranchResponse)
 	if err != nil {
 		if httpErr, ok := err.(api.HTTPError); ok && httpErr.StatusCode == http.StatusNotFound {
 			// Now we create the branch from the default repository
-			err = client.Post(
+			err = client.DoWithContext(ctx, http.MethodPost,
 				fmt.Sprintf("repos/%s/%s/git/refs", repo.Owner(), repo.Name()),
 				bytes.NewBuffer([]byte(
 					fmt.Sprintf(`{"ref": "refs/heads/%s", "sha": "%s"}`,
@@ -80,6 +229,7 @@ func EnsureBranchesExist(targetBranch, intermediateBranch string, repoSettings *
 					return "", errors.New(fmt.Sprintf("error creating branch: %s", err))
 				}
 			}
+			recordCreatedBranch(targetBranch, repoSettings.DefaultBranchSha)
 		} else {
 			return "", errors.New(fmt.Sprint("Error getting branch description: ", err))
 		}
@@ -90,7 +240,7 @@ func EnsureBranchesExist(targetBranch, intermediateBranch string, repoSettings *
 	// intermediaryBranch is only for the usePr workflow
 	if intermediateBranch != "" {
 		// Now we create the branch from the default repository
-		err = client.Post(
+		err = client.DoWithContext(ctx, http.MethodPost,
 			fmt.Sprintf("repos/%s/%s/git/refs", repo.Owner(), repo.Name()),
 			bytes.NewBuffer([]byte(
 				fmt.Sprintf(`{"ref": "refs/heads/%s", "sha": "%s"}`,
@@ -106,15 +256,16 @@ func EnsureBranchesExist(targetBranch, intermediateBranch string, repoSettings *
 				return "", errors.New(fmt.Sprintf("error creating branch: %s", err))
 			}
 		}
+		recordCreatedBranch(intermediateBranch, headShaForIntermediateBranch)
 	}
 
 	return headShaForIntermediateBranch, nil
 }
 
-func GetTreeTip(commitSha string) (string, error) {
+func GetTreeTip(ctx context.Context, commitSha string) (string, error) {
 	// We already validated that we have a commit, so there should be no errors here
 	var res ShaResponse
-	err := client.Get(fmt.Sprintf("repos/%s/%s/git/trees/%s", repo.Owner(), repo.Name(), commitSha), &res)
+	err := client.DoWithContext(ctx, http.MethodGet, fmt.Sprintf("repos/%s/%s/git/trees/%s", repo.Owner(), repo.Name(), commitSha), nil, &res)
 	// I don't know what a relevant error here would be
 	if err != nil {
 		return "", errors.New(fmt.Sprint("error getting tree description: ", err))
@@ -122,49 +273,126 @@ func GetTreeTip(commitSha string) (string, error) {
 	return res.Sha, nil
 }
 
+// GetRemoteTree lists the entries of a tree. When recursive, subtrees are listed as well,
+// with paths relative to the tree rather than just names.
+func GetRemoteTree(ctx context.Context, treeSha string, recursive bool) ([]TreeEntry, error) {
+	url := fmt.Sprintf("repos/%s/%s/git/trees/%s", repo.Owner(), repo.Name(), treeSha)
+	if recursive {
+		url += "?recursive=1"
+	}
+
+	var res TreeResponse
+	err := client.DoWithContext(ctx, http.MethodGet, url, nil, &res)
+	if err != nil {
+		return nil, errors.New(fmt.Sprint("error getting tree description: ", err))
+	}
+
+	// The API cuts off large trees, and acting on a partial listing could delete files
+	if res.Truncated {
+		return nil, errors.New("the remote tree is too large to be listed in full")
+	}
+	return res.Tree, nil
+}
+
+// GetBlob downloads the content of a blob.
+func GetBlob(ctx context.Context, blobSha string) ([]byte, error) {
+	var res BlobResponse
+	err := client.DoWithContext(ctx, http.MethodGet, fmt.Sprintf("repos/%s/%s/git/blobs/%s", repo.Owner(), repo.Name(), blobSha), nil, &res)
+	if err != nil {
+		return nil, errors.New(fmt.Sprint("error getting blob: ", err))
+	}
+
+	if res.Encoding != "base64" {
+		return []byte(res.Content), nil
+	}
+	// The API wraps the encoded content across lines
+	data, err := base64.StdEncoding.DecodeString(strings.ReplaceAll(res.Content, "\n", ""))
+	if err != nil {
+		return nil, errors.New(fmt.Sprint("error decoding blob: ", err))
+	}
+	return data, nil
+}
+
+// GetBranchSha returns the tip of a branch, or an empty string if the branch does not exist.
+func GetBranchSha(ctx context.Context, branch string) (string, error) {
+	return getBranchSha(ctx, repo, branch)
+}
+
+func getBranchSha(ctx context.Context, r repository.Repository, branch string) (string, error) {
+	branchResponse, err := getBranch(ctx, r, branch)
+	if err != nil || branchResponse == nil {
+		return "", err
+	}
+	return branchResponse.Commit.SHA, nil
+}
+
+// GetBranch describes a branch of the repository, or returns nil if it does not exist.
+func GetBranch(ctx context.Context, branch string) (*BranchDescriptionResponse, error) {
+	return getBranch(ctx, repo, branch)
+}
+
+func getBranch(ctx context.Context, r repository.Repository, branch string) (*BranchDescriptionResponse, error) {
+	var branchResponse BranchDescriptionResponse
+	err := client.DoWithContext(ctx, http.MethodGet, fmt.Sprintf("repos/%s/%s/branches/%s", r.Owner(), r.Name(), branch), nil, &branchResponse)
+	if err != nil {
+		if httpErr, ok := err.(api.HTTPError); ok && httpErr.StatusCode == http.StatusNotFound {
+			return nil, nil
+		}
+		return nil, errors.New(fmt.Sprint("Error getting branch description: ", err))
+	}
+	return &branchResponse, nil
+}
+
 // CreateBlobs creates the leaves of the trees that commits reference.
-func CreateBlobs(files []string) ([]BlobInfo, error) {
+func CreateBlobs(ctx context.Context, changes []FileChange) ([]BlobInfo, error) {
 	blobs := make([]BlobInfo, 0)
-	for _, file := range files {
-		if _, err := os.Stat(file); os.IsNotExist(err) {
+	for _, change := range changes {
+		mode := change.Mode
+		if mode == "" {
+			mode = "100644"
+		}
+
+		content, err := change.Load()
+		if err != nil {
+			return nil, err
+		}
+		if content == nil {
+			change.Deleted = true
+		}
+
+		if change.Deleted {
 			// Nil is for when we delete a file
 			blobs = append(blobs, BlobInfo{
-				Path: file,
-				Mode: "100644",
+				Path: change.Path,
+				Mode: mode,
 				Type: "blob",
 				Sha:  nil,
 			})
+			continue
+		}
 
-		} else {
-
-			blobSha, err := CreateBlob(file)
-			if err != nil {
-				return nil, err
-			}
-
-			blobs = append(blobs, BlobInfo{
-				Path: file,
-				Mode: "100644",
-				Type: "blob",
-				Sha:  &blobSha,
-			})
+		blobSha, err := CreateBlob(ctx, content)
+		if err != nil {
+			return nil, err
 		}
+
+		blobs = append(blobs, BlobInfo{
+			Path: change.Path,
+			Mode: mode,
+			Type: "blob",
+			Sha:  &blobSha,
+		})
 	}
 	return blobs, nil
 }
 
-func CreateBlob(file string) (string, error) {
-	data, err := os.ReadFile(file)
-	if err != nil {
-		return "", errors.New(fmt.Sprint("Error reading file: ", err))
-	}
-
+func CreateBlob(ctx context.Context, data []byte) (string, error) {
 	encoded := base64.StdEncoding.EncodeToString(data)
 	// In the first GH action version of this, we would get errors because the encoding
 	// would be too large for Bash to handle, so we would use the --input argument
 	// to pass a file name. We do not need to do this here.
 	var blobResponse ShaResponse
-	err = client.Post(
+	err := client.DoWithContext(ctx, http.MethodPost,
 		fmt.Sprintf("repos/%s/%s/git/blobs", repo.Owner(), repo.Name()),
 		bytes.NewBuffer([]byte(fmt.Sprintf(
 			`{"content": "%s", "encoding": "base64"}`, encoded,
@@ -179,7 +407,7 @@ func CreateBlob(file string) (string, error) {
 	return blobResponse.Sha, nil
 }
 
-func CreateTree(baseTree string, blobs []BlobInfo) (string, error) {
+func CreateTree(ctx context.Context, baseTree string, blobs []BlobInfo) (string, error) {
 	tree := map[string]interface{}{
 		"base_tree": baseTree,
 		"tree":      blobs,
@@ -188,7 +416,7 @@ func CreateTree(baseTree string, blobs []BlobInfo) (string, error) {
 	marshalled, _ := json.Marshal(tree)
 
 	var treeResponse ShaResponse
-	err := client.Post(
+	err := client.DoWithContext(ctx, http.MethodPost,
 		fmt.Sprintf("repos/%s/%s/git/trees", repo.Owner(), repo.Name()),
 		bytes.NewBuffer(marshalled),
 		&treeResponse)
@@ -199,15 +427,20 @@ func CreateTree(baseTree string, blobs []BlobInfo) (string, error) {
 	return treeResponse.Sha, nil
 }
 
-func CreateCommitFromTree(latestCommit, treeSha, commitMessage string) (string, error) {
+// CreateCommitFromTree creates a commit on top of latestCommit. Without an explicit author,
+// GitHub attributes the commit to the owner of the token.
+func CreateCommitFromTree(ctx context.Context, latestCommit, treeSha, commitMessage string, author *CommitAuthor) (string, error) {
 	body := map[string]interface{}{
 		"message": commitMessage,
 		"tree":    treeSha,
 		"parents": []string{latestCommit},
 	}
+	if author != nil {
+		body["author"] = author
+	}
 	marshalled, _ := json.Marshal(body)
 	var newCommitResponse ShaResponse
-	err := client.Post(
+	err := client.DoWithContext(ctx, http.MethodPost,
 		fmt.Sprintf("repos/%s/%s/git/commits", repo.Owner(), repo.Name()),
 		bytes.NewBuffer(marshalled),
 		&newCommitResponse,
@@ -220,78 +453,196 @@ func CreateCommitFromTree(latestCommit, treeSha, commitMessage string) (string,
 	return newCommitResponse.Sha, nil
 }
 
-func AssociateCommitWithBranch(branch string, commitSha string) error {
+// AssociateCommitWithBranch moves a branch from previousSha to the new commit.
+func AssociateCommitWithBranch(ctx context.Context, branch, previousSha, commitSha string) error {
 	body := map[string]interface{}{
 		"sha": commitSha,
 	}
 	marshalled, _ := json.Marshal(body)
-	err := client.Post(fmt.Sprintf("repos/%s/%s/git/refs/heads/%s", repo.Owner(), repo.Name(), branch), bytes.NewBuffer(marshalled), nil)
+
+	// Recorded up front: a request that is cut off may still have moved the branch. Branches
+	// the run created are deleted on failure, from wherever the run left them.
+	r := repo
+	key := fmt.Sprintf("%s/%s:%s", r.Owner(), r.Name(), branch)
+	if len(journal.Leases(key)) > 0 {
+		journal.Lease(key, commitSha)
+	} else {
+		journal.Record(
+			fmt.Sprintf("moved %s on %s/%s from %s to %s", branch, r.Owner(), r.Name(), shortSha(previousSha), shortSha(commitSha)),
+			func(ctx context.Context) error { return RestoreBranch(ctx, r, branch, commitSha, previousSha) },
+		)
+	}
+
+	err := client.DoWithContext(ctx, http.MethodPost, fmt.Sprintf("repos/%s/%s/git/refs/heads/%s", repo.Owner(), repo.Name(), branch), bytes.NewBuffer(marshalled), nil)
 	if err != nil {
 		if httpErr, ok := err.(api.HTTPError); ok && httpErr.StatusCode == http.StatusForbidden {
 			return errors.New(fmt.Sprintf("you are not authorized to make commits on this branch %s", branch))
 		}
 	}
 
-	if isGitHubAction() {
-		_ = exportGitHubOutput("sha", commitSha)
+	return err
+}
+
+// recordCreatedBranch records a branch the run created, so that it is deleted again if
+// the run fails.
+func recordCreatedBranch(branch, sha string) {
+	r, j := repo, journal
+	key := fmt.Sprintf("%s/%s:%s", r.Owner(), r.Name(), branch)
+	j.Lease(key, sha)
+	j.Record(
+		fmt.Sprintf("created %s on %s/%s", branch, r.Owner(), r.Name()),
+		func(ctx context.Context) error { return DeleteBranch(ctx, r, branch, j.Leases(key)...) },
+	)
+}
+
+// leaseBranch checks that a branch still points at one of the commits the run left it at,
+// so that undoing does not throw away what someone else pushed since. The lease is best
+// effort: the API cannot make a ref update conditional on where the ref points, so a push
+// landing between the check and the update is not caught by it. Branches that are gone
+// are reported as such.
+func leaseBranch(ctx context.Context, r repository.Repository, branch string, shas ...string) (bool, error) {
+	current, err := getBranchSha(ctx, r, branch)
+	if err != nil {
+		return false, err
+	}
+	if current == "" {
+		return false, nil
+	}
+	if !slices.Contains(shas, current) {
+		return false, fmt.Errorf("%s moved to %s since, leaving it as is", branch, shortSha(current))
 	}
+	return true, nil
+}
 
-	return err
+// DeleteBranch deletes a branch, as long as it still points at one of shas. The check is
+// best effort, see leaseBranch.
+func DeleteBranch(ctx context.Context, r repository.Repository, branch string, shas ...string) error {
+	exists, err := leaseBranch(ctx, r, branch, shas...)
+	if err != nil || !exists {
+		return err
+	}
+
+	err = client.DoWithContext(ctx, http.MethodDelete, fmt.Sprintf("repos/%s/%s/git/refs/heads/%s", r.Owner(), r.Name(), branch), nil, nil)
+	if err != nil {
+		return errors.New(fmt.Sprint("error deleting branch: ", err))
+	}
+	return nil
+}
+
+// RestoreBranch points a branch back at previousSha, as long as it still points at sha,
+// so that nothing pushed on top of the run is thrown away. Otherwise the branch is left as
+// it is and the error says where it moved to. The lease is best effort, see leaseBranch.
+// Branches that never moved are left as they are.
+func RestoreBranch(ctx context.Context, r repository.Repository, branch, sha, previousSha string) error {
+	if current, err := getBranchSha(ctx, r, branch); err == nil && current == previousSha {
+		return nil
+	}
+	exists, err := leaseBranch(ctx, r, branch, sha)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("%s no longer exists", branch)
+	}
+
+	// Going back is not a fast-forward
+	marshalled, _ := json.Marshal(map[string]interface{}{"sha": previousSha, "force": true})
+	err = client.DoWithContext(ctx, http.MethodPatch, fmt.Sprintf("repos/%s/%s/git/refs/heads/%s", r.Owner(), r.Name(), branch), bytes.NewBuffer(marshalled), nil)
+	if err != nil {
+		return errors.New(fmt.Sprint("error restoring branch: ", err))
+	}
+	return nil
+}
+
+// ClosePullRequest closes a pull request the run opened.
+func ClosePullRequest(ctx context.Context, r repository.Repository, number int) error {
+	marshalled, _ := json.Marshal(map[string]string{"state": "closed"})
+	err := client.DoWithContext(ctx, http.MethodPatch, fmt.Sprintf("repos/%s/%s/pulls/%d", r.Owner(), r.Name(), number), bytes.NewBuffer(marshalled), nil)
+	if err != nil {
+		return errors.New(fmt.Sprint("error closing pull request: ", err))
+	}
+	return nil
+}
+
+func ValidateAllLabels(ctx context.Context, labels []string) error {
+	missing, err := MissingLabels(ctx, labels)
+	if err != nil {
+		return err
+	}
+	if len(missing) > 0 {
+		return errors.New(fmt.Sprintf("Label %s not found. Create the label first", missing[0]))
+	}
+	return nil
 }
 
-func ValidateAllLabels(labels []string) error {
+// MissingLabels lists the labels that do not exist in the repository PRs are opened in.
+func MissingLabels(ctx context.Context, labels []string) ([]string, error) {
+	prRepo := prRepository()
+	var missing []string
 	for _, label := range labels {
-		err := client.Get(
-			fmt.Sprintf("repos/%s/%s/labels/%s", repo.Owner(), repo.Name(), label),
+		err := client.DoWithContext(ctx, http.MethodGet,
+			fmt.Sprintf("repos/%s/%s/labels/%s", prRepo.Owner(), prRepo.Name(), label),
+			nil,
 			nil)
 		if err != nil {
 			if err, ok := err.(api.HTTPError); ok && err.StatusCode == http.StatusNotFound {
-				return errors.New(fmt.Sprintf("Label %s not found. Create the label first", label))
+				missing = append(missing, label)
 			}
 		}
 	}
-	return nil
+	return missing, nil
 }
 
-func CreatePullRequest(baseRef, headRef, title, description string, labels []string) error {
+func CreatePullRequest(ctx context.Context, baseRef, headRef, title, description string) (*PrResponse, error) {
+	prRepo := prRepository()
+	head := headRef
+	if upstream != nil {
+		// Cross-repository PRs reference the head ref as owner:branch
+		head = fmt.Sprintf("%s:%s", repo.Owner(), headRef)
+	}
+
 	var prResponse PrResponse
 	body := PrRequest{
 		Title: title,
 		Body:  description,
-		Head:  headRef,
+		Head:  head,
 		Base:  baseRef,
 	}
 	marshalled, _ := json.Marshal(body)
-	err := client.Post(
-		fmt.Sprintf("repos/%s/%s/pulls", repo.Owner(), repo.Name()),
+	err := client.DoWithContext(ctx, http.MethodPost,
+		fmt.Sprintf("repos/%s/%s/pulls", prRepo.Owner(), prRepo.Name()),
 		bytes.NewBuffer(marshalled),
 		&prResponse)
 	if err != nil {
-		return errors.New(fmt.Sprint("error creating pull request: ", err))
+		return nil, errors.New(fmt.Sprint("error creating pull request: ", err))
 	}
+	// Pull requests cannot be deleted, so closing is as close to undoing as it gets
+	journal.Record(
+		fmt.Sprintf("opened pull request #%d on %s/%s", prResponse.Number, prRepo.Owner(), prRepo.Name()),
+		func(ctx context.Context) error { return ClosePullRequest(ctx, prRepo, prResponse.Number) },
+	)
 
-	if len(labels) > 0 {
-		labelRequest := LabelRequest{
-			Labels: labels,
-		}
-		marshalled, err = json.Marshal(labelRequest)
-		err = client.Put(
-			fmt.Sprintf("repos/%s/%s/issues/%d/labels", repo.Owner(), repo.Name(), prResponse.Number),
-			bytes.NewBuffer(marshalled),
-			nil,
-		)
-		if err != nil {
-			return errors.New(fmt.Sprint("error adding labels to pull request: ", err))
-		}
-	}
+	link := color.New(color.FgBlue, color.Bold).Sprintf("🔗 Pull Request URL: %s", prResponse.HtmlUrl)
+	fmt.Fprintln(out, link)
 
-	link := color.New(color.FgBlue, color.Bold).Sprintf("🔗 Pull Request URL: %s", prResponse.Url)
-	fmt.Println(link)
+	return &prResponse, nil
+}
 
-	if isGitHubAction() {
-		_ = exportGitHubOutput("branch", headRef)
-		_ = exportGitHubOutput("pr-number", strconv.Itoa(prResponse.Number))
+// LabelPullRequest adds labels to a pull request the run opened.
+func LabelPullRequest(ctx context.Context, number int, labels []string) error {
+	prRepo := prRepository()
+	marshalled, _ := json.Marshal(LabelRequest{Labels: labels})
+	err := client.DoWithContext(ctx, http.MethodPut,
+		fmt.Sprintf("repos/%s/%s/issues/%d/labels", prRepo.Owner(), prRepo.Name(), number),
+		bytes.NewBuffer(marshalled),
+		nil,
+	)
+	if err != nil {
+		if upstream == nil {
+			return errors.New(fmt.Sprint("error adding labels to pull request: ", err))
+		}
+		// Labelling requires triage rights upstream, which fork contributors often lack
+		warn(fmt.Sprintf("Could not add labels to the pull request: %s", err))
 	}
-
 	return nil
 }
@@ -0,0 +1,318 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/cli/go-gh/pkg/repository"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSetupFork(t *testing.T) {
+	target, err := repository.Parse("kassett/gh-commit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	originalRepo, originalUpstream, originalClient, originalOut, originalPause := repo, upstream, client, out, pause
+	defer func() {
+		repo, upstream, client, out, pause = originalRepo, originalUpstream, originalClient, originalOut, originalPause
+	}()
+	out = &bytes.Buffer{}
+
+	fork := `{"name": "gh-commit", "default_branch": "main", "owner": {"login": "octocat"}}`
+	tests := []struct {
+		name          string
+		forkOwner     string
+		forkResponse  string
+		availableWait int
+		expectedRepo  string
+		expectedWaits int
+		expectedCalls []string
+		expectedErr   string
+	}{
+		{
+			name:          "Existing fork",
+			forkResponse:  fork,
+			expectedRepo:  "octocat/gh-commit",
+			expectedCalls: []string{"POST repos/kassett/gh-commit/forks {}", `POST repos/octocat/gh-commit/merge-upstream {"branch":"main"}`},
+		},
+		{
+			name:          "New fork in an organization",
+			forkOwner:     "octo-org",
+			forkResponse:  `{"name": "gh-commit", "default_branch": "main", "owner": {"login": "octo-org"}}`,
+			availableWait: 2,
+			expectedRepo:  "octo-org/gh-commit",
+			expectedWaits: 2,
+			expectedCalls: []string{`POST repos/kassett/gh-commit/forks {"organization":"octo-org"}`, `POST repos/octo-org/gh-commit/merge-upstream {"branch":"main"}`},
+		},
+		{
+			name:          "Fork that never becomes available",
+			forkResponse:  fork,
+			availableWait: -1,
+			expectedWaits: forkPollAttempts,
+			expectedCalls: []string{"POST repos/kassett/gh-commit/forks {}"},
+			expectedErr:   "timed out waiting for the fork to become available",
+		},
+		{
+			name:          "Fork of the repository itself",
+			forkResponse:  `{"name": "gh-commit", "default_branch": "main", "owner": {"login": "kassett"}}`,
+			expectedCalls: []string{"POST repos/kassett/gh-commit/forks {}"},
+			expectedErr:   "the fork resolved to the repository itself",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, upstream = target, nil
+			responses := map[string]string{"POST repos/kassett/gh-commit/forks": tt.forkResponse}
+			branch := "repos/" + tt.expectedRepo + "/branches/main"
+			if tt.availableWait == 0 {
+				responses[branch] = `{"commit": {"sha": "abc"}}`
+			}
+			mock := &MockRESTClient{Responses: responses}
+			client = mock
+
+			var waits []time.Duration
+			pause = func(ctx context.Context, wait time.Duration) error {
+				waits = append(waits, wait)
+				if len(waits) == tt.availableWait {
+					responses[branch] = `{"commit": {"sha": "abc"}}`
+				}
+				return nil
+			}
+
+			err := SetupFork(context.Background(), "main", tt.forkOwner)
+			if tt.expectedErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectedErr) {
+					t.Errorf("expected error %q, got %v", tt.expectedErr, err)
+				}
+			} else if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			} else {
+				if forked := repo.Owner() + "/" + repo.Name(); forked != tt.expectedRepo {
+					t.Errorf("expected the run to point at %s, got %s", tt.expectedRepo, forked)
+				}
+				if upstream == nil || upstream.Owner() != "kassett" {
+					t.Errorf("expected kassett/gh-commit to be kept as the upstream")
+				}
+			}
+
+			if len(waits) != tt.expectedWaits {
+				t.Errorf("expected %d waits, got %d", tt.expectedWaits, len(waits))
+			}
+			for _, wait := range waits {
+				if wait != forkPollInterval {
+					t.Errorf("expected to wait %s between polls, got %s", forkPollInterval, wait)
+				}
+			}
+			if !equal(mock.Calls, tt.expectedCalls) {
+				t.Errorf("expected calls %v, got %v", tt.expectedCalls, mock.Calls)
+			}
+		})
+	}
+}
+
+func TestEnsureForkBranch(t *testing.T) {
+	target, err := repository.Parse("kassett/gh-commit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	forkRepo, err := repository.Parse("octocat/gh-commit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	originalRepo, originalUpstream, originalClient, originalJournal := repo, upstream, client, journal
+	defer func() {
+		repo, upstream, client, journal = originalRepo, originalUpstream, originalClient, originalJournal
+	}()
+	repo, upstream = forkRepo, target
+
+	tests := []struct {
+		name          string
+		baseRef       string
+		expectedSha   string
+		expectedCalls []string
+		expectedErr   string
+	}{
+		{
+			name:          "Head ref from the upstream base",
+			baseRef:       "main",
+			expectedSha:   "abc",
+			expectedCalls: []string{`POST repos/octocat/gh-commit/git/refs {"ref": "refs/heads/main-1", "sha": "abc"}`},
+		},
+		{
+			name:        "Missing upstream base",
+			baseRef:     "gone",
+			expectedErr: "the base branch gone does not exist on kassett/gh-commit",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			journal = &Journal{}
+			mock := &MockRESTClient{Responses: map[string]string{
+				"repos/kassett/gh-commit/branches/main": `{"commit": {"sha": "abc"}}`,
+				"repos/octocat/gh-commit/branches/main": `{"commit": {"sha": "stale"}}`,
+			}}
+			client = mock
+
+			sha, err := EnsureForkBranch(context.Background(), tt.baseRef, "main-1")
+			if tt.expectedErr != "" {
+				if err == nil || err.Error() != tt.expectedErr {
+					t.Errorf("expected error %q, got %v", tt.expectedErr, err)
+				}
+			} else if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if sha != tt.expectedSha {
+				t.Errorf("expected sha %q, got %q", tt.expectedSha, sha)
+			}
+			if !equal(mock.Calls, tt.expectedCalls) {
+				t.Errorf("expected calls %v, got %v", tt.expectedCalls, mock.Calls)
+			}
+			if len(journal.Mutations) != len(tt.expectedCalls) {
+				t.Errorf("expected the created branch to be journaled")
+			}
+		})
+	}
+}
+
+func TestCreatePullRequestHead(t *testing.T) {
+	target, err := repository.Parse("kassett/gh-commit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	forkRepo, err := repository.Parse("octocat/gh-commit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	originalRepo, originalUpstream, originalClient, originalJournal, originalOut := repo, upstream, client, journal, out
+	defer func() {
+		repo, upstream, client, journal, out = originalRepo, originalUpstream, originalClient, originalJournal, originalOut
+	}()
+	out = &bytes.Buffer{}
+
+	tests := []struct {
+		name          string
+		repo          repository.Repository
+		upstream      repository.Repository
+		expectedCalls []string
+	}{
+		{
+			name:          "Same repository",
+			repo:          target,
+			expectedCalls: []string{`POST repos/kassett/gh-commit/pulls {"title":"chore: update","body":"","head":"main-1","base":"main"}`},
+		},
+		{
+			name:          "From a fork",
+			repo:          forkRepo,
+			upstream:      target,
+			expectedCalls: []string{`POST repos/kassett/gh-commit/pulls {"title":"chore: update","body":"","head":"octocat:main-1","base":"main"}`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, upstream, journal = tt.repo, tt.upstream, &Journal{}
+			printed := &bytes.Buffer{}
+			out = printed
+			mock := &MockRESTClient{Responses: map[string]string{
+				"POST repos/kassett/gh-commit/pulls": `{"number": 7, "url": "https://api.github.com/repos/kassett/gh-commit/pulls/7", "html_url": "https://github.com/kassett/gh-commit/pull/7"}`,
+			}}
+			client = mock
+
+			pr, err := CreatePullRequest(context.Background(), "main", "main-1", "chore: update", "")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if pr.Number != 7 {
+				t.Errorf("expected pull request #7, got #%d", pr.Number)
+			}
+			if !strings.Contains(printed.String(), "Pull Request URL: https://github.com/kassett/gh-commit/pull/7") {
+				t.Errorf("expected the web URL of the pull request to be printed, got %q", printed)
+			}
+			if !equal(mock.Calls, tt.expectedCalls) {
+				t.Errorf("expected calls %v, got %v", tt.expectedCalls, mock.Calls)
+			}
+		})
+	}
+}
+
+func TestSetupForkCancelled(t *testing.T) {
+	target, err := repository.Parse("kassett/gh-commit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	originalRepo, originalUpstream, originalClient, originalOut := repo, upstream, client, out
+	defer func() { repo, upstream, client, out = originalRepo, originalUpstream, originalClient, originalOut }()
+	repo, upstream, out = target, nil, &bytes.Buffer{}
+	client = &MockRESTClient{Responses: map[string]string{
+		"POST repos/kassett/gh-commit/forks": `{"name": "gh-commit", "default_branch": "main", "owner": {"login": "octocat"}}`,
+	}}
+
+	// The fork never becomes available, and the real wait gives up once the run is cancelled
+	timedOut := errors.New("the run timed out after 1m0s")
+	ctx, cancel := context.WithCancelCause(context.Background())
+	cancel(timedOut)
+
+	start := time.Now()
+	err = SetupFork(ctx, "main", "")
+	if !errors.Is(err, timedOut) {
+		t.Errorf("expected the wait to stop with the run, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > forkPollInterval {
+		t.Errorf("expected the wait to stop right away, took %s", elapsed)
+	}
+}
+
+// scopedClient answers the token inspection with the given OAuth scopes.
+type scopedClient struct {
+	*MockRESTClient
+	scopes string
+}
+
+func (c *scopedClient) RequestWithContext(ctx context.Context, method string, path string, body io.Reader) (*http.Response, error) {
+	header := http.Header{}
+	header.Set("X-OAuth-Scopes", c.scopes)
+	return &http.Response{StatusCode: http.StatusOK, Header: header, Body: http.NoBody}, nil
+}
+
+func TestCommitForksAfterChecks(t *testing.T) {
+	target, err := repository.Parse("kassett/gh-commit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	originalRepo, originalUpstream, originalClient, originalJournal, originalOut := repo, upstream, client, journal, out
+	defer func() {
+		repo, upstream, client, journal, out = originalRepo, originalUpstream, originalClient, originalJournal, originalOut
+	}()
+	repo, upstream, journal, out = target, nil, &Journal{}, &bytes.Buffer{}
+
+	// The token cannot write to public repositories, which the preflight finds from reads alone
+	mock := &MockRESTClient{Responses: map[string]string{
+		"repos/kassett/gh-commit/branches/main": `{"commit": {"sha": "abc"}}`,
+		"repos/kassett/gh-commit/git/trees/abc": `{"sha": "tree"}`,
+	}}
+	client = &scopedClient{MockRESTClient: mock, scopes: "read:org"}
+
+	rn := &RunSettings{
+		PrSettings:     &PrSettings{BaseRef: "main", HeadRef: "main-1", Title: "chore: update"},
+		CommitSettings: &CommitSettings{CommitMessage: "chore: update", CommitToBranch: "main-1"},
+		RepoSettings:   &RepoSettings{DefaultBranch: "main", DefaultBranchSha: "abc"},
+		FileSelection:  []FileChange{{Path: "a.txt", Content: []byte("a\n")}},
+		Fork:           true,
+		Yes:            true,
+		Result:         &RunResult{TimingsMs: map[string]int64{}},
+	}
+	err = rn.Commit(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "lacks the public_repo scope") {
+		t.Errorf("expected the preflight to fail, got %v", err)
+	}
+	if len(mock.Calls) != 0 {
+		t.Errorf("expected nothing to be forked or written, got %v", mock.Calls)
+	}
+}
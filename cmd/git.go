@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	"os"
 	"os/exec"
 	"strings"
 )
@@ -54,8 +55,21 @@ func ListStagedFiles() ([]string, error) {
 	return files, nil
 }
 
+// maxPathspecArgLength is how long the pathspecs may get before they are handed to git
+// through a file, which keeps thousands of paths clear of the argument length limit.
+const maxPathspecArgLength = 64 * 1024
+
 func ListAllFilesByPattern(patterns ...string) ([]string, error) {
 	args := append([]string{"add", "--dry-run", "--verbose"}, patterns...)
+	if len(strings.Join(patterns, " ")) > maxPathspecArgLength {
+		pathspecFile, err := writePathspecFile(patterns)
+		if err != nil {
+			return nil, err
+		}
+		defer func() { _ = os.Remove(pathspecFile) }()
+		args = []string{"add", "--dry-run", "--verbose", "--pathspec-from-file=" + pathspecFile, "--pathspec-file-nul"}
+	}
+
 	out, err := executor.RunCommand("git", args...)
 	if err != nil {
 		return nil, errors.New("the pattern(s) did not match any files")
@@ -74,6 +88,21 @@ func ListAllFilesByPattern(patterns ...string) ([]string, error) {
 	return files, nil
 }
 
+func writePathspecFile(patterns []string) (string, error) {
+	f, err := os.CreateTemp("", "gh-commit-pathspec-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to write pathspecs: %w", err)
+	}
+	defer func(f *os.File) {
+		_ = f.Close()
+	}(f)
+
+	if _, err = f.WriteString(strings.Join(patterns, "\x00")); err != nil {
+		return "", fmt.Errorf("failed to write pathspecs: %w", err)
+	}
+	return f.Name(), nil
+}
+
 func ValidateLocalGit() (string, error) {
 	// Ensure we are inside a Git repo
 	if _, err := executor.RunCommand("git", "rev-parse", "--is-inside-work-tree"); err != nil {
@@ -99,3 +128,148 @@ func ValidateLocalGit() (string, error) {
 
 	return repoRoot, nil
 }
+
+func GetRemoteUrl(remote string) (string, error) {
+	out, err := executor.RunCommand("git", "remote", "get-url", remote)
+	if err != nil {
+		return "", fmt.Errorf("remote %s does not exist", remote)
+	}
+
+	return strings.TrimSpace(string(out)), nil
+}
+
+// ChangedFile is an entry of git diff --raw. Renames keep the path they were renamed from.
+type ChangedFile struct {
+	Status  byte
+	OldPath string
+	Path    string
+	Mode    string
+	Sha     string
+}
+
+// ListChangedFiles lists the files that changed between the given revisions, or between
+// a revision and the work tree, with renames detected.
+func ListChangedFiles(revisions []string, pathspecs []string) ([]ChangedFile, error) {
+	args := append([]string{"diff", "--raw", "-z", "-M", "--no-abbrev"}, revisions...)
+	args = append(args, "--")
+	args = append(args, pathspecs...)
+	out, err := executor.RunCommand("git", args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list changed files: %w", err)
+	}
+
+	// Output format: ":<old mode> <new mode> <old sha> <new sha> <status>\0<path>\0[<new path>\0]"
+	var files []ChangedFile
+	fields := strings.Split(string(out), "\x00")
+	for i := 0; i+1 < len(fields); i += 2 {
+		meta := strings.Fields(strings.TrimPrefix(fields[i], ":"))
+		if len(meta) != 5 {
+			return nil, fmt.Errorf("unexpected git diff output: %q", fields[i])
+		}
+
+		file := ChangedFile{Status: meta[4][0], Path: fields[i+1], Mode: meta[1], Sha: meta[3]}
+		if file.Status == 'R' || file.Status == 'C' {
+			if i+2 >= len(fields) {
+				return nil, fmt.Errorf("unexpected git diff output: %q", fields[i])
+			}
+			file.OldPath, file.Path = fields[i+1], fields[i+2]
+			i++
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+func ReadBlob(sha string) ([]byte, error) {
+	out, err := executor.RunCommand("git", "cat-file", "blob", sha)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read blob %s: %w", sha, err)
+	}
+	return out, nil
+}
+
+// StatusEntry is an entry of git status. Renames keep the path they were renamed from.
+type StatusEntry struct {
+	Index    byte
+	WorkTree byte
+	Path     string
+	OldPath  string
+}
+
+// Describe shows the state of the entry, and whether it is staged.
+func (se StatusEntry) Describe() string {
+	var state string
+	switch {
+	case se.Index == '?':
+		return "untracked"
+	case se.Index == 'D' || se.WorkTree == 'D':
+		state = "deleted"
+	case se.Index == 'A':
+		state = "added"
+	case se.Index == 'R':
+		state = "renamed"
+	default:
+		state = "modified"
+	}
+
+	switch {
+	case se.Index != ' ' && se.WorkTree != ' ':
+		return state + ", partly staged"
+	case se.Index != ' ':
+		return state + ", staged"
+	}
+	return state
+}
+
+// ListStatus lists the staged, changed and untracked files of the work tree.
+func ListStatus() ([]StatusEntry, error) {
+	out, err := executor.RunCommand("git", "status", "--porcelain=v1", "-z", "--untracked-files=all")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list changed files: %w", err)
+	}
+
+	// Output format: "XY <path>\0", followed by "<original path>\0" for renames and copies
+	var entries []StatusEntry
+	fields := strings.Split(string(out), "\x00")
+	for i := 0; i < len(fields); i++ {
+		if fields[i] == "" {
+			continue
+		}
+		if len(fields[i]) < 4 {
+			return nil, fmt.Errorf("unexpected git status output: %q", fields[i])
+		}
+
+		entry := StatusEntry{Index: fields[i][0], WorkTree: fields[i][1], Path: fields[i][3:]}
+		if entry.Index == 'R' || entry.Index == 'C' {
+			if i+1 >= len(fields) {
+				return nil, fmt.Errorf("unexpected git status output: %q", fields[i])
+			}
+			if entry.Index == 'R' {
+				entry.OldPath = fields[i+1]
+			}
+			i++
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// HeadEntry looks a path up in the tree of HEAD, and returns nil if it does not exist there.
+func HeadEntry(p string) (*TreeEntry, error) {
+	out, err := executor.RunCommand("git", "ls-tree", "-z", "HEAD", "--", p)
+	if err != nil {
+		// Repositories without commits have no HEAD to compare with
+		return nil, nil
+	}
+
+	// Output format: "<mode> <type> <sha>\t<path>\0"
+	for _, line := range strings.Split(string(out), "\x00") {
+		meta, path, found := strings.Cut(line, "\t")
+		fields := strings.Fields(meta)
+		if !found || len(fields) != 3 || path != p {
+			continue
+		}
+		return &TreeEntry{Path: path, Mode: fields[0], Type: fields[1], Sha: fields[2]}, nil
+	}
+	return nil, nil
+}
@@ -308,6 +308,225 @@ func TestValidateLocalGit(t *testing.T) {
 	}
 }
 
+func TestGetRemoteUrl(t *testing.T) {
+	tests := []struct {
+		name          string
+		remote        string
+		expectedUrl   string
+		expectedError error
+		complex       map[string]*CommandOutput
+	}{
+		{
+			name:          "Remote exists",
+			remote:        "upstream",
+			expectedUrl:   "git@github.com:kassett/gh-commit.git",
+			expectedError: nil,
+			complex: map[string]*CommandOutput{
+				"git remote get-url upstream": {Output: []byte("git@github.com:kassett/gh-commit.git\n"), Err: nil},
+			},
+		},
+		{
+			name:          "Remote does not exist",
+			remote:        "mirror",
+			expectedUrl:   "",
+			expectedError: errors.New("remote mirror does not exist"),
+			complex: map[string]*CommandOutput{
+				"git remote get-url mirror": {Output: nil, Err: errors.New("command error")},
+			},
+		},
+	}
+
+	// Save the original executor
+	originalExecutor := executor
+	defer func() { executor = originalExecutor }() // Restore original executor after tests
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			executor = &MockCommandExecutor{Complex: tt.complex} // Use the mock executor
+
+			url, err := GetRemoteUrl(tt.remote)
+
+			if err != nil && tt.expectedError != nil {
+				if err.Error() != tt.expectedError.Error() {
+					t.Errorf("expected error %v, got %v", tt.expectedError, err)
+				}
+			} else if err != nil || tt.expectedError != nil {
+				t.Errorf("expected error %v, got %v", tt.expectedError, err)
+			}
+
+			if url != tt.expectedUrl {
+				t.Errorf("expected url %v, got %v", tt.expectedUrl, url)
+			}
+		})
+	}
+}
+
+func TestListChangedFiles(t *testing.T) {
+	tests := []struct {
+		name          string
+		revisions     []string
+		pathspecs     []string
+		expectedFiles []ChangedFile
+		expectedError error
+		complex       map[string]*CommandOutput
+	}{
+		{
+			name:          "No changes",
+			revisions:     []string{"origin/main"},
+			expectedFiles: nil,
+			complex: map[string]*CommandOutput{
+				"git diff --raw -z -M --no-abbrev origin/main --": {Output: []byte(""), Err: nil},
+			},
+		},
+		{
+			name:      "Modified, added, deleted and renamed files",
+			revisions: []string{"A..B"},
+			pathspecs: []string{"src"},
+			expectedFiles: []ChangedFile{
+				{Status: 'M', Path: "src/a.go", Mode: "100644", Sha: "bbbb"},
+				{Status: 'A', Path: "src/run.sh", Mode: "100755", Sha: "cccc"},
+				{Status: 'D', Path: "src/gone.go", Mode: "000000", Sha: "0000"},
+				{Status: 'R', OldPath: "src/old.go", Path: "src/new.go", Mode: "100644", Sha: "dddd"},
+			},
+			complex: map[string]*CommandOutput{
+				"git diff --raw -z -M --no-abbrev A..B -- src": {Output: []byte(
+					":100644 100644 aaaa bbbb M\x00src/a.go\x00" +
+						":000000 100755 0000 cccc A\x00src/run.sh\x00" +
+						":100644 000000 eeee 0000 D\x00src/gone.go\x00" +
+						":100644 100644 dddd dddd R100\x00src/old.go\x00src/new.go\x00"), Err: nil},
+			},
+		},
+		{
+			name:          "Command error",
+			revisions:     []string{"missing"},
+			expectedFiles: nil,
+			expectedError: errors.New("failed to list changed files: command error"),
+			complex: map[string]*CommandOutput{
+				"git diff --raw -z -M --no-abbrev missing --": {Output: nil, Err: errors.New("command error")},
+			},
+		},
+	}
+
+	// Save the original executor
+	originalExecutor := executor
+	defer func() { executor = originalExecutor }() // Restore original executor after tests
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			executor = &MockCommandExecutor{Complex: tt.complex} // Use the mock executor
+
+			files, err := ListChangedFiles(tt.revisions, tt.pathspecs)
+
+			if err != nil && tt.expectedError != nil {
+				if err.Error() != tt.expectedError.Error() {
+					t.Errorf("expected error %v, got %v", tt.expectedError, err)
+				}
+			} else if err != nil || tt.expectedError != nil {
+				t.Errorf("expected error %v, got %v", tt.expectedError, err)
+			}
+
+			if len(files) != len(tt.expectedFiles) {
+				t.Fatalf("expected files %v, got %v", tt.expectedFiles, files)
+			}
+			for i := range files {
+				if files[i] != tt.expectedFiles[i] {
+					t.Errorf("expected file %v, got %v", tt.expectedFiles[i], files[i])
+				}
+			}
+		})
+	}
+}
+
+func TestListStatus(t *testing.T) {
+	tests := []struct {
+		name            string
+		expectedEntries []StatusEntry
+		expectedStates  []string
+		expectedError   error
+		complex         map[string]*CommandOutput
+	}{
+		{
+			name:            "Clean work tree",
+			expectedEntries: nil,
+			complex: map[string]*CommandOutput{
+				"git status --porcelain=v1 -z --untracked-files=all": {Output: []byte("")},
+			},
+		},
+		{
+			name: "Changed, staged, renamed and untracked files",
+			expectedEntries: []StatusEntry{
+				{Index: ' ', WorkTree: 'M', Path: "a.txt"},
+				{Index: 'M', WorkTree: 'M', Path: "b.txt"},
+				{Index: 'R', WorkTree: ' ', Path: "new name.txt", OldPath: "old.txt"},
+				{Index: 'D', WorkTree: ' ', Path: "gone.txt"},
+				{Index: '?', WorkTree: '?', Path: "notes.txt"},
+			},
+			expectedStates: []string{"modified", "modified, partly staged", "renamed, staged", "deleted, staged", "untracked"},
+			complex: map[string]*CommandOutput{
+				"git status --porcelain=v1 -z --untracked-files=all": {
+					Output: []byte(" M a.txt\x00MM b.txt\x00R  new name.txt\x00old.txt\x00D  gone.txt\x00?? notes.txt\x00"),
+				},
+			},
+		},
+		{
+			name:          "Not a repository",
+			expectedError: errors.New("failed to list changed files: git not found"),
+			complex:       map[string]*CommandOutput{},
+		},
+	}
+
+	originalExecutor := executor
+	defer func() { executor = originalExecutor }()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			executor = &MockCommandExecutor{Complex: tt.complex}
+
+			entries, err := ListStatus()
+
+			if err != nil && tt.expectedError != nil {
+				if err.Error() != tt.expectedError.Error() {
+					t.Errorf("expected error %v, got %v", tt.expectedError, err)
+				}
+			} else if err != nil || tt.expectedError != nil {
+				t.Errorf("expected error %v, got %v", tt.expectedError, err)
+			}
+
+			if len(entries) != len(tt.expectedEntries) {
+				t.Fatalf("expected entries %v, got %v", tt.expectedEntries, entries)
+			}
+			for i := range entries {
+				if entries[i] != tt.expectedEntries[i] {
+					t.Errorf("expected entry %v, got %v", tt.expectedEntries[i], entries[i])
+				}
+				if state := entries[i].Describe(); state != tt.expectedStates[i] {
+					t.Errorf("expected %s to be %q, got %q", entries[i].Path, tt.expectedStates[i], state)
+				}
+			}
+		})
+	}
+}
+
+func TestHeadEntry(t *testing.T) {
+	originalExecutor := executor
+	defer func() { executor = originalExecutor }()
+	executor = &MockCommandExecutor{Complex: map[string]*CommandOutput{
+		"git ls-tree -z HEAD -- run.sh":  {Output: []byte("100755 blob 0123456789abcdef\trun.sh\x00")},
+		"git ls-tree -z HEAD -- new.txt": {Output: []byte("")},
+	}}
+
+	entry, err := HeadEntry("run.sh")
+	if err != nil || entry == nil || entry.Mode != "100755" || entry.Sha != "0123456789abcdef" {
+		t.Errorf("expected the entry of run.sh, got %v, %v", entry, err)
+	}
+	if entry, err = HeadEntry("new.txt"); err != nil || entry != nil {
+		t.Errorf("expected no entry for new.txt, got %v, %v", entry, err)
+	}
+	if entry, err = HeadEntry("no-head.txt"); err != nil || entry != nil {
+		t.Errorf("expected no entry without HEAD, got %v, %v", entry, err)
+	}
+}
+
 // Helper function to compare slices
 func equal(a, b []string) bool {
 	if len(a) != len(b) {
@@ -0,0 +1,180 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/cli/go-gh/pkg/api"
+	"github.com/fatih/color"
+	"net/http"
+	"strings"
+)
+
+// BranchRule is a ruleset rule that applies to a branch.
+type BranchRule struct {
+	Type      string `json:"type"`
+	RulesetId int    `json:"ruleset_id"`
+}
+
+// rulesBlockingUpdates are the ruleset rules that reject commits pushed straight to a branch.
+var rulesBlockingUpdates = map[string]string{
+	"pull_request":           "changes must be made through a pull request",
+	"required_status_checks": "status checks must pass before changes are accepted",
+	"required_deployments":   "deployments must succeed before changes are accepted",
+	"update":                 "the branch cannot be updated",
+	"merge_queue":            "changes must go through the merge queue",
+}
+
+// harmlessRules never reject a fast-forward commit made through the API, and say why.
+var harmlessRules = map[string]string{
+	"creation":                "only allowed users may create the branch",
+	"deletion":                "the branch cannot be deleted",
+	"non_fast_forward":        "force pushes are blocked, and the commit fast-forwards the branch",
+	"required_linear_history": "history must be linear, and the commit fast-forwards the branch",
+	"required_signatures":     "commits must be signed, and commits made through the API are signed by GitHub",
+}
+
+// BranchGuard is a reason not to commit to a branch.
+type BranchGuard struct {
+	Problem string
+	// SolvedByPr is set when committing through a pull request gets around the guard
+	SolvedByPr bool
+}
+
+// GetBranchRules lists the ruleset rules that apply to a branch. Hosts without rulesets
+// report none.
+func GetBranchRules(ctx context.Context, branch string) ([]BranchRule, error) {
+	var rules []BranchRule
+	err := client.DoWithContext(ctx, http.MethodGet, fmt.Sprintf("repos/%s/%s/rules/branches/%s", repo.Owner(), repo.Name(), branch), nil, &rules)
+	if err != nil {
+		if httpErr, ok := err.(api.HTTPError); ok && httpErr.StatusCode == http.StatusNotFound {
+			return nil, nil
+		}
+		return nil, errors.New(fmt.Sprint("error getting branch rules: ", err))
+	}
+	return rules, nil
+}
+
+// BranchGuards lists what stands in the way of the commit: the default branch and branch
+// protection, for direct commits without --allow-protected, and the rulesets of the branch
+// the commit goes to. Every rule is listed as it is found, so its requirements are known
+// before anything is written.
+func (rn *RunSettings) BranchGuards(ctx context.Context) ([]BranchGuard, error) {
+	target := rn.CommitSettings.CommitToBranch
+	direct := rn.PrSettings == nil
+
+	branch, err := GetBranch(ctx, target)
+	if err != nil {
+		return nil, err
+	}
+	rules, err := GetBranchRules(ctx, target)
+	if err != nil {
+		return nil, err
+	}
+
+	var guards []BranchGuard
+	if direct && !rn.AllowProtected {
+		if target == rn.RepoSettings.DefaultBranch {
+			guards = append(guards, BranchGuard{
+				Problem:    fmt.Sprintf("%s is the default branch of %s/%s", target, repo.Owner(), repo.Name()),
+				SolvedByPr: true,
+			})
+		}
+		if branch != nil && branch.Protected {
+			guards = append(guards, BranchGuard{Problem: fmt.Sprintf("%s is a protected branch", target), SolvedByPr: true})
+		}
+	}
+
+	if len(rules) > 0 {
+		fmt.Fprintf(out, "%s\n", color.New(color.FgCyan, color.Bold).Sprintf("🛡️  Rules of %s:", target))
+	}
+	for _, rule := range rules {
+		ruleset := color.New(color.FgHiBlack).Sprintf("(ruleset %d)", rule.RulesetId)
+		if reason, blocks := rulesBlockingUpdates[rule.Type]; blocks {
+			fmt.Fprintf(out, "   - %s %s: %s\n", color.New(color.FgRed).Sprint(rule.Type), ruleset, reason)
+			if rn.AllowProtected {
+				warn(fmt.Sprintf("Ruleset %d will reject the commit to %s unless the token may bypass it", rule.RulesetId, target))
+				continue
+			}
+			guards = append(guards, BranchGuard{
+				Problem:    fmt.Sprintf("ruleset %d protects %s: %s", rule.RulesetId, target, reason),
+				SolvedByPr: direct && rule.Type != "update",
+			})
+		} else if note, known := harmlessRules[rule.Type]; known {
+			fmt.Fprintf(out, "   - %s %s: %s\n", rule.Type, ruleset, note)
+			if rule.Type == "creation" && branch == nil {
+				guards = append(guards, BranchGuard{Problem: fmt.Sprintf("ruleset %d does not allow creating %s", rule.RulesetId, target)})
+			}
+		} else {
+			fmt.Fprintf(out, "   - %s %s\n", color.New(color.FgYellow).Sprint(rule.Type), ruleset)
+			warn(fmt.Sprintf("Ruleset %d applies a %s rule to %s, which may reject the commit", rule.RulesetId, rule.Type, target))
+		}
+	}
+	return guards, nil
+}
+
+// switchToPr commits through the pull request of --auto-pr instead, if that gets around
+// every guard, and reports whether it did.
+func (rn *RunSettings) switchToPr(guards []BranchGuard) bool {
+	if rn.AutoPr == nil || rn.PrSettings != nil || len(guards) == 0 {
+		return false
+	}
+	for _, guard := range guards {
+		if !guard.SolvedByPr {
+			return false
+		}
+	}
+
+	fmt.Fprintf(out, "%s %s, so the commit goes through a pull request from %s instead\n",
+		color.New(color.FgYellow).Sprint("↪️ "), guards[0].Problem, rn.AutoPr.HeadRef)
+	rn.PrSettings = rn.AutoPr
+	rn.CommitSettings.CommitToBranch = rn.AutoPr.HeadRef
+	rn.Result.Branch = rn.AutoPr.HeadRef
+	rn.Result.BaseBranch = rn.AutoPr.BaseRef
+	return true
+}
+
+// GuardBranch refuses to commit past the guards of the branch before anything is written,
+// or switches to a pull request with --auto-pr. Forks get their own branches, which no
+// guard of the upstream applies to.
+func (rn *RunSettings) GuardBranch(ctx context.Context) error {
+	if rn.Fork {
+		return nil
+	}
+
+	guards, err := rn.BranchGuards(ctx)
+	if err != nil {
+		return err
+	}
+	if rn.switchToPr(guards) {
+		if len(rn.PrSettings.Labels) > 0 && !rn.DryRun {
+			if err = ValidateAllLabels(ctx, rn.PrSettings.Labels); err != nil {
+				return err
+			}
+		}
+		return rn.GuardBranch(ctx)
+	}
+	if len(guards) == 0 {
+		return nil
+	}
+
+	problems := make([]string, 0, len(guards))
+	for _, guard := range guards {
+		problems = append(problems, guard.Problem)
+	}
+	return fmt.Errorf("refusing to commit to %s: %s%s",
+		rn.CommitSettings.CommitToBranch, strings.Join(problems, "; "), guardHint(guards))
+}
+
+// guardHint suggests a way around the guards, if a pull request or --allow-protected is one.
+func guardHint(guards []BranchGuard) string {
+	for _, guard := range guards {
+		if !guard.SolvedByPr {
+			return ""
+		}
+	}
+	if len(guards) == 0 {
+		return ""
+	}
+	return ". Use --use-pr or --auto-pr to open a pull request instead, or --allow-protected if the token may bypass the protection"
+}
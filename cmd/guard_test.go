@@ -0,0 +1,190 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/cli/go-gh/pkg/api"
+	"github.com/cli/go-gh/pkg/repository"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// MockRESTClient is a mock implementation of api.RESTClient for testing. GET requests are
+// answered from Responses, keyed by path, and anything else is a 404. Writes are recorded
+// in Calls.
+type MockRESTClient struct {
+	api.RESTClient
+	Responses map[string]string
+	Calls     []string
+}
+
+// DoWithContext records requests that write, and answers them from Responses keyed by
+// method and path. Reads are answered from Responses keyed by path, or fail with a 404.
+func (m *MockRESTClient) DoWithContext(ctx context.Context, method string, path string, body io.Reader, response interface{}) error {
+	switch method {
+	case http.MethodGet:
+		return m.get(path, response)
+	case http.MethodDelete:
+		m.Calls = append(m.Calls, "DELETE "+path)
+		return nil
+	}
+
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return err
+	}
+	m.Calls = append(m.Calls, fmt.Sprintf("%s %s %s", method, path, data))
+	if answer, ok := m.Responses[method+" "+path]; ok && response != nil {
+		return json.Unmarshal([]byte(answer), response)
+	}
+	return nil
+}
+
+func (m *MockRESTClient) get(path string, response interface{}) error {
+	body, ok := m.Responses[path]
+	if !ok {
+		return api.HTTPError{StatusCode: http.StatusNotFound, Message: "Not Found"}
+	}
+	if response == nil {
+		return nil
+	}
+	return json.Unmarshal([]byte(body), response)
+}
+
+func TestBranchGuards(t *testing.T) {
+	target, err := repository.Parse("kassett/gh-commit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	originalRepo, originalClient, originalOut := repo, client, out
+	defer func() { repo, client, out = originalRepo, originalClient, originalOut }()
+	repo = target
+	out = &bytes.Buffer{}
+
+	responses := map[string]string{
+		"repos/kassett/gh-commit/branches/main":         `{"commit": {"sha": "abc"}, "protected": false}`,
+		"repos/kassett/gh-commit/branches/release":      `{"commit": {"sha": "abc"}, "protected": true}`,
+		"repos/kassett/gh-commit/branches/ruled":        `{"commit": {"sha": "abc"}, "protected": false}`,
+		"repos/kassett/gh-commit/rules/branches/ruled":  `[{"type": "pull_request", "ruleset_id": 1}, {"type": "required_signatures", "ruleset_id": 1}]`,
+		"repos/kassett/gh-commit/rules/branches/frozen": `[{"type": "update", "ruleset_id": 2}]`,
+		"repos/kassett/gh-commit/rules/branches/main-1": `[{"type": "creation", "ruleset_id": 3}]`,
+	}
+	client = &MockRESTClient{Responses: responses}
+
+	tests := []struct {
+		name             string
+		branch           string
+		headRef          string
+		allowProtected   bool
+		expectedProblems []string
+		expectedSolvable bool
+	}{
+		{name: "Unprotected branch", branch: "feature"},
+		{
+			name:             "Default branch",
+			branch:           "main",
+			expectedProblems: []string{"main is the default branch of kassett/gh-commit"},
+			expectedSolvable: true,
+		},
+		{name: "Default branch with --allow-protected", branch: "main", allowProtected: true},
+		{name: "Pull request into the default branch", branch: "main", headRef: "main-2"},
+		{
+			name:             "Protected branch",
+			branch:           "release",
+			expectedProblems: []string{"release is a protected branch"},
+			expectedSolvable: true,
+		},
+		{
+			name:             "Ruleset requiring a pull request",
+			branch:           "ruled",
+			expectedProblems: []string{"ruleset 1 protects ruled: changes must be made through a pull request"},
+			expectedSolvable: true,
+		},
+		{
+			name:             "Ruleset restricting updates",
+			branch:           "frozen",
+			expectedProblems: []string{"ruleset 2 protects frozen: the branch cannot be updated"},
+		},
+		{name: "Ruleset with --allow-protected", branch: "ruled", allowProtected: true},
+		{
+			name:             "Ruleset restricting the creation of the head ref",
+			branch:           "main",
+			headRef:          "main-1",
+			expectedProblems: []string{"ruleset 3 does not allow creating main-1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rn := &RunSettings{
+				CommitSettings: &CommitSettings{CommitToBranch: tt.branch},
+				RepoSettings:   &RepoSettings{DefaultBranch: "main"},
+				AllowProtected: tt.allowProtected,
+			}
+			if tt.headRef != "" {
+				rn.PrSettings = &PrSettings{BaseRef: tt.branch, HeadRef: tt.headRef}
+				rn.CommitSettings.CommitToBranch = rn.PrSettings.HeadRef
+			}
+
+			guards, err := rn.BranchGuards(context.Background())
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			var problems []string
+			for _, guard := range guards {
+				problems = append(problems, guard.Problem)
+			}
+			if !equal(problems, tt.expectedProblems) {
+				t.Errorf("expected problems %v, got %v", tt.expectedProblems, problems)
+			}
+			if solvable := guardHint(guards) != ""; solvable != tt.expectedSolvable {
+				t.Errorf("expected a PR to solve the problems: %v, got %v", tt.expectedSolvable, solvable)
+			}
+		})
+	}
+}
+
+func TestGuardBranchSwitchesToPr(t *testing.T) {
+	target, err := repository.Parse("kassett/gh-commit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	originalRepo, originalClient, originalOut := repo, client, out
+	defer func() { repo, client, out = originalRepo, originalClient, originalOut }()
+	repo = target
+	out = &bytes.Buffer{}
+	client = &MockRESTClient{Responses: map[string]string{
+		"repos/kassett/gh-commit/branches/main": `{"commit": {"sha": "abc"}, "protected": true}`,
+	}}
+
+	newSettings := func(autoPr bool) *RunSettings {
+		rn := &RunSettings{
+			CommitSettings: &CommitSettings{CommitMessage: "chore: update", CommitToBranch: "main"},
+			RepoSettings:   &RepoSettings{DefaultBranch: "main"},
+		}
+		if autoPr {
+			rn.AutoPr = &PrSettings{BaseRef: "main", HeadRef: "main-update", Title: "chore: update"}
+		}
+		rn.Result = rn.NewRunResult()
+		return rn
+	}
+
+	rn := newSettings(false)
+	err = rn.GuardBranch(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "refusing to commit to main") || !strings.Contains(err.Error(), "--auto-pr") {
+		t.Errorf("expected the commit to be refused with a hint, got %v", err)
+	}
+
+	rn = newSettings(true)
+	if err = rn.GuardBranch(context.Background()); err != nil {
+		t.Fatalf("expected the commit to switch to a PR, got %v", err)
+	}
+	if rn.PrSettings == nil || rn.CommitSettings.CommitToBranch != "main-update" || rn.Result.Branch != "main-update" {
+		t.Errorf("expected the commit to go to main-update through a PR, got %s", rn.CommitSettings.CommitToBranch)
+	}
+}
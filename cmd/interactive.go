@@ -0,0 +1,146 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"github.com/fatih/color"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+const pickerHelp = "Toggle files by number or range (e.g. 1 3-5), a = all, n = none, d <number> = diff, " +
+	"enter = done, q = quit"
+
+// SelectFilesInteractively lets the user pick files among the changed, staged and untracked
+// files of the work tree. Tracked files start out selected, untracked ones only with
+// --untracked. Renamed files bring the deletion of their old path along.
+func SelectFilesInteractively(commitUntracked bool) ([]string, error) {
+	entries, err := ListStatus()
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, errors.New("the work tree has no changes to pick from")
+	}
+
+	selected := make([]bool, len(entries))
+	for i, entry := range entries {
+		selected[i] = entry.Index != '?' || commitUntracked
+	}
+
+	if err = PickFiles(entries, selected, ShowLocalDiff); err != nil {
+		return nil, err
+	}
+
+	var files []string
+	for i, entry := range entries {
+		if !selected[i] {
+			continue
+		}
+		if entry.OldPath != "" {
+			files = append(files, entry.OldPath)
+		}
+		files = append(files, entry.Path)
+	}
+	if len(files) == 0 {
+		return nil, errors.New("no files were selected for commit")
+	}
+	return files, nil
+}
+
+// PickFiles shows the entries and toggles their selection until the user is done.
+func PickFiles(entries []StatusEntry, selected []bool, showDiff func(StatusEntry) error) error {
+	for {
+		printPicker(entries, selected)
+		fmt.Fprintf(out, "%s\n> ", color.New(color.FgHiBlack).Sprint(pickerHelp))
+		answer, err := readAnswer()
+		if err != nil {
+			return err
+		}
+
+		command, rest, _ := strings.Cut(answer, " ")
+		switch strings.ToLower(command) {
+		case "":
+			return nil
+		case "q":
+			return errCancelled
+		case "a", "n":
+			for i := range selected {
+				selected[i] = command == "a"
+			}
+		case "d":
+			index, err := strconv.Atoi(strings.TrimSpace(rest))
+			if err != nil || index < 1 || index > len(entries) {
+				warn(fmt.Sprintf("Expected the number of a file after d, got %q", rest))
+				continue
+			}
+			if err = showDiff(entries[index-1]); err != nil {
+				return err
+			}
+		default:
+			indexes, err := parseSelection(answer, len(entries))
+			if err != nil {
+				warn(err.Error())
+				continue
+			}
+			for _, index := range indexes {
+				selected[index] = !selected[index]
+			}
+		}
+	}
+}
+
+func printPicker(entries []StatusEntry, selected []bool) {
+	fmt.Fprintf(out, "\n%s\n", color.New(color.FgCyan, color.Bold).Sprint("📝 Pick the files to commit:"))
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	for i, entry := range entries {
+		index := color.New(color.FgYellow).Sprintf("%d.", i+1)
+		check := "[ ]"
+		if selected[i] {
+			check = color.New(color.FgGreen).Sprint("[x]")
+		}
+		name := entry.Path
+		if entry.OldPath != "" {
+			name = fmt.Sprintf("%s → %s", entry.OldPath, entry.Path)
+		}
+		_, _ = fmt.Fprintf(w, "   %s\t%s\t%s\t%s\n", index, check, color.New(color.FgHiBlack).Sprint(entry.Describe()), name)
+	}
+	_ = w.Flush()
+}
+
+// parseSelection reads the numbers and ranges typed at the picker, e.g. "1 3-5", and
+// returns them as zero-based indexes.
+func parseSelection(answer string, count int) ([]int, error) {
+	var indexes []int
+	for _, field := range strings.FieldsFunc(answer, func(r rune) bool { return r == ' ' || r == ',' }) {
+		from, to, isRange := strings.Cut(field, "-")
+		first, err := strconv.Atoi(from)
+		last := first
+		if err == nil && isRange {
+			last, err = strconv.Atoi(to)
+		}
+		if err != nil || first < 1 || last > count || first > last {
+			return nil, fmt.Errorf("%q is not a file number or range between 1 and %d", field, count)
+		}
+		for i := first; i <= last; i++ {
+			indexes = append(indexes, i-1)
+		}
+	}
+	return indexes, nil
+}
+
+// ShowLocalDiff prints the diff of a file in the work tree against HEAD.
+func ShowLocalDiff(entry StatusEntry) error {
+	changes := ChangesFromPaths([]string{entry.Path})
+	planned, err := PlanChanges(changes, HeadEntry)
+	if err != nil {
+		return err
+	}
+	if planned[0].Status == "unchanged" {
+		fmt.Fprintf(out, "%s does not differ from HEAD\n", entry.Path)
+		return nil
+	}
+	fmt.Fprintln(out)
+	return PrintDiffs(planned, ReadBlob)
+}
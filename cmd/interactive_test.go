@@ -0,0 +1,151 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"github.com/cli/go-gh/pkg/repository"
+	"strings"
+	"testing"
+)
+
+func TestParseSelection(t *testing.T) {
+	tests := []struct {
+		name            string
+		answer          string
+		expectedIndexes []int
+		expectedError   bool
+	}{
+		{name: "Single number", answer: "2", expectedIndexes: []int{1}},
+		{name: "Numbers and ranges", answer: "1 3-4,5", expectedIndexes: []int{0, 2, 3, 4}},
+		{name: "Out of range", answer: "6", expectedError: true},
+		{name: "Backwards range", answer: "4-2", expectedError: true},
+		{name: "Not a number", answer: "x", expectedError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			indexes, err := parseSelection(tt.answer, 5)
+			if (err != nil) != tt.expectedError {
+				t.Fatalf("expected error: %v, got: %v", tt.expectedError, err)
+			}
+			if len(indexes) != len(tt.expectedIndexes) {
+				t.Fatalf("expected %v, got %v", tt.expectedIndexes, indexes)
+			}
+			for i := range indexes {
+				if indexes[i] != tt.expectedIndexes[i] {
+					t.Errorf("expected %v, got %v", tt.expectedIndexes, indexes)
+				}
+			}
+		})
+	}
+}
+
+func TestPickFiles(t *testing.T) {
+	entries := []StatusEntry{
+		{Index: ' ', WorkTree: 'M', Path: "a.txt"},
+		{Index: 'M', WorkTree: ' ', Path: "b.txt"},
+		{Index: '?', WorkTree: '?', Path: "c.txt"},
+	}
+
+	tests := []struct {
+		name             string
+		input            string
+		expectedSelected []bool
+		expectedDiffs    []string
+		expectedError    error
+	}{
+		{name: "Accept the defaults", input: "\n", expectedSelected: []bool{true, true, false}},
+		{name: "Toggle", input: "1 3\n\n", expectedSelected: []bool{false, true, true}},
+		{name: "None then one", input: "n\n2\n\n", expectedSelected: []bool{false, true, false}},
+		{name: "All", input: "a\n\n", expectedSelected: []bool{true, true, true}},
+		{name: "Invalid input is ignored", input: "9\nd x\n\n", expectedSelected: []bool{true, true, false}},
+		{name: "Diff", input: "d 3\n\n", expectedSelected: []bool{true, true, false}, expectedDiffs: []string{"c.txt"}},
+		{name: "Quit", input: "q\n", expectedSelected: []bool{true, true, false}, expectedError: errCancelled},
+	}
+
+	originalInput, originalOut := promptInput, out
+	defer func() { promptInput, out = originalInput, originalOut }()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			promptInput = bufio.NewReader(strings.NewReader(tt.input))
+			out = &bytes.Buffer{}
+
+			selected := []bool{true, true, false}
+			var diffs []string
+			err := PickFiles(entries, selected, func(entry StatusEntry) error {
+				diffs = append(diffs, entry.Path)
+				return nil
+			})
+
+			if !errors.Is(err, tt.expectedError) {
+				t.Fatalf("expected error %v, got %v", tt.expectedError, err)
+			}
+			for i := range selected {
+				if selected[i] != tt.expectedSelected[i] {
+					t.Errorf("expected selection %v, got %v", tt.expectedSelected, selected)
+					break
+				}
+			}
+			if !equal(diffs, tt.expectedDiffs) {
+				t.Errorf("expected diffs of %v, got %v", tt.expectedDiffs, diffs)
+			}
+		})
+	}
+}
+
+func TestConfirmation(t *testing.T) {
+	originalRepo := repo
+	defer func() { repo = originalRepo }()
+	target, err := repository.Parse("kassett/gh-commit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo = target
+
+	repoSettings := &RepoSettings{DefaultBranch: "main"}
+	tests := []struct {
+		name     string
+		settings *RunSettings
+		expected bool
+	}{
+		{
+			name:     "Default branch",
+			settings: &RunSettings{CommitSettings: &CommitSettings{CommitToBranch: "main"}, RepoSettings: repoSettings},
+			expected: true,
+		},
+		{
+			name:     "Default branch with --yes",
+			settings: &RunSettings{CommitSettings: &CommitSettings{CommitToBranch: "main"}, RepoSettings: repoSettings, Yes: true},
+			expected: false,
+		},
+		{
+			name:     "Other branch",
+			settings: &RunSettings{CommitSettings: &CommitSettings{CommitToBranch: "dev"}, RepoSettings: repoSettings},
+			expected: false,
+		},
+		{
+			name: "Pull request into the default branch",
+			settings: &RunSettings{
+				PrSettings:     &PrSettings{BaseRef: "main", HeadRef: "main-1"},
+				CommitSettings: &CommitSettings{CommitToBranch: "main-1"},
+				RepoSettings:   repoSettings,
+			},
+			expected: false,
+		},
+		{
+			name:     "Interactive",
+			settings: &RunSettings{CommitSettings: &CommitSettings{CommitToBranch: "dev"}, RepoSettings: repoSettings, Interactive: true},
+			expected: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if asked := tt.settings.confirmation() != ""; asked != tt.expected {
+				t.Errorf("expected a confirmation: %v, got %v", tt.expected, asked)
+			}
+		})
+	}
+}
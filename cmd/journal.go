@@ -0,0 +1,91 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"github.com/fatih/color"
+	"strings"
+)
+
+// Mutation is a change made to the remote during a run, with the way to undo it.
+type Mutation struct {
+	Description string
+	Undo        func(ctx context.Context) error
+}
+
+// Journal records the remote mutations of a run, so that a run failing halfway can undo
+// them. Blobs, trees and commits are not recorded: nothing references them once the refs
+// are undone, and GitHub collects them.
+type Journal struct {
+	Mutations []Mutation
+	// leases holds the commits the run pointed each branch it created at, by owner/name:branch
+	leases map[string][]string
+}
+
+// journal is shared by the whole run, like repo and client, as mutations are made deep
+// within the API calls.
+var journal = &Journal{}
+
+// Record adds a mutation that was just made.
+func (j *Journal) Record(description string, undo func(ctx context.Context) error) {
+	j.Mutations = append(j.Mutations, Mutation{Description: description, Undo: undo})
+}
+
+// Lease adds a commit the run pointed a branch it created at. Deleting the branch undoes
+// creating and moving it alike, as long as it still points at one of them.
+func (j *Journal) Lease(branch, sha string) {
+	if j.leases == nil {
+		j.leases = map[string][]string{}
+	}
+	j.leases[branch] = append(j.leases[branch], sha)
+}
+
+// Leases returns the commits the run pointed a branch it created at.
+func (j *Journal) Leases(branch string) []string {
+	return j.leases[branch]
+}
+
+// Rollback undoes the mutations in reverse order and returns the ones that could not be
+// undone. Undoing carries on past failures, so as little as possible is left behind.
+func (j *Journal) Rollback(ctx context.Context) []string {
+	fmt.Fprintf(out, "%s\n", color.New(color.FgYellow, color.Bold).Sprintf("↩️  Rolling back %d change(s):", len(j.Mutations)))
+
+	var failures []string
+	for i := len(j.Mutations) - 1; i >= 0; i-- {
+		mutation := j.Mutations[i]
+		if err := mutation.Undo(ctx); err != nil {
+			fmt.Fprintf(out, "   %s %s: %s\n", color.New(color.FgRed).Sprint("✘"), mutation.Description, err)
+			failures = append(failures, fmt.Sprintf("%s: %s", mutation.Description, err))
+			continue
+		}
+		fmt.Fprintf(out, "   %s %s\n", color.New(color.FgGreen).Sprint("✔"), mutation.Description)
+	}
+	j.Mutations, j.leases = nil, nil
+	return failures
+}
+
+// RollBack undoes what a failed run changed on the remote, unless --keep-on-failure is
+// given, and returns the error the run failed with.
+func (rn *RunSettings) RollBack(ctx context.Context, err error) error {
+	if err == nil || len(journal.Mutations) == 0 {
+		return err
+	}
+
+	if rn.KeepOnFailure {
+		kept := make([]string, 0, len(journal.Mutations))
+		for _, mutation := range journal.Mutations {
+			kept = append(kept, mutation.Description)
+		}
+		warn(fmt.Sprintf("Keeping what the failed run changed: %s", strings.Join(kept, "; ")))
+		return err
+	}
+
+	// The run may have failed because its context ran out, which undoing cannot use
+	undoCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), rollbackTimeout)
+	defer cancel()
+
+	if failures := journal.Rollback(undoCtx); len(failures) > 0 {
+		return fmt.Errorf("%w; could not roll back: %s", err, strings.Join(failures, "; "))
+	}
+	return err
+}
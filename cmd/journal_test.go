@@ -0,0 +1,209 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/cli/go-gh/pkg/repository"
+	"strings"
+	"testing"
+)
+
+func TestJournalRollback(t *testing.T) {
+	originalOut := out
+	defer func() { out = originalOut }()
+	out = &bytes.Buffer{}
+
+	var undone []string
+	undo := func(name string, err error) func(context.Context) error {
+		return func(context.Context) error {
+			undone = append(undone, name)
+			return err
+		}
+	}
+
+	j := &Journal{}
+	j.Record("created head", undo("head", nil))
+	j.Record("moved head", undo("move", errors.New("head moved to 1234567 since, leaving it as is")))
+	j.Record("opened pull request #1", undo("pr", nil))
+
+	failures := j.Rollback(context.Background())
+	if !equal(undone, []string{"pr", "move", "head"}) {
+		t.Errorf("expected the mutations to be undone in reverse order, got %v", undone)
+	}
+	if !equal(failures, []string{"moved head: head moved to 1234567 since, leaving it as is"}) {
+		t.Errorf("unexpected failures: %v", failures)
+	}
+	if len(j.Mutations) != 0 {
+		t.Errorf("expected the journal to be empty after rolling back")
+	}
+}
+
+func TestRollBack(t *testing.T) {
+	originalOut, originalJournal := out, journal
+	defer func() { out, journal = originalOut, originalJournal }()
+	out = &bytes.Buffer{}
+
+	runErr := errors.New("error creating pull request: 422")
+	tests := []struct {
+		name           string
+		keepOnFailure  bool
+		runErr         error
+		undoErr        error
+		expectedUndone bool
+		expectedErr    string
+	}{
+		{name: "Successful run", runErr: nil},
+		{name: "Failed run", runErr: runErr, expectedUndone: true, expectedErr: runErr.Error()},
+		{name: "Failed run with --keep-on-failure", keepOnFailure: true, runErr: runErr, expectedErr: runErr.Error()},
+		{
+			name:           "Failed rollback",
+			runErr:         runErr,
+			undoErr:        errors.New("error deleting branch: 403"),
+			expectedUndone: true,
+			expectedErr:    "error creating pull request: 422; could not roll back: created main-1: error deleting branch: 403",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			undone := false
+			journal = &Journal{}
+			journal.Record("created main-1", func(context.Context) error {
+				undone = true
+				return tt.undoErr
+			})
+
+			rn := &RunSettings{KeepOnFailure: tt.keepOnFailure}
+			err := rn.RollBack(context.Background(), tt.runErr)
+			if undone != tt.expectedUndone {
+				t.Errorf("expected undone to be %v", tt.expectedUndone)
+			}
+			if tt.expectedErr == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.expectedErr || !errors.Is(err, tt.runErr) {
+				t.Errorf("expected error %q, got %v", tt.expectedErr, err)
+			}
+		})
+	}
+}
+
+func TestUndoBranches(t *testing.T) {
+	target, err := repository.Parse("kassett/gh-commit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	originalClient := client
+	defer func() { client = originalClient }()
+
+	branches := map[string]string{
+		"repos/kassett/gh-commit/branches/main-1":  `{"commit": {"sha": "new"}}`,
+		"repos/kassett/gh-commit/branches/feature": `{"commit": {"sha": "theirs"}}`,
+	}
+
+	tests := []struct {
+		name          string
+		undo          func(ctx context.Context) error
+		expectedCalls []string
+		expectedErr   string
+	}{
+		{
+			name:          "Delete a created branch",
+			undo:          func(ctx context.Context) error { return DeleteBranch(ctx, target, "main-1", "new") },
+			expectedCalls: []string{"DELETE repos/kassett/gh-commit/git/refs/heads/main-1"},
+		},
+		{
+			name:          "Delete a created branch the run moved",
+			undo:          func(ctx context.Context) error { return DeleteBranch(ctx, target, "main-1", "created", "new") },
+			expectedCalls: []string{"DELETE repos/kassett/gh-commit/git/refs/heads/main-1"},
+		},
+		{
+			name: "Delete a branch that is gone",
+			undo: func(ctx context.Context) error { return DeleteBranch(ctx, target, "gone", "new") },
+		},
+		{
+			name:        "Delete a branch that moved",
+			undo:        func(ctx context.Context) error { return DeleteBranch(ctx, target, "feature", "new") },
+			expectedErr: "feature moved to theirs since, leaving it as is",
+		},
+		{
+			name: "Restore a moved branch",
+			undo: func(ctx context.Context) error { return RestoreBranch(ctx, target, "main-1", "new", "old") },
+			expectedCalls: []string{
+				`PATCH repos/kassett/gh-commit/git/refs/heads/main-1 {"force":true,"sha":"old"}`,
+			},
+		},
+		{
+			name: "Restore a branch that never moved",
+			undo: func(ctx context.Context) error { return RestoreBranch(ctx, target, "feature", "new", "theirs") },
+		},
+		{
+			name:        "Restore a branch that moved again",
+			undo:        func(ctx context.Context) error { return RestoreBranch(ctx, target, "feature", "new", "old") },
+			expectedErr: "feature moved to theirs since, leaving it as is",
+		},
+		{
+			name:        "Restore a branch that is gone",
+			undo:        func(ctx context.Context) error { return RestoreBranch(ctx, target, "gone", "new", "old") },
+			expectedErr: "gone no longer exists",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := &MockRESTClient{Responses: branches}
+			client = mock
+
+			err := tt.undo(context.Background())
+			if tt.expectedErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectedErr) {
+					t.Errorf("expected error %q, got %v", tt.expectedErr, err)
+				}
+			} else if err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if !equal(mock.Calls, tt.expectedCalls) {
+				t.Errorf("expected calls %v, got %v", tt.expectedCalls, mock.Calls)
+			}
+		})
+	}
+}
+
+func TestUndoCreatedBranchThatMoved(t *testing.T) {
+	target, err := repository.Parse("kassett/gh-commit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	originalRepo, originalClient, originalJournal, originalOut := repo, client, journal, out
+	defer func() {
+		repo, client, journal, out = originalRepo, originalClient, originalJournal, originalOut
+	}()
+	repo, journal, out = target, &Journal{}, &bytes.Buffer{}
+	mock := &MockRESTClient{Responses: map[string]string{
+		"repos/kassett/gh-commit/branches/main-1": `{"commit": {"sha": "new"}}`,
+	}}
+	client = mock
+
+	recordCreatedBranch("main-1", "base")
+	if err := AssociateCommitWithBranch(context.Background(), "main-1", "base", "new"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(journal.Mutations) != 1 {
+		t.Fatalf("expected moving a created branch to be undone by deleting it, got %d mutations", len(journal.Mutations))
+	}
+
+	if failures := journal.Rollback(context.Background()); len(failures) > 0 {
+		t.Errorf("unexpected failures: %v", failures)
+	}
+	expectedCalls := []string{
+		`POST repos/kassett/gh-commit/git/refs/heads/main-1 {"sha":"new"}`,
+		"DELETE repos/kassett/gh-commit/git/refs/heads/main-1",
+	}
+	if !equal(mock.Calls, expectedCalls) {
+		t.Errorf("expected calls %v, got %v", expectedCalls, mock.Calls)
+	}
+}
@@ -0,0 +1,73 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+)
+
+// MapRule moves everything below Local to Remote in the remote tree.
+type MapRule struct {
+	Local  string
+	Remote string
+}
+
+// PathMapping translates selected paths into paths of the remote tree. The most specific
+// rule wins, and paths that no rule covers are placed under Prefix.
+type PathMapping struct {
+	Prefix string
+	Rules  []MapRule
+}
+
+// ParsePathMapping builds a mapping from the --prefix and --map values.
+func ParsePathMapping(prefix string, maps []string) (*PathMapping, error) {
+	mapping := &PathMapping{Prefix: cleanRemotePath(prefix)}
+	for _, m := range maps {
+		local, remote, found := cutDirMapping(m)
+		if !found {
+			return nil, fmt.Errorf("invalid mapping %q, expected the format local/dir:remote/dir", m)
+		}
+		mapping.Rules = append(mapping.Rules, MapRule{
+			Local:  cleanRemotePath(local),
+			Remote: remote,
+		})
+	}
+	return mapping, nil
+}
+
+// Remote returns where p ends up in the remote tree.
+func (pm *PathMapping) Remote(p string) string {
+	var best *MapRule
+	for i, rule := range pm.Rules {
+		if rule.Local != "" && p != rule.Local && !strings.HasPrefix(p, rule.Local+"/") {
+			continue
+		}
+		if best == nil || len(rule.Local) > len(best.Local) {
+			best = &pm.Rules[i]
+		}
+	}
+
+	if best == nil {
+		return joinRemotePath(pm.Prefix, p)
+	}
+	return joinRemotePath(best.Remote, strings.TrimPrefix(strings.TrimPrefix(p, best.Local), "/"))
+}
+
+// Apply rewrites the remote path of every change.
+func (pm *PathMapping) Apply(changes []FileChange) []FileChange {
+	mapped := make([]FileChange, 0, len(changes))
+	for _, change := range changes {
+		change.Path = pm.Remote(change.Path)
+		mapped = append(mapped, change)
+	}
+	return mapped
+}
+
+func joinRemotePath(dir, name string) string {
+	if dir == "" {
+		return name
+	}
+	if name == "" {
+		return dir
+	}
+	return dir + "/" + name
+}
@@ -0,0 +1,88 @@
+package cmd
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestPathMapping(t *testing.T) {
+	tests := []struct {
+		name          string
+		prefix        string
+		maps          []string
+		paths         []string
+		expectedPaths []string
+		expectedError error
+	}{
+		{
+			name:          "No mapping",
+			paths:         []string{"a.txt", "dir/b.txt"},
+			expectedPaths: []string{"a.txt", "dir/b.txt"},
+		},
+		{
+			name:          "Prefix",
+			prefix:        "/sdk/go/",
+			paths:         []string{"a.txt", "dir/b.txt"},
+			expectedPaths: []string{"sdk/go/a.txt", "sdk/go/dir/b.txt"},
+		},
+		{
+			name:          "Map directory",
+			maps:          []string{"build:sdk/go"},
+			paths:         []string{"build/client.go", "build/api/types.go", "buildinfo.txt"},
+			expectedPaths: []string{"sdk/go/client.go", "sdk/go/api/types.go", "buildinfo.txt"},
+		},
+		{
+			name:          "Most specific rule wins",
+			maps:          []string{"build:sdk", "build/docs:docs"},
+			paths:         []string{"build/a.go", "build/docs/index.md"},
+			expectedPaths: []string{"sdk/a.go", "docs/index.md"},
+		},
+		{
+			name:          "Unmapped files use the prefix",
+			prefix:        "vendor",
+			maps:          []string{"build:sdk"},
+			paths:         []string{"build/a.go", "LICENSE"},
+			expectedPaths: []string{"sdk/a.go", "vendor/LICENSE"},
+		},
+		{
+			name:          "Map to the root",
+			maps:          []string{"site/public:"},
+			paths:         []string{"site/public/index.html"},
+			expectedPaths: []string{"index.html"},
+		},
+		{
+			name:          "Local directory with a colon",
+			maps:          []string{"build/v1:2:sdk"},
+			paths:         []string{"build/v1:2/client.go"},
+			expectedPaths: []string{"sdk/client.go"},
+		},
+		{
+			name:          "Invalid mapping",
+			maps:          []string{"build"},
+			expectedError: errors.New(`invalid mapping "build", expected the format local/dir:remote/dir`),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mapping, err := ParsePathMapping(tt.prefix, tt.maps)
+
+			if err != nil && tt.expectedError != nil {
+				if err.Error() != tt.expectedError.Error() {
+					t.Errorf("expected error %v, got %v", tt.expectedError, err)
+				}
+				return
+			} else if err != nil || tt.expectedError != nil {
+				t.Fatalf("expected error %v, got %v", tt.expectedError, err)
+			}
+
+			var paths []string
+			for _, change := range mapping.Apply(ChangesFromPaths(tt.paths)) {
+				paths = append(paths, change.Path)
+			}
+			if !equal(paths, tt.expectedPaths) {
+				t.Errorf("expected paths %v, got %v", tt.expectedPaths, paths)
+			}
+		})
+	}
+}
@@ -0,0 +1,132 @@
+package cmd
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// MirrorSettings describes a remote directory that is made to match a local one.
+type MirrorSettings struct {
+	LocalDir  string
+	RemoteDir string
+	// Exclude holds --exclude patterns, matched relative to both directories
+	Exclude []string
+}
+
+// HashBlob computes the SHA git assigns to a blob with the given content, which lets
+// us tell whether a file differs from the remote tree without uploading it.
+func HashBlob(data []byte) string {
+	h := sha1.New()
+	_, _ = fmt.Fprintf(h, "blob %d\x00", len(data))
+	h.Write(data)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// ReadLocalFile reads a file the way git would store it: symlinks are stored as their
+// target, and the executable bit is kept.
+func ReadLocalFile(localPath string) ([]byte, string, error) {
+	info, err := os.Lstat(localPath)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if info.Mode()&os.ModeSymlink != 0 {
+		target, err := os.Readlink(localPath)
+		if err != nil {
+			return nil, "", err
+		}
+		return []byte(filepath.ToSlash(target)), "120000", nil
+	}
+
+	data, err := os.ReadFile(localPath)
+	if err != nil {
+		return nil, "", err
+	}
+	if info.Mode()&0o111 != 0 {
+		return data, "100755", nil
+	}
+	return data, "100644", nil
+}
+
+// Selection lists every local file at its remote path, before comparing with the remote tree.
+func (ms *MirrorSettings) Selection() ([]FileChange, error) {
+	files, err := ListSourceDirFiles(ms.LocalDir)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := make([]FileChange, 0, len(files))
+	for _, file := range files {
+		if isExcluded(ms.Exclude, file) {
+			continue
+		}
+		changes = append(changes, FileChange{
+			Path:      joinRemotePath(ms.RemoteDir, file),
+			LocalPath: filepath.Join(ms.LocalDir, filepath.FromSlash(file)),
+		})
+	}
+	return changes, nil
+}
+
+// Changes compares the local directory with the remote tree and returns only the files
+// that are new or differ, plus deletions for remote files that no longer exist locally.
+func (ms *MirrorSettings) Changes(remoteTree []TreeEntry) ([]FileChange, error) {
+	selection, err := ms.Selection()
+	if err != nil {
+		return nil, err
+	}
+
+	remoteFiles := make(map[string]TreeEntry)
+	for _, entry := range remoteTree {
+		if entry.Type != "blob" {
+			continue
+		}
+		if ms.RemoteDir != "" && !strings.HasPrefix(entry.Path, ms.RemoteDir+"/") {
+			continue
+		}
+		// Excluded files are neither uploaded nor deleted
+		if isExcluded(ms.Exclude, strings.TrimPrefix(entry.Path, ms.RemoteDir+"/")) {
+			continue
+		}
+		remoteFiles[entry.Path] = entry
+	}
+
+	var changes []FileChange
+	for _, change := range selection {
+		content, mode, err := ReadLocalFile(change.LocalPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", change.LocalPath, err)
+		}
+
+		remote, exists := remoteFiles[change.Path]
+		delete(remoteFiles, change.Path)
+		if exists && remote.Sha == HashBlob(content) && remote.Mode == mode {
+			continue
+		}
+
+		change.Content = content
+		change.Mode = mode
+		changes = append(changes, change)
+	}
+
+	// Whatever is left only exists remotely
+	for _, entry := range sortedEntries(remoteFiles) {
+		changes = append(changes, FileChange{Path: entry.Path, Mode: entry.Mode, Deleted: true})
+	}
+
+	return changes, nil
+}
+
+func sortedEntries(entries map[string]TreeEntry) []TreeEntry {
+	sorted := make([]TreeEntry, 0, len(entries))
+	for _, entry := range entries {
+		sorted = append(sorted, entry)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Path < sorted[j].Path })
+	return sorted
+}
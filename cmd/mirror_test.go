@@ -0,0 +1,104 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestHashBlob(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		expected string
+	}{
+		{name: "Empty blob", content: "", expected: "e69de29bb2d1d6434b8b29ae775ad8c2e48c5391"},
+		{name: "Hello world", content: "hello world\n", expected: "3b18e512dba79e4c8300dd08aeb37f8e728b8dad"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if sha := HashBlob([]byte(tt.content)); sha != tt.expected {
+				t.Errorf("expected sha %v, got %v", tt.expected, sha)
+			}
+		})
+	}
+}
+
+func TestMirrorChanges(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"unchanged.txt": "same\n",
+		"changed.txt":   "new content\n",
+		"sub/added.txt": "added\n",
+	}
+	for file, content := range files {
+		p := filepath.Join(dir, filepath.FromSlash(file))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	remoteTree := []TreeEntry{
+		{Path: "README.md", Mode: "100644", Type: "blob", Sha: HashBlob([]byte("outside\n"))},
+		{Path: "docs", Mode: "040000", Type: "tree", Sha: "tree"},
+		{Path: "docs/unchanged.txt", Mode: "100644", Type: "blob", Sha: HashBlob([]byte("same\n"))},
+		{Path: "docs/changed.txt", Mode: "100644", Type: "blob", Sha: HashBlob([]byte("old content\n"))},
+		{Path: "docs/stale/old.txt", Mode: "100644", Type: "blob", Sha: HashBlob([]byte("stale\n"))},
+	}
+
+	mirror := &MirrorSettings{LocalDir: dir, RemoteDir: "docs"}
+	changes, err := mirror.Changes(remoteTree)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]bool{
+		"docs/changed.txt":   false,
+		"docs/sub/added.txt": false,
+		"docs/stale/old.txt": true,
+	}
+	if len(changes) != len(expected) {
+		t.Fatalf("expected %d changes, got %v", len(expected), changes)
+	}
+	for _, change := range changes {
+		deleted, ok := expected[change.Path]
+		if !ok {
+			t.Errorf("unexpected change for %s", change.Path)
+			continue
+		}
+		if change.Deleted != deleted {
+			t.Errorf("expected deleted to be %v for %s", deleted, change.Path)
+		}
+		if !deleted && change.Content == nil {
+			t.Errorf("expected content to be loaded for %s", change.Path)
+		}
+	}
+}
+
+func TestMirrorChangesExclude(t *testing.T) {
+	dir := t.TempDir()
+	for file, content := range map[string]string{"index.html": "new\n", "secrets.env": "token\n"} {
+		if err := os.WriteFile(filepath.Join(dir, file), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	remoteTree := []TreeEntry{
+		{Path: "site/index.html", Mode: "100644", Type: "blob", Sha: HashBlob([]byte("old\n"))},
+		{Path: "site/CNAME", Mode: "100644", Type: "blob", Sha: HashBlob([]byte("example.com\n"))},
+	}
+
+	mirror := &MirrorSettings{LocalDir: dir, RemoteDir: "site", Exclude: []string{"*.env", "CNAME"}}
+	changes, err := mirror.Changes(remoteTree)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(changes) != 1 || changes[0].Path != "site/index.html" || changes[0].Deleted {
+		t.Errorf("expected only site/index.html to change, got %+v", changes)
+	}
+}
@@ -0,0 +1,196 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/fatih/color"
+	"github.com/mattn/go-isatty"
+	"io"
+	"os"
+	"time"
+)
+
+// ExitNoChanges is the exit code of runs that had nothing to commit.
+const ExitNoChanges = 3
+
+// out receives the human-readable output. With --json it is stderr, so that stdout only
+// carries the JSON document and can be piped into jq.
+var out io.Writer = os.Stdout
+
+// stdout receives the JSON document of --json.
+var stdout io.Writer = os.Stdout
+
+// currentResult is the result of the run in progress, so that a run failing anywhere
+// still prints its document with --json.
+var currentResult *RunResult
+
+// RunResult is the document printed by --json, for committed and dry runs alike.
+type RunResult struct {
+	Repository  string             `json:"repository"`
+	Branch      string             `json:"branch"`
+	BaseBranch  string             `json:"base_branch,omitempty"`
+	BaseSha     string             `json:"base_sha,omitempty"`
+	TreeSha     string             `json:"tree_sha,omitempty"`
+	CommitSha   string             `json:"commit_sha,omitempty"`
+	CommitUrl   string             `json:"commit_url,omitempty"`
+	DryRun      bool               `json:"dry_run"`
+	NoChanges   bool               `json:"no_changes"`
+	Files       []FileResult       `json:"files"`
+	PullRequest *PullRequestResult `json:"pull_request,omitempty"`
+	Problems    []string           `json:"problems,omitempty"`
+	Error       string             `json:"error,omitempty"`
+	TimingsMs   map[string]int64   `json:"timings_ms"`
+	start       time.Time
+	written     bool
+}
+
+type FileResult struct {
+	Path    string `json:"path"`
+	Source  string `json:"source,omitempty"`
+	Mode    string `json:"mode,omitempty"`
+	Status  string `json:"status"`
+	BlobSha string `json:"blob_sha,omitempty"`
+}
+
+type PullRequestResult struct {
+	Number int    `json:"number"`
+	Url    string `json:"url"`
+}
+
+// UseJSONOutput moves the human-readable output to stderr. Colors follow whether stderr,
+// rather than stdout, is a terminal.
+func UseJSONOutput() {
+	out = os.Stderr
+	color.NoColor = os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" ||
+		(!isatty.IsTerminal(os.Stderr.Fd()) && !isatty.IsCygwinTerminal(os.Stderr.Fd()))
+}
+
+// NewRunResult starts the result of a run, and the clock its timings are measured with.
+func (rn *RunSettings) NewRunResult() *RunResult {
+	result := &RunResult{
+		Branch:    rn.CommitSettings.CommitToBranch,
+		DryRun:    rn.DryRun,
+		Files:     []FileResult{},
+		TimingsMs: make(map[string]int64),
+		start:     time.Now(),
+	}
+	if repo != nil {
+		result.Repository = fmt.Sprintf("%s/%s", repo.Owner(), repo.Name())
+	}
+	if rn.PrSettings != nil {
+		result.BaseBranch = rn.PrSettings.BaseRef
+	}
+	currentResult = result
+	return result
+}
+
+// SetCommit records the new commit along with its web URL.
+func (r *RunResult) SetCommit(sha string) {
+	r.CommitSha = sha
+	if repo != nil {
+		r.CommitUrl = fmt.Sprintf("https://%s/%s/%s/commit/%s", repo.Host(), repo.Owner(), repo.Name(), sha)
+	}
+}
+
+// Track records how long a phase of the run took, in milliseconds.
+func (r *RunResult) Track(phase string, since time.Time) {
+	r.TimingsMs[phase] = time.Since(since).Milliseconds()
+}
+
+// SetFiles lists the selected files, before anything was uploaded.
+func (r *RunResult) SetFiles(changes []FileChange) {
+	r.Files = make([]FileResult, 0, len(changes))
+	for _, change := range changes {
+		file := FileResult{Path: change.Path, Mode: change.Mode, Status: "updated"}
+		if change.LocalPath != "" && change.LocalPath != change.Path {
+			file.Source = change.LocalPath
+		}
+		if change.Deleted {
+			file.Status = "deleted"
+		}
+		r.Files = append(r.Files, file)
+	}
+}
+
+// SetPlan lists the files of a dry run, compared with the remote tree.
+func (r *RunResult) SetPlan(planned []PlannedChange) {
+	r.Files = make([]FileResult, 0, len(planned))
+	for _, plan := range planned {
+		file := FileResult{Path: plan.Path, Mode: plan.Mode, Status: plan.Status, BlobSha: plan.LocalSha}
+		if plan.LocalPath != "" && plan.LocalPath != plan.Path {
+			file.Source = plan.LocalPath
+		}
+		r.Files = append(r.Files, file)
+	}
+}
+
+// SetBlobs lists the files as they were written to the tree. Files that disappeared
+// locally after being selected show up as deletions.
+func (r *RunResult) SetBlobs(changes []FileChange, blobs []BlobInfo) {
+	r.SetFiles(changes)
+	for i, blob := range blobs {
+		if i >= len(r.Files) {
+			break
+		}
+		r.Files[i].Mode = blob.Mode
+		if blob.Sha == nil {
+			r.Files[i].Status = "deleted"
+		} else {
+			r.Files[i].BlobSha = *blob.Sha
+		}
+	}
+}
+
+// MarkUnchanged sets the status of the files whose blob and mode match the remote tree,
+// or that were deleted but never existed, to unchanged.
+func (r *RunResult) MarkUnchanged(lookup func(string) (*TreeEntry, error)) error {
+	for i, file := range r.Files {
+		remote, err := lookup(file.Path)
+		if err != nil {
+			return err
+		}
+		if remote != nil && remote.Type != "blob" {
+			remote = nil
+		}
+		if file.Status == "deleted" && remote == nil ||
+			remote != nil && remote.Sha == file.BlobSha && remote.Mode == file.Mode {
+			r.Files[i].Status = "unchanged"
+		}
+	}
+	return nil
+}
+
+// ChangedFiles lists the paths of the files that change the tree.
+func (r *RunResult) ChangedFiles() []string {
+	var paths []string
+	for _, file := range r.Files {
+		if file.Status != "unchanged" {
+			paths = append(paths, file.Path)
+		}
+	}
+	return paths
+}
+
+// Write prints the result to stdout, finishing its total timing.
+func (r *RunResult) Write() error {
+	r.Track("total", r.start)
+	r.written = true
+	encoder := json.NewEncoder(stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(r)
+}
+
+// WriteFailure prints the result of a run that failed, with its error, unless it was
+// printed already. A run that failed before it started prints a document with the error
+// alone.
+func WriteFailure(err error) {
+	r := currentResult
+	if r == nil {
+		r = &RunResult{Files: []FileResult{}, TimingsMs: make(map[string]int64), start: time.Now()}
+	}
+	if r.written {
+		return
+	}
+	r.Error = err.Error()
+	_ = r.Write()
+}
@@ -0,0 +1,113 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestRunResultSetBlobs(t *testing.T) {
+	blobSha := "3b18e512dba79e4c8300dd08aeb37f8e728b8dad"
+	changes := []FileChange{
+		{Path: "docs/a.txt", LocalPath: "a.txt"},
+		{Path: "gone.txt", LocalPath: "gone.txt"},
+		{Path: "old.txt", Deleted: true},
+	}
+	blobs := []BlobInfo{
+		{Path: "docs/a.txt", Mode: "100644", Type: "blob", Sha: &blobSha},
+		{Path: "gone.txt", Mode: "100644", Type: "blob"},
+		{Path: "old.txt", Mode: "100644", Type: "blob"},
+	}
+
+	result := &RunResult{}
+	result.SetBlobs(changes, blobs)
+
+	expected := []FileResult{
+		{Path: "docs/a.txt", Source: "a.txt", Mode: "100644", Status: "updated", BlobSha: blobSha},
+		{Path: "gone.txt", Mode: "100644", Status: "deleted"},
+		{Path: "old.txt", Mode: "100644", Status: "deleted"},
+	}
+	if !reflect.DeepEqual(result.Files, expected) {
+		t.Errorf("expected files %+v, got %+v", expected, result.Files)
+	}
+}
+
+func TestRunResultMarkUnchanged(t *testing.T) {
+	remote := map[string]*TreeEntry{
+		"same.txt":  {Path: "same.txt", Mode: "100644", Type: "blob", Sha: "same"},
+		"moved.txt": {Path: "moved.txt", Mode: "100644", Type: "blob", Sha: "old"},
+		"exec.sh":   {Path: "exec.sh", Mode: "100644", Type: "blob", Sha: "exec"},
+		"gone.txt":  {Path: "gone.txt", Mode: "100644", Type: "blob", Sha: "gone"},
+	}
+	result := &RunResult{Files: []FileResult{
+		{Path: "same.txt", Mode: "100644", Status: "updated", BlobSha: "same"},
+		{Path: "moved.txt", Mode: "100644", Status: "updated", BlobSha: "new"},
+		{Path: "exec.sh", Mode: "100755", Status: "updated", BlobSha: "exec"},
+		{Path: "gone.txt", Mode: "100644", Status: "deleted"},
+		{Path: "never.txt", Mode: "100644", Status: "deleted"},
+	}}
+	if err := result.MarkUnchanged(func(p string) (*TreeEntry, error) { return remote[p], nil }); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"moved.txt", "exec.sh", "gone.txt"}
+	if changed := result.ChangedFiles(); !equal(changed, expected) {
+		t.Errorf("expected changed files %v, got %v", expected, changed)
+	}
+}
+
+func TestWriteFailure(t *testing.T) {
+	originalStdout, originalResult := stdout, currentResult
+	defer func() { stdout, currentResult = originalStdout, originalResult }()
+	failure := errors.New("pull request #7 could not be labelled")
+
+	tests := []struct {
+		name          string
+		result        *RunResult
+		expectedError string
+		expectedSha   string
+	}{
+		{
+			name:          "Run that failed halfway",
+			result:        &RunResult{Repository: "kassett/gh-commit", CommitSha: "abc", Files: []FileResult{}, TimingsMs: map[string]int64{}},
+			expectedError: failure.Error(),
+			expectedSha:   "abc",
+		},
+		{
+			name:          "Run that failed before it started",
+			expectedError: failure.Error(),
+		},
+		{
+			name:   "Run whose result was printed already",
+			result: &RunResult{Files: []FileResult{}, TimingsMs: map[string]int64{}, written: true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buffer := &bytes.Buffer{}
+			stdout, currentResult = buffer, tt.result
+
+			WriteFailure(failure)
+			if tt.expectedError == "" {
+				if buffer.Len() > 0 {
+					t.Errorf("expected nothing more to be printed, got %s", buffer)
+				}
+				return
+			}
+
+			var document map[string]interface{}
+			if err := json.Unmarshal(buffer.Bytes(), &document); err != nil {
+				t.Fatalf("expected a JSON document, got %q: %v", buffer, err)
+			}
+			if document["error"] != tt.expectedError {
+				t.Errorf("expected error %q, got %v", tt.expectedError, document["error"])
+			}
+			if sha, _ := document["commit_sha"].(string); sha != tt.expectedSha {
+				t.Errorf("expected commit_sha %q, got %q", tt.expectedSha, sha)
+			}
+		})
+	}
+}
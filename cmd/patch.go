@@ -0,0 +1,455 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/mail"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Patch is a single commit worth of changes, as produced by git format-patch, or a
+// plain unified diff, in which case there is no author or message.
+type Patch struct {
+	Author  *CommitAuthor
+	Message string
+	Files   []FileDiff
+}
+
+// FileDiff holds the changes to one file of a patch.
+type FileDiff struct {
+	OldPath string
+	NewPath string
+	NewFile bool
+	Deleted bool
+	NewMode string
+	Hunks   []Hunk
+}
+
+// Hunk is a single @@ section of a unified diff. Lines keep their trailing newline,
+// unless the diff marks them with "\ No newline at end of file".
+type Hunk struct {
+	OldStart int
+	OldLines int
+	NewStart int
+	NewLines int
+	Lines    []HunkLine
+}
+
+type HunkLine struct {
+	Op   byte // ' ', '-' or '+'
+	Text string
+}
+
+var (
+	mboxSeparator = regexp.MustCompile(`(?m)^From [0-9a-f]{40} `)
+	hunkHeader    = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@`)
+	subjectPrefix = regexp.MustCompile(`^\s*\[[^\]]*\]\s*`)
+)
+
+// ParsePatches reads either an mbox, as written by git format-patch, or a plain unified diff.
+func ParsePatches(data []byte) ([]Patch, error) {
+	if !bytes.HasPrefix(data, []byte("From ")) {
+		files, err := ParseUnifiedDiff(string(data))
+		if err != nil {
+			return nil, err
+		}
+		return []Patch{{Files: files}}, nil
+	}
+
+	var patches []Patch
+	starts := mboxSeparator.FindAllIndex(data, -1)
+	if len(starts) == 0 || starts[0][0] != 0 {
+		starts = append([][]int{{0, 0}}, starts...)
+	}
+	for i, start := range starts {
+		end := len(data)
+		if i+1 < len(starts) {
+			end = starts[i+1][0]
+		}
+
+		patch, err := parseMboxMessage(data[start[0]:end])
+		if err != nil {
+			return nil, fmt.Errorf("patch %d: %w", i+1, err)
+		}
+		patches = append(patches, patch)
+	}
+	return patches, nil
+}
+
+func parseMboxMessage(message []byte) (Patch, error) {
+	// Drop the "From <sha> <date>" separator line, which is not a header
+	if i := bytes.IndexByte(message, '\n'); i >= 0 {
+		message = message[i+1:]
+	}
+
+	msg, err := mail.ReadMessage(bytes.NewReader(message))
+	if err != nil {
+		return Patch{}, fmt.Errorf("invalid patch headers: %w", err)
+	}
+	body, err := io.ReadAll(msg.Body)
+	if err != nil {
+		return Patch{}, err
+	}
+
+	decoder := new(mime.WordDecoder)
+	subject, err := decoder.DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil {
+		subject = msg.Header.Get("Subject")
+	}
+	subject = subjectPrefix.ReplaceAllString(strings.Join(strings.Fields(subject), " "), "")
+
+	var author *CommitAuthor
+	if from := msg.Header.Get("From"); from != "" {
+		address, err := (&mail.AddressParser{WordDecoder: decoder}).Parse(from)
+		if err != nil {
+			return Patch{}, fmt.Errorf("invalid author %q: %w", from, err)
+		}
+		author = &CommitAuthor{Name: address.Name, Email: address.Address}
+		if date, err := msg.Header.Date(); err == nil {
+			author.Date = date.Format("2006-01-02T15:04:05Z07:00")
+		}
+	}
+
+	// The commit message body ends at the "---" line preceding the diffstat
+	text := string(body)
+	description, diff := text, ""
+	if i := strings.Index(text, "\n---\n"); i >= 0 || strings.HasPrefix(text, "---\n") {
+		if i < 0 {
+			description, diff = "", text[len("---\n"):]
+		} else {
+			description, diff = text[:i], text[i+len("\n---\n"):]
+		}
+	} else if i := strings.Index(text, "diff --git "); i >= 0 {
+		description, diff = text[:i], text[i:]
+	}
+
+	files, err := ParseUnifiedDiff(diff)
+	if err != nil {
+		return Patch{}, err
+	}
+
+	commitMessage := subject
+	if description = strings.TrimSpace(description); description != "" {
+		commitMessage += "\n\n" + description
+	}
+
+	return Patch{Author: author, Message: commitMessage, Files: files}, nil
+}
+
+// ParseUnifiedDiff parses git-style and plain unified diffs. As with git apply, the
+// first component of the paths (a/ and b/) is stripped.
+func ParseUnifiedDiff(text string) ([]FileDiff, error) {
+	lines := strings.SplitAfter(text, "\n")
+	var files []FileDiff
+	var current *FileDiff
+
+	flush := func() {
+		if current != nil {
+			files = append(files, *current)
+			current = nil
+		}
+	}
+
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimRight(lines[i], "\r\n")
+
+		switch {
+		case strings.HasPrefix(line, "diff --git "):
+			flush()
+			oldPath, newPath, err := parseGitDiffHeader(line)
+			if err != nil {
+				return nil, err
+			}
+			current = &FileDiff{OldPath: oldPath, NewPath: newPath}
+		case strings.HasPrefix(line, "--- ") && i+1 < len(lines) && strings.HasPrefix(lines[i+1], "+++ "):
+			if current == nil || len(current.Hunks) > 0 {
+				flush()
+				current = &FileDiff{}
+			}
+			oldPath, err := parseDiffPath(line[len("--- "):])
+			if err != nil {
+				return nil, err
+			}
+			newPath, err := parseDiffPath(strings.TrimRight(lines[i+1], "\r\n")[len("+++ "):])
+			if err != nil {
+				return nil, err
+			}
+			i++
+
+			if oldPath == "" {
+				current.NewFile = true
+			} else {
+				current.OldPath = oldPath
+			}
+			if newPath == "" {
+				current.Deleted = true
+			} else {
+				current.NewPath = newPath
+			}
+		case strings.HasPrefix(line, "@@ "):
+			if current == nil {
+				return nil, fmt.Errorf("hunk without a file header: %s", line)
+			}
+			hunk, consumed, err := parseHunk(lines[i:])
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", current.path(), err)
+			}
+			current.Hunks = append(current.Hunks, hunk)
+			i += consumed - 1
+		case current == nil:
+			// Anything before the first file header is commentary
+			continue
+		case strings.HasPrefix(line, "new file mode "):
+			current.NewFile = true
+			current.NewMode = strings.TrimPrefix(line, "new file mode ")
+		case strings.HasPrefix(line, "deleted file mode "):
+			current.Deleted = true
+		case strings.HasPrefix(line, "new mode "):
+			current.NewMode = strings.TrimPrefix(line, "new mode ")
+		case strings.HasPrefix(line, "rename from "):
+			current.OldPath = strings.TrimPrefix(line, "rename from ")
+		case strings.HasPrefix(line, "rename to "):
+			current.NewPath = strings.TrimPrefix(line, "rename to ")
+		case strings.HasPrefix(line, "copy from "), strings.HasPrefix(line, "copy to "):
+			return nil, fmt.Errorf("%s: copies are not supported", current.path())
+		case strings.HasPrefix(line, "Binary files "), line == "GIT binary patch":
+			return nil, fmt.Errorf("%s: binary patches are not supported", current.path())
+		}
+	}
+	flush()
+
+	if len(files) == 0 {
+		return nil, errors.New("the patch does not contain any changes")
+	}
+
+	for i := range files {
+		if files[i].NewFile {
+			files[i].OldPath = ""
+		}
+		if files[i].path() == "" {
+			return nil, errors.New("the patch contains a file without a path")
+		}
+	}
+	return files, nil
+}
+
+func (fd FileDiff) path() string {
+	if fd.NewPath != "" {
+		return fd.NewPath
+	}
+	return fd.OldPath
+}
+
+func parseGitDiffHeader(line string) (string, string, error) {
+	rest := strings.TrimPrefix(line, "diff --git ")
+	if strings.HasPrefix(rest, `"`) {
+		oldPath, remainder, err := unquoteDiffPath(rest)
+		if err != nil {
+			return "", "", err
+		}
+		newPath, _, err := unquoteDiffPath(strings.TrimSpace(remainder))
+		if err != nil {
+			return "", "", err
+		}
+		return stripDiffPrefix(oldPath), stripDiffPrefix(newPath), nil
+	}
+
+	// Unquoted paths may contain spaces, so split on the " b/" marker
+	oldPath, newPath, found := strings.Cut(rest, " b/")
+	if !found {
+		return "", "", fmt.Errorf("invalid diff header: %s", line)
+	}
+	return stripDiffPrefix(oldPath), newPath, nil
+}
+
+// parseDiffPath reads the path of a ---/+++ line. /dev/null is returned as "".
+func parseDiffPath(value string) (string, error) {
+	if strings.HasPrefix(value, `"`) {
+		p, _, err := unquoteDiffPath(value)
+		if err != nil {
+			return "", err
+		}
+		value = p
+	} else if i := strings.IndexByte(value, '\t'); i >= 0 {
+		// Plain diffs append a timestamp after a tab
+		value = value[:i]
+	}
+
+	value = strings.TrimRight(value, " ")
+	if value == "/dev/null" {
+		return "", nil
+	}
+	return stripDiffPrefix(value), nil
+}
+
+func unquoteDiffPath(value string) (string, string, error) {
+	end := 1
+	for ; end < len(value); end++ {
+		if value[end] == '\\' {
+			end++
+		} else if value[end] == '"' {
+			break
+		}
+	}
+	if end >= len(value) {
+		return "", "", fmt.Errorf("invalid quoted path: %s", value)
+	}
+
+	unquoted, err := strconv.Unquote(value[:end+1])
+	if err != nil {
+		return "", "", fmt.Errorf("invalid quoted path: %s", value)
+	}
+	return unquoted, value[end+1:], nil
+}
+
+func stripDiffPrefix(p string) string {
+	if _, rest, found := strings.Cut(p, "/"); found {
+		return rest
+	}
+	return p
+}
+
+// parseHunk reads a hunk starting at its @@ header and returns how many lines it spans.
+func parseHunk(lines []string) (Hunk, int, error) {
+	header := strings.TrimRight(lines[0], "\r\n")
+	match := hunkHeader.FindStringSubmatch(header)
+	if match == nil {
+		return Hunk{}, 0, fmt.Errorf("invalid hunk header: %s", header)
+	}
+
+	count := func(value string) int {
+		if value == "" {
+			return 1
+		}
+		n, _ := strconv.Atoi(value)
+		return n
+	}
+	hunk := Hunk{}
+	hunk.OldStart, _ = strconv.Atoi(match[1])
+	hunk.OldLines = count(match[2])
+	hunk.NewStart, _ = strconv.Atoi(match[3])
+	hunk.NewLines = count(match[4])
+
+	oldRemaining, newRemaining := hunk.OldLines, hunk.NewLines
+	i := 1
+	for ; i < len(lines) && (oldRemaining > 0 || newRemaining > 0); i++ {
+		line := lines[i]
+		if line == "" {
+			break
+		}
+		if strings.HasPrefix(line, `\`) {
+			hunk.trimLastNewline()
+			continue
+		}
+
+		op, text := line[0], line[1:]
+		if line == "\n" || line == "\r\n" {
+			// Some editors strip the space from empty context lines
+			op, text = ' ', line
+		}
+
+		switch op {
+		case ' ':
+			oldRemaining--
+			newRemaining--
+		case '-':
+			oldRemaining--
+		case '+':
+			newRemaining--
+		default:
+			return Hunk{}, 0, fmt.Errorf("unexpected line in hunk: %q", strings.TrimRight(line, "\r\n"))
+		}
+		hunk.Lines = append(hunk.Lines, HunkLine{Op: op, Text: text})
+	}
+
+	if oldRemaining != 0 || newRemaining != 0 {
+		return Hunk{}, 0, fmt.Errorf("truncated hunk: %s", header)
+	}
+
+	// A missing newline on the last line is marked after the counted lines
+	if i < len(lines) && strings.HasPrefix(lines[i], `\`) {
+		hunk.trimLastNewline()
+		i++
+	}
+	return hunk, i, nil
+}
+
+func (h *Hunk) trimLastNewline() {
+	if len(h.Lines) > 0 {
+		last := &h.Lines[len(h.Lines)-1]
+		last.Text = strings.TrimSuffix(strings.TrimSuffix(last.Text, "\n"), "\r")
+	}
+}
+
+// ApplyHunks applies the hunks of a file to its original content. Like git apply, a hunk
+// may be found away from the line numbers in its header, but its context must match exactly.
+func ApplyHunks(original []byte, hunks []Hunk) ([]byte, error) {
+	lines := strings.SplitAfter(string(original), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	var out []string
+	pos := 0
+	for n, hunk := range hunks {
+		var oldLines, newLines []string
+		for _, line := range hunk.Lines {
+			if line.Op != '+' {
+				oldLines = append(oldLines, line.Text)
+			}
+			if line.Op != '-' {
+				newLines = append(newLines, line.Text)
+			}
+		}
+
+		// For pure additions, the old start is the line after which to insert
+		expected := hunk.OldStart - 1
+		if hunk.OldLines == 0 {
+			expected = hunk.OldStart
+		}
+
+		at := findHunk(lines, oldLines, expected, pos)
+		if at < 0 {
+			return nil, fmt.Errorf("hunk #%d (@@ -%d,%d +%d,%d @@) does not apply",
+				n+1, hunk.OldStart, hunk.OldLines, hunk.NewStart, hunk.NewLines)
+		}
+
+		out = append(out, lines[pos:at]...)
+		out = append(out, newLines...)
+		pos = at + len(oldLines)
+	}
+	out = append(out, lines[pos:]...)
+
+	return []byte(strings.Join(out, "")), nil
+}
+
+// findHunk looks for the old side of a hunk, starting at the expected line and moving
+// outwards. Hunks are applied in order, so the search never goes before min.
+func findHunk(lines, oldLines []string, expected, min int) int {
+	matches := func(at int) bool {
+		if at < min || at+len(oldLines) > len(lines) {
+			return false
+		}
+		for i, line := range oldLines {
+			if lines[at+i] != line {
+				return false
+			}
+		}
+		return true
+	}
+
+	for offset := 0; offset <= len(lines); offset++ {
+		if matches(expected + offset) {
+			return expected + offset
+		}
+		if offset > 0 && matches(expected-offset) {
+			return expected - offset
+		}
+	}
+	return -1
+}
@@ -0,0 +1,294 @@
+package cmd
+
+import (
+	"errors"
+	"testing"
+)
+
+const formatPatchFixture = `From 7521c28aea04f8a4dd8d6df902559e43b8ae7028 Mon Sep 17 00:00:00 2001
+From: Jane Doe <a@b.c>
+Date: Sun, 18 Oct 2026 17:26:12 +0000
+Subject: [PATCH] Change things
+
+Body text here.
+---
+ a.txt                      | 4 ++--
+ d/{ren.txt => renamed.txt} | 0
+ gone.txt                   | 1 -
+ new.txt                    | 1 +
+ noeol.txt                  | 3 ++-
+ 5 files changed, 5 insertions(+), 4 deletions(-)
+ rename d/{ren.txt => renamed.txt} (100%)
+ delete mode 100644 gone.txt
+ create mode 100755 new.txt
+
+diff --git a/a.txt b/a.txt
+index 4083766..0ac5bc9 100644
+--- a/a.txt
++++ b/a.txt
+@@ -1,10 +1,10 @@
+ line1
+-line2
++LINE2
+ line3
+ line4
+ line5
+ line6
+ line7
+ line8
+-line9
++LINE9
+ line10
+diff --git a/d/ren.txt b/d/renamed.txt
+similarity index 100%
+rename from d/ren.txt
+rename to d/renamed.txt
+diff --git a/gone.txt b/gone.txt
+deleted file mode 100644
+index 3367afd..0000000
+--- a/gone.txt
++++ /dev/null
+@@ -1 +0,0 @@
+-old
+diff --git a/new.txt b/new.txt
+new file mode 100755
+index 0000000..3e75765
+--- /dev/null
++++ b/new.txt
+@@ -0,0 +1 @@
++new
+diff --git a/noeol.txt b/noeol.txt
+index 1b32298..250eaab 100644
+--- a/noeol.txt
++++ b/noeol.txt
+@@ -1,2 +1,3 @@
+ x
+-y
+\ No newline at end of file
++Y
++z
+\ No newline at end of file
+-- 
+2.39.5
+
+`
+
+func TestParsePatchesMbox(t *testing.T) {
+	patches, err := ParsePatches([]byte(formatPatchFixture))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(patches) != 1 {
+		t.Fatalf("expected 1 patch, got %d", len(patches))
+	}
+
+	patch := patches[0]
+	if patch.Message != "Change things\n\nBody text here." {
+		t.Errorf("unexpected message %q", patch.Message)
+	}
+	if patch.Author == nil || patch.Author.Name != "Jane Doe" || patch.Author.Email != "a@b.c" {
+		t.Errorf("unexpected author %+v", patch.Author)
+	}
+	if patch.Author != nil && patch.Author.Date != "2026-10-18T17:26:12Z" {
+		t.Errorf("unexpected date %q", patch.Author.Date)
+	}
+
+	expected := []FileDiff{
+		{OldPath: "a.txt", NewPath: "a.txt"},
+		{OldPath: "d/ren.txt", NewPath: "d/renamed.txt"},
+		{OldPath: "gone.txt", NewPath: "gone.txt", Deleted: true},
+		{NewPath: "new.txt", NewFile: true, NewMode: "100755"},
+		{OldPath: "noeol.txt", NewPath: "noeol.txt"},
+	}
+	if len(patch.Files) != len(expected) {
+		t.Fatalf("expected %d files, got %d", len(expected), len(patch.Files))
+	}
+	for i, fd := range patch.Files {
+		e := expected[i]
+		if fd.OldPath != e.OldPath || fd.NewPath != e.NewPath || fd.NewFile != e.NewFile || fd.Deleted != e.Deleted || fd.NewMode != e.NewMode {
+			t.Errorf("file %d: expected %+v, got %+v", i, e, fd)
+		}
+	}
+}
+
+func TestParseUnifiedDiffErrors(t *testing.T) {
+	tests := []struct {
+		name          string
+		diff          string
+		expectedError error
+	}{
+		{
+			name:          "Empty",
+			diff:          "",
+			expectedError: errors.New("the patch does not contain any changes"),
+		},
+		{
+			name:          "Binary",
+			diff:          "diff --git a/img.png b/img.png\nBinary files a/img.png and b/img.png differ\n",
+			expectedError: errors.New("img.png: binary patches are not supported"),
+		},
+		{
+			name:          "Truncated hunk",
+			diff:          "--- a/f\n+++ b/f\n@@ -1,2 +1,2 @@\n-a\n",
+			expectedError: errors.New("f: truncated hunk: @@ -1,2 +1,2 @@"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseUnifiedDiff(tt.diff)
+			if err == nil || err.Error() != tt.expectedError.Error() {
+				t.Errorf("expected error %v, got %v", tt.expectedError, err)
+			}
+		})
+	}
+}
+
+func TestApplyHunks(t *testing.T) {
+	tests := []struct {
+		name          string
+		original      string
+		diff          string
+		expected      string
+		expectedError error
+	}{
+		{
+			name:     "Replace a line",
+			original: "a\nb\nc\n",
+			diff:     "--- a/f\n+++ b/f\n@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n",
+			expected: "a\nB\nc\n",
+		},
+		{
+			name:     "Hunk found at an offset",
+			original: "x\ny\na\nb\nc\n",
+			diff:     "--- a/f\n+++ b/f\n@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n",
+			expected: "x\ny\na\nB\nc\n",
+		},
+		{
+			name:     "Append to a file without a trailing newline",
+			original: "a\nb",
+			diff:     "--- a/f\n+++ b/f\n@@ -1,2 +1,3 @@\n a\n-b\n\\ No newline at end of file\n+b\n+c\n",
+			expected: "a\nb\nc\n",
+		},
+		{
+			name:     "Insert at the start",
+			original: "b\n",
+			diff:     "--- a/f\n+++ b/f\n@@ -0,0 +1 @@\n+a\n",
+			expected: "a\nb\n",
+		},
+		{
+			name:          "Context does not match",
+			original:      "a\nb\nc\n",
+			diff:          "--- a/f\n+++ b/f\n@@ -1,3 +1,3 @@\n a\n-x\n+X\n c\n",
+			expectedError: errors.New("hunk #1 (@@ -1,3 +1,3 @@) does not apply"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files, err := ParseUnifiedDiff(tt.diff)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			result, err := ApplyHunks([]byte(tt.original), files[0].Hunks)
+			if err != nil && tt.expectedError != nil {
+				if err.Error() != tt.expectedError.Error() {
+					t.Errorf("expected error %v, got %v", tt.expectedError, err)
+				}
+				return
+			} else if err != nil || tt.expectedError != nil {
+				t.Fatalf("expected error %v, got %v", tt.expectedError, err)
+			}
+
+			if string(result) != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, string(result))
+			}
+		})
+	}
+}
+
+func TestPatchTreeApply(t *testing.T) {
+	trees := map[string][]TreeEntry{
+		"root": {
+			{Path: "a.txt", Mode: "100644", Type: "blob", Sha: "a"},
+			{Path: "d", Mode: "040000", Type: "tree", Sha: "d"},
+			{Path: "gone.txt", Mode: "100644", Type: "blob", Sha: "gone"},
+			{Path: "noeol.txt", Mode: "100644", Type: "blob", Sha: "noeol"},
+		},
+		"d": {
+			{Path: "ren.txt", Mode: "100644", Type: "blob", Sha: "ren"},
+		},
+	}
+	blobs := map[string]string{
+		"a":     "line1\nline2\nline3\nline4\nline5\nline6\nline7\nline8\nline9\nline10\n",
+		"gone":  "old\n",
+		"noeol": "x\ny",
+		"ren":   "r\n",
+	}
+
+	patchTree := NewPatchTree(
+		"root",
+		func(sha string) ([]TreeEntry, error) { return trees[sha], nil },
+		func(sha string) ([]byte, error) { return []byte(blobs[sha]), nil },
+	)
+
+	patches, err := ParsePatches([]byte(formatPatchFixture))
+	if err != nil {
+		t.Fatal(err)
+	}
+	changes, err := patchTree.Apply(patches[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []FileChange{
+		{Path: "a.txt", Mode: "100644", Content: []byte("line1\nLINE2\nline3\nline4\nline5\nline6\nline7\nline8\nLINE9\nline10\n")},
+		{Path: "d/ren.txt", Deleted: true},
+		{Path: "d/renamed.txt", Mode: "100644", Content: []byte("r\n")},
+		{Path: "gone.txt", Deleted: true},
+		{Path: "new.txt", Mode: "100755", Content: []byte("new\n")},
+		{Path: "noeol.txt", Mode: "100644", Content: []byte("x\nY\nz")},
+	}
+	if len(changes) != len(expected) {
+		t.Fatalf("expected %d changes, got %+v", len(expected), changes)
+	}
+	for i, change := range changes {
+		e := expected[i]
+		if change.Path != e.Path || change.Deleted != e.Deleted || change.Mode != e.Mode || string(change.Content) != string(e.Content) {
+			t.Errorf("change %d: expected %+v, got %+v", i, e, change)
+		}
+	}
+
+	// Applying the same patch again has to fail, as the files have moved on
+	if _, err = patchTree.Apply(patches[0]); err == nil {
+		t.Errorf("expected the patch not to apply twice")
+	}
+}
+
+func TestNetChangesUnchanged(t *testing.T) {
+	remote := map[string]*TreeEntry{
+		"a.txt": {Path: "a.txt", Mode: "100644", Type: "blob", Sha: HashBlob([]byte("a\n"))},
+	}
+	changes := []FileChange{
+		{Path: "a.txt", Mode: "100644", Content: []byte("b\n")},
+		{Path: "new.txt", Mode: "100644", Content: []byte("new\n")},
+		{Path: "a.txt", Mode: "100644", Content: []byte("a\n")},
+		{Path: "new.txt", Deleted: true},
+	}
+
+	net := netChanges(changes)
+	planned, err := PlanChanges(net, func(p string) (*TreeEntry, error) { return remote[p], nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var statuses []string
+	for _, plan := range planned {
+		statuses = append(statuses, plan.Path+" "+plan.Status)
+	}
+	expected := []string{"a.txt unchanged", "new.txt unchanged"}
+	if !equal(statuses, expected) {
+		t.Errorf("expected %v, got %v", expected, statuses)
+	}
+}
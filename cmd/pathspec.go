@@ -0,0 +1,215 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ReadPathspecs reads pathspecs the way git add --pathspec-from-file does: one per line,
+// with C-style quoted lines unquoted, or NUL-delimited when nul is set. Use - for stdin.
+func ReadPathspecs(source string, nul bool) ([]string, error) {
+	var data []byte
+	var err error
+	if source == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(source)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read pathspecs: %w", err)
+	}
+
+	return ParsePathspecs(data, nul)
+}
+
+func ParsePathspecs(data []byte, nul bool) ([]string, error) {
+	separator := byte('\n')
+	if nul {
+		separator = 0
+	}
+
+	var pathspecs []string
+	for _, entry := range bytes.Split(data, []byte{separator}) {
+		pathspec := string(entry)
+		if pathspec == "" {
+			continue
+		}
+
+		if !nul && strings.HasPrefix(pathspec, `"`) {
+			unquoted, err := strconv.Unquote(pathspec)
+			if err != nil {
+				return nil, fmt.Errorf("invalid quoted pathspec: %s", pathspec)
+			}
+			pathspec = unquoted
+		}
+		pathspecs = append(pathspecs, pathspec)
+	}
+	return pathspecs, nil
+}
+
+// Pathspec is a pattern selecting files, with the subset of git's pathspec magic that
+// makes sense outside of a git checkout: exclude, glob, icase, literal and top.
+type Pathspec struct {
+	Pattern string
+	Exclude bool
+	Glob    bool
+	Icase   bool
+	Literal bool
+}
+
+// ParsePathspec reads the long (":(exclude,icase)pattern") and short (":!pattern",
+// ":^pattern", ":/pattern") forms of pathspec magic.
+func ParsePathspec(s string) (Pathspec, error) {
+	if !strings.HasPrefix(s, ":") {
+		return Pathspec{Pattern: s}, nil
+	}
+
+	var ps Pathspec
+	rest := s[1:]
+	if strings.HasPrefix(rest, "(") {
+		end := strings.IndexByte(rest, ')')
+		if end < 0 {
+			return Pathspec{}, fmt.Errorf("invalid pathspec magic in %q", s)
+		}
+		for _, magic := range strings.Split(rest[1:end], ",") {
+			switch strings.TrimSpace(magic) {
+			case "exclude":
+				ps.Exclude = true
+			case "glob":
+				ps.Glob = true
+			case "icase":
+				ps.Icase = true
+			case "literal":
+				ps.Literal = true
+			case "top", "":
+				// Paths are always matched from the root
+			default:
+				return Pathspec{}, fmt.Errorf("unsupported pathspec magic %q in %q", magic, s)
+			}
+		}
+		ps.Pattern = rest[end+1:]
+	} else {
+		for len(rest) > 0 && strings.ContainsRune("!^/", rune(rest[0])) {
+			if rest[0] != '/' {
+				ps.Exclude = true
+			}
+			rest = rest[1:]
+		}
+		// A second colon ends the short form, as in ":!:pattern"
+		ps.Pattern = strings.TrimPrefix(rest, ":")
+	}
+
+	if ps.Glob && ps.Literal {
+		return Pathspec{}, fmt.Errorf("`glob` and `literal` pathspec magic cannot be combined in %q", s)
+	}
+	return ps, nil
+}
+
+// CompilePathspecs parses each of the patterns of a file selection with ParsePathspec.
+func CompilePathspecs(patterns []string) ([]Pathspec, error) {
+	pathspecs := make([]Pathspec, 0, len(patterns))
+	for _, pattern := range patterns {
+		ps, err := ParsePathspec(pattern)
+		if err != nil {
+			return nil, err
+		}
+		pathspecs = append(pathspecs, ps)
+	}
+	return pathspecs, nil
+}
+
+// Match reports whether the pathspec matches name, ignoring whether it is an exclusion.
+func (ps Pathspec) Match(name string) bool {
+	pattern := ps.Pattern
+	if ps.Icase {
+		pattern, name = strings.ToLower(pattern), strings.ToLower(name)
+	}
+
+	switch {
+	case ps.Literal:
+		pattern = strings.TrimSuffix(pattern, "/")
+		return pattern == "" || name == pattern || strings.HasPrefix(name, pattern+"/")
+	case ps.Glob:
+		pattern = strings.TrimPrefix(strings.TrimSuffix(pattern, "/"), "./")
+		if pattern == "" || wildmatch(pattern, name, true) {
+			return true
+		}
+		for i := 0; i < len(name); i++ {
+			if name[i] == '/' && wildmatch(pattern, name[:i], true) {
+				return true
+			}
+		}
+		return false
+	default:
+		return matchPathspec(pattern, name)
+	}
+}
+
+// MatchPathspecs follows git: a path is selected when it matches any of the including
+// pathspecs, or there are none, and none of the excluding ones.
+func MatchPathspecs(pathspecs []Pathspec, name string) bool {
+	included, hasIncludes := false, false
+	for _, ps := range pathspecs {
+		if ps.Exclude {
+			if ps.Match(name) {
+				return false
+			}
+			continue
+		}
+		hasIncludes = true
+		if !included && ps.Match(name) {
+			included = true
+		}
+	}
+	return included || !hasIncludes
+}
+
+// MatchExclude matches the values of --exclude. Like .gitignore, a pattern without a
+// slash matches a file or directory of that name at any depth.
+func MatchExclude(pattern, name string) bool {
+	ps, err := ParsePathspec(pattern)
+	if err != nil {
+		return false
+	}
+
+	trimmed := strings.TrimSuffix(ps.Pattern, "/")
+	if ps.Literal || strings.Contains(trimmed, "/") {
+		return ps.Match(name)
+	}
+
+	for _, component := range strings.Split(name, "/") {
+		base := Pathspec{Pattern: trimmed, Glob: true, Icase: ps.Icase}
+		if base.Match(component) {
+			return true
+		}
+	}
+	return false
+}
+
+// ApplyExcludes drops the changes matching any of the --exclude patterns.
+func ApplyExcludes(changes []FileChange, excludes []string) []FileChange {
+	if len(excludes) == 0 {
+		return changes
+	}
+
+	var filtered []FileChange
+	for _, change := range changes {
+		if !isExcluded(excludes, change.Path) {
+			filtered = append(filtered, change)
+		}
+	}
+	return filtered
+}
+
+func isExcluded(excludes []string, name string) bool {
+	for _, exclude := range excludes {
+		if MatchExclude(exclude, name) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,171 @@
+package cmd
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParsePathspecs(t *testing.T) {
+	tests := []struct {
+		name              string
+		data              string
+		nul               bool
+		expectedPathspecs []string
+		expectedError     error
+	}{
+		{
+			name:              "Newline-delimited",
+			data:              "a.txt\ndir/b.txt\n",
+			expectedPathspecs: []string{"a.txt", "dir/b.txt"},
+		},
+		{
+			name:              "Empty lines are skipped",
+			data:              "a.txt\n\n\nb.txt",
+			expectedPathspecs: []string{"a.txt", "b.txt"},
+		},
+		{
+			name:              "Quoted lines are unquoted",
+			data:              "\"with\\ttab.txt\"\nplain.txt\n",
+			expectedPathspecs: []string{"with\ttab.txt", "plain.txt"},
+		},
+		{
+			name:              "NUL-delimited keeps newlines and quotes",
+			data:              "line\nbreak.txt\x00\"quoted\".txt\x00",
+			nul:               true,
+			expectedPathspecs: []string{"line\nbreak.txt", "\"quoted\".txt"},
+		},
+		{
+			name:          "Invalid quoting",
+			data:          "\"unterminated\n",
+			expectedError: errors.New("invalid quoted pathspec: \"unterminated"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pathspecs, err := ParsePathspecs([]byte(tt.data), tt.nul)
+
+			if err != nil && tt.expectedError != nil {
+				if err.Error() != tt.expectedError.Error() {
+					t.Errorf("expected error %v, got %v", tt.expectedError, err)
+				}
+			} else if err != nil || tt.expectedError != nil {
+				t.Errorf("expected error %v, got %v", tt.expectedError, err)
+			}
+
+			if !equal(pathspecs, tt.expectedPathspecs) {
+				t.Errorf("expected pathspecs %q, got %q", tt.expectedPathspecs, pathspecs)
+			}
+		})
+	}
+}
+
+func TestParsePathspec(t *testing.T) {
+	tests := []struct {
+		name             string
+		pathspec         string
+		expectedPathspec Pathspec
+		expectedError    error
+	}{
+		{name: "No magic", pathspec: "src/*.go", expectedPathspec: Pathspec{Pattern: "src/*.go"}},
+		{name: "Long exclude", pathspec: ":(exclude)vendor", expectedPathspec: Pathspec{Pattern: "vendor", Exclude: true}},
+		{name: "Short exclude", pathspec: ":!vendor", expectedPathspec: Pathspec{Pattern: "vendor", Exclude: true}},
+		{name: "Short exclude with caret", pathspec: ":^vendor", expectedPathspec: Pathspec{Pattern: "vendor", Exclude: true}},
+		{name: "Short form ended by a colon", pathspec: ":!:*.md", expectedPathspec: Pathspec{Pattern: "*.md", Exclude: true}},
+		{name: "Top is a no-op", pathspec: ":/docs", expectedPathspec: Pathspec{Pattern: "docs"}},
+		{
+			name:             "Several magic words",
+			pathspec:         ":(glob,icase)**/*.MD",
+			expectedPathspec: Pathspec{Pattern: "**/*.MD", Glob: true, Icase: true},
+		},
+		{
+			name:          "Unknown magic",
+			pathspec:      ":(attr:foo)x",
+			expectedError: errors.New("unsupported pathspec magic \"attr:foo\" in \":(attr:foo)x\""),
+		},
+		{
+			name:          "Unterminated magic",
+			pathspec:      ":(exclude",
+			expectedError: errors.New("invalid pathspec magic in \":(exclude\""),
+		},
+		{
+			name:          "Glob and literal",
+			pathspec:      ":(glob,literal)x",
+			expectedError: errors.New("`glob` and `literal` pathspec magic cannot be combined in \":(glob,literal)x\""),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ps, err := ParsePathspec(tt.pathspec)
+
+			if err != nil && tt.expectedError != nil {
+				if err.Error() != tt.expectedError.Error() {
+					t.Errorf("expected error %v, got %v", tt.expectedError, err)
+				}
+			} else if err != nil || tt.expectedError != nil {
+				t.Errorf("expected error %v, got %v", tt.expectedError, err)
+			}
+
+			if ps != tt.expectedPathspec {
+				t.Errorf("expected pathspec %+v, got %+v", tt.expectedPathspec, ps)
+			}
+		})
+	}
+}
+
+func TestMatchPathspecs(t *testing.T) {
+	tests := []struct {
+		name      string
+		pathspecs []string
+		path      string
+		expected  bool
+	}{
+		{name: "Included", pathspecs: []string{"src"}, path: "src/main.go", expected: true},
+		{name: "Not included", pathspecs: []string{"src"}, path: "docs/index.md", expected: false},
+		{name: "Included then excluded", pathspecs: []string{"src", ":!src/gen"}, path: "src/gen/api.go", expected: false},
+		{name: "Only excludes match everything else", pathspecs: []string{":!*.md"}, path: "main.go", expected: true},
+		{name: "Only excludes", pathspecs: []string{":(exclude)*.md"}, path: "docs/index.md", expected: false},
+		{name: "Glob star stays in its directory", pathspecs: []string{":(glob)*.go"}, path: "cmd/args.go", expected: false},
+		{name: "Glob double star", pathspecs: []string{":(glob)**/*.go"}, path: "cmd/args.go", expected: true},
+		{name: "Glob leading directory", pathspecs: []string{":(glob)cmd/*"}, path: "cmd/sub/x.go", expected: true},
+		{name: "Icase", pathspecs: []string{":(icase)readme.md"}, path: "README.md", expected: true},
+		{name: "Literal", pathspecs: []string{":(literal)file[1].txt"}, path: "file[1].txt", expected: true},
+		{name: "Literal does not glob", pathspecs: []string{":(literal)*.txt"}, path: "a.txt", expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pathspecs, err := CompilePathspecs(tt.pathspecs)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if matched := MatchPathspecs(pathspecs, tt.path); matched != tt.expected {
+				t.Errorf("expected %v for %q against %q, got %v", tt.expected, tt.path, tt.pathspecs, matched)
+			}
+		})
+	}
+}
+
+func TestApplyExcludes(t *testing.T) {
+	changes := ChangesFromPaths([]string{
+		"go.sum",
+		"package-lock.json",
+		"web/package-lock.json",
+		"web/node_modules/left-pad/index.js",
+		"web/src/app.js",
+		"docs/build/index.html",
+		"build/out.bin",
+	})
+
+	filtered := ApplyExcludes(changes, []string{"*.json", "node_modules", "docs/build/"})
+
+	var paths []string
+	for _, change := range filtered {
+		paths = append(paths, change.Path)
+	}
+	expected := []string{"go.sum", "web/src/app.js", "build/out.bin"}
+	if !equal(paths, expected) {
+		t.Errorf("expected %q, got %q", expected, paths)
+	}
+}
@@ -0,0 +1,409 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/cli/go-gh/pkg/repository"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// planFormat identifies a commit plan, and the version of its layout.
+const planFormat = "gh-commit-plan/v1"
+
+var (
+	OutputFlag = Flag{Short: "o", Long: "output", Description: "The file to write the plan to. Use - to write it to stdout, in which case the human-readable output goes to stderr.", Type: "string"}
+	NoContent  = Flag{Long: "no-content", Description: "Leave the file contents out of the plan. `gh commit apply` then reads each file from the working directory, e.g. a downloaded artifact, and checks it against the blob SHA in the plan.", Type: "bool", Default: "false"}
+)
+
+// planFlags select files like a regular run. Forks are left out, as creating one is a
+// write, which belongs with the job that applies the plan.
+var planFlags = []Flag{
+	BranchFlag,
+	MessageFlag,
+	UsePrFlag,
+	HeadRefFlag,
+	PrTitleFlag,
+	PrDescFlag,
+	PrLabelFlag,
+	AllFlag,
+	Untracked,
+	RepoFlag,
+	RemoteFlag,
+	SourceDir,
+	PrefixFlag,
+	MapFlag,
+	MirrorFlag,
+	ArchiveFlag,
+	SpecFile,
+	SpecFileNul,
+	SinceFlag,
+	RangeFlag,
+	ExcludeFlag,
+	ProfileFlag,
+	PrintConfig,
+	AllowEmpty,
+	DiffFlag,
+	OutputFlag,
+	NoContent,
+	TimeoutFlag,
+	VerboseFlag,
+}
+
+const planHelpText = `gh-commit plan: Write down a commit without making it.
+
+The plan holds the target repository, the base commit, every file that differs
+from the remote tree with its blob SHA and content, and the message and PR
+settings. It only needs read access, so it can be made by an untrusted job,
+and reviewed and applied by another one holding the write token:
+
+  gh commit plan -B main -P -m "chore: regenerate" -A -o plan.json
+  gh commit apply plan.json
+
+Applying refuses to commit if the base branch moved since the plan was made.
+
+Synopsis:
+  gh commit plan [files] -B <branch> -m <message> -o <plan.json|-> [flags]
+
+Flags:
+`
+
+// CommitPlan is a commit computed against the remote tree, to be applied later, possibly
+// by another job.
+type CommitPlan struct {
+	Format      string           `json:"format"`
+	Repository  string           `json:"repository"`
+	Branch      string           `json:"branch"`
+	BaseSha     string           `json:"base_sha"`
+	Message     string           `json:"message"`
+	AllowEmpty  bool             `json:"allow_empty,omitempty"`
+	PullRequest *PlanPullRequest `json:"pull_request,omitempty"`
+	Files       []PlanFile       `json:"files"`
+}
+
+type PlanPullRequest struct {
+	HeadRef     string   `json:"head_ref"`
+	Title       string   `json:"title"`
+	Description string   `json:"description"`
+	Labels      []string `json:"labels,omitempty"`
+}
+
+// PlanFile is a tree entry of the plan. Content is base64-encoded, and left out of plans
+// made with --no-content.
+type PlanFile struct {
+	Path    string `json:"path"`
+	Status  string `json:"status"`
+	Mode    string `json:"mode,omitempty"`
+	BlobSha string `json:"blob_sha,omitempty"`
+	Content string `json:"content,omitempty"`
+}
+
+// NewCommitPlan records the changes that differ from the remote tree.
+func (rn *RunSettings) NewCommitPlan(baseSha string, planned []PlannedChange, embed bool) (*CommitPlan, error) {
+	plan := &CommitPlan{
+		Format:     planFormat,
+		Repository: fmt.Sprintf("%s/%s/%s", repo.Host(), repo.Owner(), repo.Name()),
+		Branch:     rn.baseBranch(),
+		BaseSha:    baseSha,
+		Message:    rn.CommitSettings.CommitMessage,
+		AllowEmpty: rn.AllowEmpty,
+		Files:      []PlanFile{},
+	}
+	if rn.PrSettings != nil {
+		plan.PullRequest = &PlanPullRequest{
+			HeadRef:     rn.PrSettings.HeadRef,
+			Title:       rn.PrSettings.Title,
+			Description: rn.PrSettings.Description,
+			Labels:      rn.PrSettings.Labels,
+		}
+	}
+
+	for _, change := range planned {
+		if change.Status == "unchanged" {
+			continue
+		}
+		file := PlanFile{Path: change.Path, Status: change.Status}
+		if !change.Deleted {
+			file.Mode = change.Mode
+			file.BlobSha = change.LocalSha
+			if embed {
+				content, err := change.Load()
+				if err != nil {
+					return nil, err
+				}
+				file.Content = base64.StdEncoding.EncodeToString(content)
+			}
+		}
+		plan.Files = append(plan.Files, file)
+	}
+	return plan, nil
+}
+
+// ParseCommitPlan reads a plan, and reports false if the data is not one, e.g. a patch.
+func ParseCommitPlan(data []byte) (*CommitPlan, bool, error) {
+	if !bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		return nil, false, nil
+	}
+
+	var plan CommitPlan
+	if err := json.Unmarshal(data, &plan); err != nil {
+		return nil, false, fmt.Errorf("invalid plan: %w", err)
+	}
+	if plan.Format != planFormat {
+		return nil, false, fmt.Errorf("unsupported plan format %q, expected %q", plan.Format, planFormat)
+	}
+	if plan.Repository == "" || plan.Branch == "" || plan.BaseSha == "" || plan.Message == "" {
+		return nil, false, errors.New("invalid plan: the repository, branch, base SHA and message are required")
+	}
+	return &plan, true, nil
+}
+
+// Changes turns the files of the plan back into changes. Every file is checked against
+// its blob SHA, whether its content is embedded or read from the working directory, and
+// only regular files, executables and symlinks are accepted.
+func (cp *CommitPlan) Changes() ([]FileChange, error) {
+	changes := make([]FileChange, 0, len(cp.Files))
+	for _, file := range cp.Files {
+		if file.Path == "" || strings.HasPrefix(file.Path, "/") || strings.Contains("/"+file.Path+"/", "/../") {
+			return nil, fmt.Errorf("invalid path %q in the plan", file.Path)
+		}
+		if file.Status == "deleted" {
+			changes = append(changes, FileChange{Path: file.Path, Deleted: true})
+			continue
+		}
+
+		switch file.Mode {
+		case "100644", "100755", "120000":
+		default:
+			return nil, fmt.Errorf("invalid mode %q for %s in the plan", file.Mode, file.Path)
+		}
+
+		var content []byte
+		var err error
+		if file.Content != "" {
+			content, err = base64.StdEncoding.DecodeString(file.Content)
+			if err != nil {
+				return nil, fmt.Errorf("invalid content for %s in the plan: %w", file.Path, err)
+			}
+		} else if file.BlobSha != HashBlob(nil) {
+			var localMode string
+			content, localMode, err = ReadLocalFile(filepath.FromSlash(file.Path))
+			if os.IsNotExist(err) {
+				return nil, fmt.Errorf("%s is not embedded in the plan and does not exist locally", file.Path)
+			}
+			if err != nil {
+				return nil, err
+			}
+			// Artifacts often lose the executable bit, so only the kind of file has to agree
+			if (localMode == "120000") != (file.Mode == "120000") {
+				return nil, fmt.Errorf("the mode of %s does not match the plan: expected %s, got %s", file.Path, file.Mode, localMode)
+			}
+		}
+		if content == nil {
+			content = []byte{}
+		}
+		if file.Mode == "120000" && (len(content) == 0 || bytes.ContainsAny(content, "\x00\n")) {
+			return nil, fmt.Errorf("the content of %s is not a symlink target, as its mode in the plan says", file.Path)
+		}
+
+		if sha := HashBlob(content); sha != file.BlobSha {
+			return nil, fmt.Errorf("the content of %s does not match the plan: expected blob %s, got %s",
+				file.Path, shortSha(file.BlobSha), shortSha(sha))
+		}
+		changes = append(changes, FileChange{Path: file.Path, Mode: file.Mode, Content: content})
+	}
+	return changes, nil
+}
+
+// RunSettings rebuilds the settings of the run the plan was made for.
+func (cp *CommitPlan) RunSettings(rs *RepoSettings, changes []FileChange) *RunSettings {
+	settings := &RunSettings{
+		CommitSettings:  &CommitSettings{CommitMessage: cp.Message, CommitToBranch: cp.Branch},
+		RepoSettings:    rs,
+		FileSelection:   changes,
+		AllowEmpty:      cp.AllowEmpty,
+		ExpectedBaseSha: cp.BaseSha,
+	}
+	if cp.PullRequest != nil {
+		settings.PrSettings = &PrSettings{
+			BaseRef:     cp.Branch,
+			HeadRef:     cp.PullRequest.HeadRef,
+			Title:       cp.PullRequest.Title,
+			Description: cp.PullRequest.Description,
+			Labels:      cp.PullRequest.Labels,
+		}
+		settings.CommitSettings.CommitToBranch = cp.PullRequest.HeadRef
+	}
+	return settings
+}
+
+// planTarget resolves the repository of a plan. It must agree with an explicit --repo or
+// --remote, or else with the repository of the current directory, so that a plan cannot
+// point the write token at another repository by itself.
+func planTarget(plan *CommitPlan, repoName, remoteName string) (repository.Repository, error) {
+	planned, err := repository.Parse(plan.Repository)
+	if err != nil {
+		return nil, fmt.Errorf("invalid repository %q in the plan: %w", plan.Repository, err)
+	}
+
+	explicit := repoName != "" || remoteName != ""
+	target, err := ResolveTargetRepository(repoName, remoteName)
+	if err != nil {
+		if !explicit {
+			return nil, fmt.Errorf("the plan was made for %s, pass --repo to apply it outside of a checkout of it: %w", plan.Repository, err)
+		}
+		return nil, err
+	}
+	if !strings.EqualFold(target.Host(), planned.Host()) || !strings.EqualFold(target.Owner(), planned.Owner()) ||
+		!strings.EqualFold(target.Name(), planned.Name()) {
+		if !explicit {
+			return nil, fmt.Errorf("the plan was made for %s, not the current repository %s/%s/%s; pass --repo to apply it anyway",
+				plan.Repository, target.Host(), target.Owner(), target.Name())
+		}
+		return nil, fmt.Errorf("the plan was made for %s, not %s/%s/%s",
+			plan.Repository, target.Host(), target.Owner(), target.Name())
+	}
+	return planned, nil
+}
+
+// MakePlan compares the selected files with the remote tree and records those that
+// differ. Nothing is written to the repository.
+func (rn *RunSettings) MakePlan(ctx context.Context, embed bool) (*CommitPlan, error) {
+	baseSha, err := rn.ResolveBase(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rn.Result.BaseSha = baseSha
+
+	baseTreeSha, err := GetTreeTip(ctx, baseSha)
+	if err != nil {
+		return nil, err
+	}
+
+	if rn.Mirror != nil {
+		remoteTree, err := GetRemoteTree(ctx, baseTreeSha, true)
+		if err != nil {
+			return nil, err
+		}
+		rn.FileSelection, err = rn.Mirror.Changes(remoteTree)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	patchTree := NewPatchTree(
+		baseTreeSha,
+		func(treeSha string) ([]TreeEntry, error) { return GetRemoteTree(ctx, treeSha, false) },
+		func(blobSha string) ([]byte, error) { return GetBlob(ctx, blobSha) },
+	)
+	planned, err := PlanChanges(rn.FileSelection, patchTree.Entry)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Fprintf(out, "\n%s\n", color.New(color.FgCyan, color.Bold).Sprintf("📦 Planned tree change of %s @ %s:", rn.baseBranch(), shortSha(baseSha)))
+	changed := printPlan(planned)
+	rn.Result.SetPlan(planned)
+	if changed == 0 && !rn.AllowEmpty {
+		fmt.Fprintf(out, "%s Nothing to commit, the tree of %s would not change\n",
+			color.New(color.FgGreen).Sprint("✨"), rn.baseBranch())
+		rn.Result.NoChanges = true
+		return nil, nil
+	}
+
+	if rn.Diff && changed > 0 {
+		fmt.Fprintln(out)
+		if err = PrintDiffs(planned, func(blobSha string) ([]byte, error) { return GetBlob(ctx, blobSha) }); err != nil {
+			return nil, err
+		}
+	}
+	return rn.NewCommitPlan(baseSha, planned, embed)
+}
+
+// Write saves the plan to a file, or prints it to stdout for -.
+func (cp *CommitPlan) Write(output string) error {
+	data, err := json.MarshalIndent(cp, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	if output == "-" {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+	if err = os.WriteFile(output, data, 0644); err != nil {
+		return fmt.Errorf("failed to write plan: %w", err)
+	}
+	return nil
+}
+
+var planCmd = &cobra.Command{
+	Use:   "plan [files]",
+	Short: "Write a commit plan that `gh commit apply` can commit later",
+	Args:  cobra.ArbitraryArgs,
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		sources, err := LoadConfig(cmd, planFlags)
+		if err != nil {
+			return err
+		}
+		if printConfig, _ := cmd.Flags().GetBool(PrintConfig.Long); printConfig {
+			PrintResolvedConfig(cmd, planFlags, sources)
+			os.Exit(0)
+		}
+
+		output, _ := cmd.Flags().GetString(OutputFlag.Long)
+		if output == "" {
+			return fmt.Errorf("--output is a required flag, or %s", EnvName(OutputFlag))
+		}
+		if output == "-" {
+			UseJSONOutput()
+		}
+		return validateRunFlags(cmd, args)
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx, finishRun, err := StartRun(cmd)
+		if err != nil {
+			return err
+		}
+		defer finishRun()
+
+		repoSettings, err := connectRun(ctx, cmd)
+		if err != nil {
+			return err
+		}
+
+		settings, err := ValidateAndConfigureRun(args, cmd, repoSettings)
+		if err != nil {
+			return err
+		}
+
+		noContent, _ := cmd.Flags().GetBool(NoContent.Long)
+		plan, err := settings.MakePlan(ctx, !noContent)
+		if err != nil {
+			return err
+		}
+		settings.Result.ExportGitHubActions()
+		if plan == nil {
+			PrintRateLimit()
+			os.Exit(ExitNoChanges)
+		}
+
+		output, _ := cmd.Flags().GetString(OutputFlag.Long)
+		if err = plan.Write(output); err != nil {
+			return err
+		}
+		if output != "-" {
+			fmt.Fprintf(out, "%s Wrote a plan of %d file(s) to %s\n",
+				color.New(color.FgGreen).Sprint("✅"), len(plan.Files), output)
+		}
+		return nil
+	},
+}
@@ -0,0 +1,247 @@
+package cmd
+
+import (
+	"encoding/base64"
+	"errors"
+	"github.com/cli/go-gh/pkg/repository"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCommitPlanRoundTrip(t *testing.T) {
+	originalRepo := repo
+	defer func() { repo = originalRepo }()
+	target, err := repository.Parse("github.com/kassett/gh-commit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo = target
+
+	rn := &RunSettings{
+		PrSettings:     &PrSettings{BaseRef: "main", HeadRef: "main-update", Title: "Update", Description: "Body", Labels: []string{"bot"}},
+		CommitSettings: &CommitSettings{CommitMessage: "chore: update", CommitToBranch: "main-update"},
+	}
+	planned := []PlannedChange{
+		{FileChange: FileChange{Path: "new.txt", Mode: "100644", Content: []byte("new\n")}, Status: "added", LocalSha: HashBlob([]byte("new\n"))},
+		{FileChange: FileChange{Path: "same.txt", Mode: "100644", Content: []byte("same\n")}, Status: "unchanged", LocalSha: HashBlob([]byte("same\n"))},
+		{FileChange: FileChange{Path: "old.txt", Deleted: true}, Status: "deleted"},
+	}
+
+	plan, err := rn.NewCommitPlan("abc123", planned, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plan.Repository != "github.com/kassett/gh-commit" || plan.Branch != "main" || plan.BaseSha != "abc123" {
+		t.Errorf("unexpected plan target: %s %s %s", plan.Repository, plan.Branch, plan.BaseSha)
+	}
+	if len(plan.Files) != 2 {
+		t.Fatalf("expected unchanged files to be left out, got %d files", len(plan.Files))
+	}
+
+	output := filepath.Join(t.TempDir(), "plan.json")
+	if err = plan.Write(output); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, isPlan, err := ParseCommitPlan(data)
+	if err != nil || !isPlan {
+		t.Fatalf("expected a plan, got %v, %v", isPlan, err)
+	}
+	changes, err := parsed.Changes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 2 || string(changes[0].Content) != "new\n" || !changes[1].Deleted {
+		t.Errorf("unexpected changes: %+v", changes)
+	}
+
+	settings := parsed.RunSettings(&RepoSettings{}, changes)
+	if settings.ExpectedBaseSha != "abc123" || settings.baseBranch() != "main" {
+		t.Errorf("expected the plan to target main @ abc123, got %s @ %s", settings.baseBranch(), settings.ExpectedBaseSha)
+	}
+	if settings.PrSettings == nil || settings.CommitSettings.CommitToBranch != "main-update" || !equal(settings.PrSettings.Labels, []string{"bot"}) {
+		t.Errorf("expected the PR settings to be restored, got %+v", settings.PrSettings)
+	}
+}
+
+func TestParseCommitPlan(t *testing.T) {
+	tests := []struct {
+		name           string
+		data           string
+		expectedIsPlan bool
+		expectedError  bool
+	}{
+		{name: "Patch", data: "diff --git a/x b/x\n", expectedIsPlan: false},
+		{name: "Mbox", data: "From 1234 Mon Sep 17 00:00:00 2001\n", expectedIsPlan: false},
+		{name: "Plan", data: `{"format":"gh-commit-plan/v1","repository":"github.com/o/r","branch":"main","base_sha":"abc","message":"m","files":[]}`, expectedIsPlan: true},
+		{name: "Other format", data: `{"format":"gh-commit-plan/v9"}`, expectedError: true},
+		{name: "Missing base", data: `{"format":"gh-commit-plan/v1","repository":"github.com/o/r","branch":"main","message":"m"}`, expectedError: true},
+		{name: "Invalid JSON", data: `{"format":`, expectedError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, isPlan, err := ParseCommitPlan([]byte(tt.data))
+			if (err != nil) != tt.expectedError {
+				t.Fatalf("expected error: %v, got: %v", tt.expectedError, err)
+			}
+			if isPlan != tt.expectedIsPlan {
+				t.Errorf("expected isPlan %v, got %v", tt.expectedIsPlan, isPlan)
+			}
+		})
+	}
+}
+
+func TestCommitPlanChanges(t *testing.T) {
+	encode := func(s string) string { return base64.StdEncoding.EncodeToString([]byte(s)) }
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "artifact.txt"), []byte("from disk\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("artifact.txt", filepath.Join(dir, "link")); err != nil {
+		t.Fatal(err)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.Chdir(wd) }()
+
+	tests := []struct {
+		name          string
+		file          PlanFile
+		expected      string
+		expectedError string
+	}{
+		{
+			name:     "Embedded",
+			file:     PlanFile{Path: "a.txt", Status: "added", Mode: "100644", BlobSha: HashBlob([]byte("a\n")), Content: encode("a\n")},
+			expected: "a\n",
+		},
+		{
+			name:     "Empty file",
+			file:     PlanFile{Path: "empty.txt", Status: "added", Mode: "100644", BlobSha: HashBlob(nil)},
+			expected: "",
+		},
+		{
+			name:     "Read from the working directory",
+			file:     PlanFile{Path: "artifact.txt", Status: "modified", Mode: "100755", BlobSha: HashBlob([]byte("from disk\n"))},
+			expected: "from disk\n",
+		},
+		{
+			name:          "Tampered content",
+			file:          PlanFile{Path: "a.txt", Status: "added", Mode: "100644", BlobSha: HashBlob([]byte("a\n")), Content: encode("b\n")},
+			expectedError: "the content of a.txt does not match the plan",
+		},
+		{
+			name:          "Missing locally",
+			file:          PlanFile{Path: "missing.txt", Status: "added", Mode: "100644", BlobSha: HashBlob([]byte("a\n"))},
+			expectedError: "missing.txt is not embedded in the plan and does not exist locally",
+		},
+		{
+			name:          "Escaping path",
+			file:          PlanFile{Path: "../outside.txt", Status: "added", Mode: "100644", BlobSha: HashBlob([]byte("a\n")), Content: encode("a\n")},
+			expectedError: "invalid path",
+		},
+		{
+			name:          "Submodule",
+			file:          PlanFile{Path: "vendor/lib", Status: "added", Mode: "160000", BlobSha: HashBlob([]byte("a\n")), Content: encode("a\n")},
+			expectedError: `invalid mode "160000" for vendor/lib in the plan`,
+		},
+		{
+			name:     "Embedded symlink",
+			file:     PlanFile{Path: "latest", Status: "added", Mode: "120000", BlobSha: HashBlob([]byte("v1.2")), Content: encode("v1.2")},
+			expected: "v1.2",
+		},
+		{
+			name:          "Embedded symlink that is not a target",
+			file:          PlanFile{Path: "latest", Status: "added", Mode: "120000", BlobSha: HashBlob([]byte("a\nb\n")), Content: encode("a\nb\n")},
+			expectedError: "the content of latest is not a symlink target",
+		},
+		{
+			name:     "Symlink read from the working directory",
+			file:     PlanFile{Path: "link", Status: "added", Mode: "120000", BlobSha: HashBlob([]byte("artifact.txt"))},
+			expected: "artifact.txt",
+		},
+		{
+			name:          "Symlink planned as a file",
+			file:          PlanFile{Path: "link", Status: "added", Mode: "100644", BlobSha: HashBlob([]byte("artifact.txt"))},
+			expectedError: "the mode of link does not match the plan",
+		},
+		{
+			name:          "File planned as a symlink",
+			file:          PlanFile{Path: "artifact.txt", Status: "modified", Mode: "120000", BlobSha: HashBlob([]byte("from disk\n"))},
+			expectedError: "the mode of artifact.txt does not match the plan",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan := &CommitPlan{Files: []PlanFile{tt.file}}
+			changes, err := plan.Changes()
+			if tt.expectedError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectedError) {
+					t.Fatalf("expected error %q, got %v", tt.expectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if string(changes[0].Content) != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, changes[0].Content)
+			}
+		})
+	}
+}
+
+func TestPlanTarget(t *testing.T) {
+	originalCurrent := currentRepository
+	defer func() { currentRepository = originalCurrent }()
+	plan := &CommitPlan{Repository: "github.com/kassett/gh-commit"}
+
+	tests := []struct {
+		name          string
+		repoName      string
+		current       string
+		expectedError string
+	}{
+		{name: "Current checkout", current: "kassett/gh-commit"},
+		{name: "Matching --repo", repoName: "Kassett/GH-Commit"},
+		{name: "Other --repo", repoName: "someone/else", expectedError: "the plan was made for github.com/kassett/gh-commit, not github.com/someone/else"},
+		{name: "Other checkout", current: "someone/else", expectedError: "not the current repository github.com/someone/else; pass --repo"},
+		{name: "No checkout", expectedError: "pass --repo to apply it outside of a checkout of it"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			currentRepository = func() (repository.Repository, error) {
+				if tt.current == "" {
+					return nil, errors.New("not a git repository")
+				}
+				return repository.Parse(tt.current)
+			}
+
+			target, err := planTarget(plan, tt.repoName, "")
+			if tt.expectedError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectedError) {
+					t.Errorf("expected error %q, got %v", tt.expectedError, err)
+				}
+				return
+			}
+			if err != nil || target.Owner() != "kassett" || target.Name() != "gh-commit" {
+				t.Errorf("expected the repository of the plan, got %v, %v", target, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"github.com/mattn/go-isatty"
+	"io"
+	"os"
+	"strings"
+)
+
+// promptInput is shared by all prompts, so that answers typed ahead are not lost to a
+// reader that is thrown away.
+var promptInput = bufio.NewReader(os.Stdin)
+
+// errCancelled is returned when the user backs out of the picker or a confirmation.
+var errCancelled = errors.New("the commit was cancelled, nothing was written")
+
+// isInteractive reports whether there is someone at a terminal to answer prompts.
+func isInteractive() bool {
+	return (isatty.IsTerminal(os.Stdin.Fd()) || isatty.IsCygwinTerminal(os.Stdin.Fd())) && !isGitHubAction()
+}
+
+// readAnswer reads a line typed at a prompt, without its line ending.
+func readAnswer() (string, error) {
+	answer, err := promptInput.ReadString('\n')
+	if err != nil && (answer == "" || !errors.Is(err, io.EOF)) {
+		return "", fmt.Errorf("failed to read the answer: %w", err)
+	}
+	return strings.TrimSpace(answer), nil
+}
+
+// confirm asks a yes/no question on the terminal. Anything but yes counts as no.
+func confirm(question string) (bool, error) {
+	fmt.Fprintf(out, "%s [y/N] ", question)
+	answer, err := readAnswer()
+	if err != nil {
+		return false, err
+	}
+
+	switch strings.ToLower(answer) {
+	case "y", "yes":
+		return true, nil
+	default:
+		return false, nil
+	}
+}
@@ -0,0 +1,382 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/fatih/color"
+	"github.com/google/uuid"
+	"github.com/spf13/cobra"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+var (
+	PruneDryRun = Flag{Short: "d", Long: "dry-run", Description: "List the branches and whether they would be pruned, without deleting anything.", Type: "bool", Default: "false"}
+	PatternFlag = Flag{Long: "pattern", Description: "Prune the branches whose name matches this glob, e.g. 'deps-*', instead of the head refs gh-commit generates (<base>-<uuidv7>).", Type: "string"}
+	OlderThan   = Flag{Long: "older-than", Description: "Only prune branches created longer ago than this, e.g. 36h or 14d, as told by the UUIDv7 in their name. Branches without one are kept.", Type: "string"}
+)
+
+var pruneFlags = []Flag{
+	PruneDryRun,
+	PatternFlag,
+	OlderThan,
+	RepoFlag,
+	RemoteFlag,
+	YesFlag,
+	TimeoutFlag,
+	VerboseFlag,
+	ProfileFlag,
+	PrintConfig,
+}
+
+// minAbandonedAge is how old a branch without a pull request must be to be pruned, so that
+// the branch of a run that is still opening its pull request is left alone.
+const minAbandonedAge = 24 * time.Hour
+
+// generatedHeadRef matches the head refs of --use-pr without --head-ref: the base branch
+// and a UUIDv7.
+var generatedHeadRef = regexp.MustCompile(`^(.+)-([0-9a-f]{8}-[0-9a-f]{4}-7[0-9a-f]{3}-[0-9a-f]{4}-[0-9a-f]{12})$`)
+
+// RefResponse is a ref listed by the git database API.
+type RefResponse struct {
+	Ref    string `json:"ref"`
+	Object struct {
+		Sha string `json:"sha"`
+	} `json:"object"`
+}
+
+// StaleBranch is a branch that gh-commit may have created, with the reason to prune it or
+// keep it.
+type StaleBranch struct {
+	Name    string
+	Sha     string
+	Created time.Time
+	Reason  string
+	Prune   bool
+}
+
+// parseAge reads a duration, which unlike time.ParseDuration may be given in days.
+func parseAge(value string) (time.Duration, error) {
+	if days, found := strings.CutSuffix(value, "d"); found {
+		count, err := strconv.Atoi(days)
+		if err != nil || count < 0 {
+			return 0, fmt.Errorf("invalid age %q, expected e.g. 36h or 14d", value)
+		}
+		return time.Duration(count) * 24 * time.Hour, nil
+	}
+	age, err := time.ParseDuration(value)
+	if err != nil || age < 0 {
+		return 0, fmt.Errorf("invalid age %q, expected e.g. 36h or 14d", value)
+	}
+	return age, nil
+}
+
+// headRefCreated tells when a generated head ref was created, from the UUIDv7 in its name.
+func headRefCreated(branch string) (time.Time, bool) {
+	match := generatedHeadRef.FindStringSubmatch(branch)
+	if match == nil {
+		return time.Time{}, false
+	}
+	id, err := uuid.Parse(match[2])
+	if err != nil || id.Version() != 7 {
+		return time.Time{}, false
+	}
+	sec, nsec := id.Time().UnixTime()
+	return time.Unix(sec, nsec), true
+}
+
+// matchesBranch reports whether a branch is one to consider: a generated head ref, or one
+// matching the pattern if there is one.
+func matchesBranch(branch, pattern string) bool {
+	if pattern == "" {
+		return generatedHeadRef.MatchString(branch)
+	}
+	matched, _ := path.Match(pattern, branch)
+	return matched
+}
+
+// ListBranches lists the branches of the repository with their tips.
+func ListBranches(ctx context.Context) ([]RefResponse, error) {
+	var refs []RefResponse
+	err := client.DoWithContext(ctx, http.MethodGet, fmt.Sprintf("repos/%s/%s/git/matching-refs/heads/", repo.Owner(), repo.Name()), nil, &refs)
+	if err != nil {
+		return nil, errors.New(fmt.Sprint("error listing branches: ", err))
+	}
+	return refs, nil
+}
+
+// ListPullRequests lists the pull requests opened from a branch, in any state.
+func ListPullRequests(ctx context.Context, branch string) ([]PrResponse, error) {
+	var prs []PrResponse
+	head := url.QueryEscape(fmt.Sprintf("%s:%s", repo.Owner(), branch))
+	err := client.DoWithContext(ctx, http.MethodGet, fmt.Sprintf("repos/%s/%s/pulls?head=%s&state=all", repo.Owner(), repo.Name(), head), nil, &prs)
+	if err != nil {
+		return nil, errors.New(fmt.Sprint("error listing pull requests: ", err))
+	}
+	return prs, nil
+}
+
+// pruneReason decides from its pull requests whether a branch is done with. Branches with
+// an open PR are kept.
+func pruneReason(prs []PrResponse) (string, bool) {
+	if len(prs) == 0 {
+		return "no pull request", true
+	}
+	for _, pr := range prs {
+		if pr.State == "open" {
+			return fmt.Sprintf("pull request #%d is open", pr.Number), false
+		}
+	}
+	pr := prs[0]
+	if pr.MergedAt != nil {
+		return fmt.Sprintf("pull request #%d was merged", pr.Number), true
+	}
+	return fmt.Sprintf("pull request #%d was closed", pr.Number), true
+}
+
+// FindStaleBranches lists the branches matching the pattern, or the generated head refs,
+// and decides which of them to prune. The default branch and protected branches are never
+// pruned, nor are branches without a pull request unless they are known to be older than
+// minAbandonedAge.
+func FindStaleBranches(ctx context.Context, repoSettings *RepoSettings, pattern string, olderThan time.Duration, now time.Time) ([]StaleBranch, error) {
+	refs, err := ListBranches(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var branches []StaleBranch
+	for _, ref := range refs {
+		name := strings.TrimPrefix(ref.Ref, "refs/heads/")
+		if name == repoSettings.DefaultBranch || !matchesBranch(name, pattern) {
+			continue
+		}
+
+		branch := StaleBranch{Name: name, Sha: ref.Object.Sha}
+		created, known := headRefCreated(name)
+		branch.Created = created
+		if olderThan > 0 {
+			if !known {
+				branch.Reason = "age unknown"
+				branches = append(branches, branch)
+				continue
+			}
+			if now.Sub(created) < olderThan {
+				branch.Reason = "too recent"
+				branches = append(branches, branch)
+				continue
+			}
+		}
+
+		prs, err := ListPullRequests(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		branch.Reason, branch.Prune = pruneReason(prs)
+		if len(prs) == 0 {
+			switch {
+			case !known:
+				branch.Reason, branch.Prune = "no pull request, age unknown", false
+			case now.Sub(created) < minAbandonedAge:
+				branch.Reason, branch.Prune = "no pull request yet", false
+			}
+		}
+
+		if branch.Prune {
+			description, err := GetBranch(ctx, name)
+			if err != nil {
+				return nil, err
+			}
+			switch {
+			case description == nil:
+				branch.Reason, branch.Prune = "no longer exists", false
+			case description.Protected:
+				branch.Reason, branch.Prune = "protected", false
+			}
+		}
+		branches = append(branches, branch)
+	}
+	return branches, nil
+}
+
+// describeAge says how long ago a branch was created, roughly.
+func describeAge(created time.Time, now time.Time) string {
+	if created.IsZero() {
+		return ""
+	}
+	age := now.Sub(created)
+	switch {
+	case age >= 48*time.Hour:
+		return fmt.Sprintf("%d days old", int(age.Hours()/24))
+	case age >= 2*time.Hour:
+		return fmt.Sprintf("%d hours old", int(age.Hours()))
+	}
+	return fmt.Sprintf("%d minutes old", int(age.Minutes()))
+}
+
+// printStaleBranches lists the branches with the reason to prune or keep them, and returns
+// how many are to be pruned.
+func printStaleBranches(branches []StaleBranch, now time.Time) int {
+	count := 0
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	for i, branch := range branches {
+		index := color.New(color.FgYellow).Sprintf("%d.", i+1)
+		action := color.New(color.FgHiBlack).Sprint("keep")
+		if branch.Prune {
+			action = color.New(color.FgRed).Sprint("prune")
+			count++
+		}
+		_, _ = fmt.Fprintf(w, "   %s\t%s\t%s\t%s\t%s\n", index, action, branch.Name, branch.Reason, describeAge(branch.Created, now))
+	}
+	_ = w.Flush()
+	fmt.Fprintf(out, "   %d to prune, %d to keep\n", count, len(branches)-count)
+	return count
+}
+
+// PruneBranches deletes the branches to prune, as long as they still point where they did
+// when they were listed, and returns the ones that could not be deleted. An interrupt stops
+// it between two branches.
+func PruneBranches(ctx context.Context, branches []StaleBranch) ([]string, error) {
+	progress := NewProgress()
+	for _, branch := range branches {
+		if branch.Prune {
+			progress.Add(fmt.Sprintf("delete %s", branch.Name))
+		}
+	}
+
+	var failures []string
+	for _, branch := range branches {
+		if !branch.Prune {
+			continue
+		}
+		if err := progress.Next(ctx); err != nil {
+			return failures, err
+		}
+		if err := DeleteBranch(ctx, repo, branch.Name, branch.Sha); err != nil {
+			fmt.Fprintf(out, "   %s %s: %s\n", color.New(color.FgRed).Sprint("✘"), branch.Name, err)
+			failures = append(failures, fmt.Sprintf("%s: %s", branch.Name, err))
+			continue
+		}
+		fmt.Fprintf(out, "   %s %s\n", color.New(color.FgGreen).Sprint("✔"), branch.Name)
+	}
+	return failures, nil
+}
+
+const pruneHelpText = `gh-commit prune: Delete the branches gh-commit left behind.
+
+Lists the head refs --use-pr generates, <base>-<uuidv7>, or the branches
+matching --pattern, and prunes those whose pull request was merged or closed,
+or that never had one and are over a day old, as told by their UUIDv7.
+Branches with an open pull request, protected branches and the default branch
+are kept. With --older-than, only branches whose UUIDv7 is older are pruned:
+
+  gh commit prune --dry-run
+  gh commit prune --older-than 14d --yes
+
+A branch is only deleted if it still points where it did when it was listed.
+Without a terminal to confirm in, --yes is required to delete anything.
+
+Synopsis:
+  gh commit prune [flags]
+
+Flags:
+`
+
+var pruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Delete the head refs of merged, closed or abandoned pull requests",
+	Args:  cobra.NoArgs,
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		sources, err := LoadConfig(cmd, pruneFlags)
+		if err != nil {
+			return err
+		}
+		if printConfig, _ := cmd.Flags().GetBool(PrintConfig.Long); printConfig {
+			PrintResolvedConfig(cmd, pruneFlags, sources)
+			os.Exit(0)
+		}
+
+		repoName, _ := cmd.Flags().GetString(RepoFlag.Long)
+		remoteName, _ := cmd.Flags().GetString(RemoteFlag.Long)
+		if repoName != "" && remoteName != "" {
+			return errors.New("`repo` and `remote` cannot be used together")
+		}
+		if pattern, _ := cmd.Flags().GetString(PatternFlag.Long); pattern != "" {
+			if _, err = path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("invalid pattern %q: %w", pattern, err)
+			}
+		}
+		if olderThan, _ := cmd.Flags().GetString(OlderThan.Long); olderThan != "" {
+			if _, err = parseAge(olderThan); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx, finishRun, err := StartRun(cmd)
+		if err != nil {
+			return err
+		}
+		defer finishRun()
+
+		repoName, _ := cmd.Flags().GetString(RepoFlag.Long)
+		remoteName, _ := cmd.Flags().GetString(RemoteFlag.Long)
+		target, err := ResolveTargetRepository(repoName, remoteName)
+		if err != nil {
+			return err
+		}
+		repoSettings, err := ValidateGitRemote(ctx, target)
+		if err != nil {
+			return err
+		}
+
+		pattern, _ := cmd.Flags().GetString(PatternFlag.Long)
+		var olderThan time.Duration
+		if value, _ := cmd.Flags().GetString(OlderThan.Long); value != "" {
+			olderThan, _ = parseAge(value)
+		}
+
+		now := time.Now()
+		branches, err := FindStaleBranches(ctx, repoSettings, pattern, olderThan, now)
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(out, "%s\n", color.New(color.FgCyan, color.Bold).Sprintf("🧹 Branches of %s/%s:", repo.Owner(), repo.Name()))
+		count := printStaleBranches(branches, now)
+		dryRun, _ := cmd.Flags().GetBool(PruneDryRun.Long)
+		if count == 0 || dryRun {
+			return nil
+		}
+
+		if yes, _ := cmd.Flags().GetBool(YesFlag.Long); !yes {
+			if !isInteractive() {
+				return fmt.Errorf("pass --yes to delete %d branch(es) without a terminal to confirm in, nothing was deleted", count)
+			}
+			confirmed, err := confirm(fmt.Sprintf("Delete %d branch(es) from %s/%s?", count, repo.Owner(), repo.Name()))
+			if err != nil {
+				return err
+			}
+			if !confirmed {
+				return errors.New("pruning was cancelled, nothing was deleted")
+			}
+		}
+
+		failures, err := PruneBranches(ctx, branches)
+		if err != nil {
+			return err
+		}
+		if len(failures) > 0 {
+			return fmt.Errorf("could not delete %d branch(es): %s", len(failures), strings.Join(failures, "; "))
+		}
+		return nil
+	},
+}
@@ -0,0 +1,225 @@
+package cmd
+
+import (
+	"context"
+	"github.com/cli/go-gh/pkg/repository"
+	"testing"
+	"time"
+)
+
+// headRefAt is a generated head ref of main, created at the given time.
+func headRefAt(created time.Time) string {
+	return "main-" + uuidV7(created.UnixMilli())
+}
+
+// uuidV7 is a UUIDv7 holding the given Unix time in milliseconds.
+func uuidV7(ms int64) string {
+	hex := "0123456789abcdef"
+	digits := make([]byte, 12)
+	for i := 11; i >= 0; i-- {
+		digits[i] = hex[ms&0xf]
+		ms >>= 4
+	}
+	return string(digits[:8]) + "-" + string(digits[8:]) + "-7abc-8def-0123456789ab"
+}
+
+func TestParseAge(t *testing.T) {
+	tests := []struct {
+		value       string
+		expected    time.Duration
+		expectError bool
+	}{
+		{value: "14d", expected: 14 * 24 * time.Hour},
+		{value: "36h", expected: 36 * time.Hour},
+		{value: "90m", expected: 90 * time.Minute},
+		{value: "d", expectError: true},
+		{value: "-1d", expectError: true},
+		{value: "two weeks", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			age, err := parseAge(tt.value)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("expected an error, got %v", age)
+				}
+				return
+			}
+			if err != nil || age != tt.expected {
+				t.Errorf("expected %v, got %v (%v)", tt.expected, age, err)
+			}
+		})
+	}
+}
+
+func TestHeadRefCreated(t *testing.T) {
+	created := time.Date(2026, 10, 1, 12, 30, 0, 0, time.UTC)
+	tests := []struct {
+		name          string
+		branch        string
+		expectedKnown bool
+	}{
+		{name: "Generated head ref", branch: headRefAt(created), expectedKnown: true},
+		{name: "Base with a dash", branch: "release-1.2-" + uuidV7(created.UnixMilli()), expectedKnown: true},
+		{name: "UUIDv4", branch: "main-0190a6b2-1234-4abc-8def-0123456789ab"},
+		{name: "Plain branch", branch: "feature"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actual, known := headRefCreated(tt.branch)
+			if known != tt.expectedKnown {
+				t.Fatalf("expected known to be %v", tt.expectedKnown)
+			}
+			if known && !actual.Equal(created) {
+				t.Errorf("expected %v, got %v", created, actual)
+			}
+		})
+	}
+}
+
+func TestMatchesBranch(t *testing.T) {
+	generated := headRefAt(time.Now())
+	tests := []struct {
+		branch   string
+		pattern  string
+		expected bool
+	}{
+		{branch: generated, expected: true},
+		{branch: "feature", expected: false},
+		{branch: "deps-update", pattern: "deps-*", expected: true},
+		{branch: generated, pattern: "deps-*", expected: false},
+		{branch: "deps/update", pattern: "deps-*", expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.branch+" "+tt.pattern, func(t *testing.T) {
+			if actual := matchesBranch(tt.branch, tt.pattern); actual != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, actual)
+			}
+		})
+	}
+}
+
+func TestFindStaleBranches(t *testing.T) {
+	target, err := repository.Parse("kassett/gh-commit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	originalRepo, originalClient := repo, client
+	defer func() { repo, client = originalRepo, originalClient }()
+	repo = target
+
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	merged := headRefAt(now.Add(-30 * 24 * time.Hour))
+	closed := headRefAt(now.Add(-20 * 24 * time.Hour))
+	open := headRefAt(now.Add(-10 * 24 * time.Hour))
+	abandoned := headRefAt(now.Add(-3 * 24 * time.Hour))
+	recent := headRefAt(now.Add(-time.Hour))
+	release := headRefAt(now.Add(-40 * 24 * time.Hour))
+	pulls := func(branch string) string {
+		return "repos/kassett/gh-commit/pulls?head=kassett%3A" + branch + "&state=all"
+	}
+	client = &MockRESTClient{Responses: map[string]string{
+		"repos/kassett/gh-commit/git/matching-refs/heads/": `[
+			{"ref": "refs/heads/main", "object": {"sha": "a"}},
+			{"ref": "refs/heads/feature", "object": {"sha": "b"}},
+			{"ref": "refs/heads/feat-wip", "object": {"sha": "i"}},
+			{"ref": "refs/heads/` + merged + `", "object": {"sha": "c"}},
+			{"ref": "refs/heads/` + closed + `", "object": {"sha": "d"}},
+			{"ref": "refs/heads/` + open + `", "object": {"sha": "e"}},
+			{"ref": "refs/heads/` + abandoned + `", "object": {"sha": "f"}},
+			{"ref": "refs/heads/` + recent + `", "object": {"sha": "g"}},
+			{"ref": "refs/heads/` + release + `", "object": {"sha": "h"}}
+		]`,
+		pulls(merged):     `[{"number": 1, "state": "closed", "merged_at": "2026-09-20T12:00:00Z"}]`,
+		pulls(closed):     `[{"number": 2, "state": "closed", "merged_at": null}]`,
+		pulls(open):       `[{"number": 3, "state": "open"}]`,
+		pulls(abandoned):  `[]`,
+		pulls(recent):     `[]`,
+		pulls(release):    `[{"number": 4, "state": "closed", "merged_at": "2026-09-10T12:00:00Z"}]`,
+		pulls("feature"):  `[{"number": 5, "state": "closed", "merged_at": null}]`,
+		pulls("feat-wip"): `[]`,
+		"repos/kassett/gh-commit/branches/" + merged:    `{"commit": {"sha": "c"}, "protected": false}`,
+		"repos/kassett/gh-commit/branches/" + closed:    `{"commit": {"sha": "d"}, "protected": false}`,
+		"repos/kassett/gh-commit/branches/" + abandoned: `{"commit": {"sha": "f"}, "protected": false}`,
+		"repos/kassett/gh-commit/branches/" + release:   `{"commit": {"sha": "h"}, "protected": true}`,
+		"repos/kassett/gh-commit/branches/feature":      `{"commit": {"sha": "b"}, "protected": false}`,
+	}}
+	repoSettings := &RepoSettings{DefaultBranch: "main"}
+
+	tests := []struct {
+		name            string
+		pattern         string
+		olderThan       time.Duration
+		expectedPrune   []string
+		expectedReasons []string
+	}{
+		{
+			name:          "Generated head refs",
+			expectedPrune: []string{merged, closed, abandoned},
+			expectedReasons: []string{
+				"pull request #1 was merged",
+				"pull request #2 was closed",
+				"pull request #3 is open",
+				"no pull request",
+				"no pull request yet",
+				"protected",
+			},
+		},
+		{
+			name:          "Older than a day",
+			olderThan:     24 * time.Hour,
+			expectedPrune: []string{merged, closed, abandoned},
+			expectedReasons: []string{
+				"pull request #1 was merged",
+				"pull request #2 was closed",
+				"pull request #3 is open",
+				"no pull request",
+				"too recent",
+				"protected",
+			},
+		},
+		{
+			name:            "Pattern",
+			pattern:         "feat*",
+			expectedPrune:   []string{"feature"},
+			expectedReasons: []string{"pull request #5 was closed", "no pull request, age unknown"},
+		},
+		{
+			name:            "Pattern without an age",
+			pattern:         "feat*",
+			olderThan:       24 * time.Hour,
+			expectedReasons: []string{"age unknown", "age unknown"},
+		},
+		{
+			name:            "Pattern matching the default branch",
+			pattern:         "mai?",
+			expectedReasons: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			branches, err := FindStaleBranches(context.Background(), repoSettings, tt.pattern, tt.olderThan, now)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			var pruned, reasons []string
+			for _, branch := range branches {
+				if branch.Prune {
+					pruned = append(pruned, branch.Name)
+				}
+				reasons = append(reasons, branch.Reason)
+			}
+			if !equal(pruned, tt.expectedPrune) {
+				t.Errorf("expected to prune %v, got %v", tt.expectedPrune, pruned)
+			}
+			if !equal(reasons, tt.expectedReasons) {
+				t.Errorf("expected reasons %v, got %v", tt.expectedReasons, reasons)
+			}
+		})
+	}
+}
@@ -0,0 +1,277 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/fatih/color"
+	"io"
+	"math/rand"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// maxRetries is how often a request is sent again before its response is returned as is
+	maxRetries = 5
+	// maxRetryWait is the longest the run waits for a rate limit to reset. Longer waits
+	// fail the run instead, as it would likely be cut off by CI anyway.
+	maxRetryWait = 5 * time.Minute
+	// secondaryLimitWait is how long GitHub asks to wait after hitting a secondary rate
+	// limit without saying so in Retry-After
+	secondaryLimitWait = time.Minute
+)
+
+// repeatablePosts are the POST and PATCH requests that leave the repository as they are
+// when sent twice: git objects are addressed by their content, forking and syncing a fork
+// are idempotent, and so is pointing a ref at the same commit again.
+var repeatablePosts = []*regexp.Regexp{
+	regexp.MustCompile(`/git/(blobs|trees|commits)$`),
+	regexp.MustCompile(`/git/refs/heads/.+$`),
+	regexp.MustCompile(`/(forks|merge-upstream)$`),
+	regexp.MustCompile(`/pulls/\d+$`),
+}
+
+// RateLimit is the rate-limit budget as of the last response.
+type RateLimit struct {
+	Limit     int
+	Remaining int
+	Reset     time.Time
+	Resource  string
+}
+
+// retryTransport sends requests again when GitHub fails them in passing: on rate limits,
+// whichever the method, as rate-limited requests are not processed, and on server errors
+// and broken connections, only if the request is safe to repeat.
+type retryTransport struct {
+	base  http.RoundTripper
+	sleep func(ctx context.Context, wait time.Duration) error
+	now   func() time.Time
+
+	mu        sync.Mutex
+	rateLimit *RateLimit
+	retries   int
+}
+
+// verbose is set by --verbose.
+var verbose bool
+
+// transport is shared by every client of the run, so that the rate limit is tracked across
+// all of them.
+var transport = newRetryTransport(http.DefaultTransport)
+
+func newRetryTransport(base http.RoundTripper) *retryTransport {
+	return &retryTransport{base: base, sleep: sleepContext, now: time.Now}
+}
+
+// sleepContext waits, unless the context is done first.
+func sleepContext(ctx context.Context, wait time.Duration) error {
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return context.Cause(ctx)
+	case <-timer.C:
+		return nil
+	}
+}
+
+// safeToRepeat reports whether sending a request twice has the same effect as sending it once.
+func safeToRepeat(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	case http.MethodPost, http.MethodPatch:
+		for _, pattern := range repeatablePosts {
+			if pattern.MatchString(req.URL.Path) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// backoff is the wait before the given retry, doubling each time, with jitter so that
+// parallel jobs do not retry in lockstep.
+func backoff(retry int) time.Duration {
+	wait := time.Second << retry
+	return wait/2 + time.Duration(rand.Int63n(int64(wait/2)+1))
+}
+
+// parseRateLimit reads the rate-limit headers of a response, if it has them.
+func parseRateLimit(header http.Header) *RateLimit {
+	remaining, err := strconv.Atoi(header.Get("X-RateLimit-Remaining"))
+	if err != nil {
+		return nil
+	}
+	limit, _ := strconv.Atoi(header.Get("X-RateLimit-Limit"))
+	reset, _ := strconv.ParseInt(header.Get("X-RateLimit-Reset"), 10, 64)
+	return &RateLimit{
+		Limit:     limit,
+		Remaining: remaining,
+		Reset:     time.Unix(reset, 0),
+		Resource:  header.Get("X-RateLimit-Resource"),
+	}
+}
+
+// retryWait tells how long to wait before sending a request again after a response, and
+// whether to send it again at all. It never waits longer than maxRetryWait.
+func (t *retryTransport) retryWait(req *http.Request, res *http.Response, retry int) (time.Duration, bool) {
+	// Retry-After comes with secondary rate limits and 503s, in seconds
+	retryAfter := time.Duration(-1)
+	if seconds, err := strconv.Atoi(res.Header.Get("Retry-After")); err == nil && seconds >= 0 {
+		retryAfter = time.Duration(seconds) * time.Second
+	}
+
+	switch {
+	case res.StatusCode == http.StatusForbidden || res.StatusCode == http.StatusTooManyRequests:
+		if retryAfter >= 0 {
+			return withinMaxWait(req, retryAfter, "Retry-After asks to wait")
+		}
+		if limit := parseRateLimit(res.Header); limit != nil && limit.Remaining == 0 {
+			// Without a reset still to come, there is nothing better than backing off
+			if wait := limit.Reset.Sub(t.now()); wait > 0 {
+				return withinMaxWait(req, wait+time.Second, "the rate limit only resets in")
+			}
+			return backoff(retry), true
+		}
+		if isSecondaryLimit(res) {
+			return min(secondaryLimitWait<<retry, maxRetryWait), true
+		}
+		return 0, false
+	case res.StatusCode >= 500 && safeToRepeat(req):
+		if retryAfter >= 0 {
+			return withinMaxWait(req, retryAfter, "Retry-After asks to wait")
+		}
+		return backoff(retry), true
+	}
+	return 0, false
+}
+
+// withinMaxWait lets a request be sent again after the wait GitHub asked for, unless that
+// is longer than maxRetryWait, in which case the request is given up on with a warning.
+func withinMaxWait(req *http.Request, wait time.Duration, reason string) (time.Duration, bool) {
+	if wait > maxRetryWait {
+		warn(fmt.Sprintf("Not retrying %s %s, %s %s", req.Method, req.URL.Path, reason, wait.Round(time.Second)))
+		return 0, false
+	}
+	return wait, true
+}
+
+// isSecondaryLimit reports whether a 403 or 429 is a secondary rate limit, which is only
+// told apart from a lack of rights by its message. The body is left for the client to read.
+func isSecondaryLimit(res *http.Response) bool {
+	if res.Body == nil {
+		return false
+	}
+	body, err := io.ReadAll(res.Body)
+	_ = res.Body.Close()
+	res.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return false
+	}
+	message := strings.ToLower(string(body))
+	return strings.Contains(message, "secondary rate limit") || strings.Contains(message, "abuse detection")
+}
+
+// rewind makes a request ready to be sent again, which needs a fresh copy of its body.
+func rewind(req *http.Request) (*http.Request, bool) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return req, true
+	}
+	if req.GetBody == nil {
+		return nil, false
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, false
+	}
+	again := req.Clone(req.Context())
+	again.Body = body
+	return again, true
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	for retry := 0; ; retry++ {
+		res, err := t.base.RoundTrip(req)
+		if err == nil {
+			t.track(res)
+		}
+		if retry >= maxRetries || req.Context().Err() != nil {
+			return res, err
+		}
+
+		var wait time.Duration
+		if err != nil {
+			// The request may or may not have reached GitHub
+			if !safeToRepeat(req) {
+				return res, err
+			}
+			wait = backoff(retry)
+		} else {
+			var again bool
+			if wait, again = t.retryWait(req, res, retry); !again {
+				return res, err
+			}
+		}
+
+		next, ok := rewind(req)
+		if !ok {
+			return res, err
+		}
+		reason := "the connection failed"
+		if res != nil {
+			reason = res.Status
+			_, _ = io.Copy(io.Discard, res.Body)
+			_ = res.Body.Close()
+		}
+		warn(fmt.Sprintf("Retrying %s %s in %s, %s", req.Method, req.URL.Path, wait.Round(time.Millisecond), reason))
+
+		if err := t.sleep(req.Context(), wait); err != nil {
+			return nil, err
+		}
+		t.mu.Lock()
+		t.retries++
+		t.mu.Unlock()
+		req = next
+	}
+}
+
+// track keeps the rate-limit budget of the last response of the core API, which is the one
+// the run spends.
+func (t *retryTransport) track(res *http.Response) {
+	limit := parseRateLimit(res.Header)
+	if limit == nil || (limit.Resource != "" && limit.Resource != "core") {
+		return
+	}
+	t.mu.Lock()
+	t.rateLimit = limit
+	t.mu.Unlock()
+}
+
+// RateLimit returns the rate-limit budget as of the last response, if any had one, and the
+// number of retries so far.
+func (t *retryTransport) RateLimit() (*RateLimit, int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.rateLimit, t.retries
+}
+
+// PrintRateLimit reports the remaining rate-limit budget and the retries of the run, with
+// --verbose.
+func PrintRateLimit() {
+	if !verbose {
+		return
+	}
+
+	limit, retries := transport.RateLimit()
+	summary := "unknown"
+	if limit != nil {
+		summary = fmt.Sprintf("%d of %d requests left, resets at %s", limit.Remaining, limit.Limit, limit.Reset.Local().Format("15:04:05"))
+	}
+	fmt.Fprintf(out, "%s Rate limit: %s, %d retried request(s)\n", color.New(color.FgCyan).Sprint("📉"), summary, retries)
+}
@@ -0,0 +1,311 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// scriptedResponse is a response, or a failed connection, of a scriptedTransport.
+type scriptedResponse struct {
+	status  int
+	headers map[string]string
+	body    string
+	err     error
+}
+
+// scriptedTransport answers requests with its responses in turn, repeating the last one,
+// and records the bodies it was sent.
+type scriptedTransport struct {
+	responses []scriptedResponse
+	bodies    []string
+}
+
+func (s *scriptedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	body := ""
+	if req.Body != nil {
+		data, _ := io.ReadAll(req.Body)
+		body = string(data)
+	}
+	s.bodies = append(s.bodies, body)
+
+	scripted := s.responses[min(len(s.bodies), len(s.responses))-1]
+	if scripted.err != nil {
+		return nil, scripted.err
+	}
+	res := &http.Response{
+		StatusCode: scripted.status,
+		Status:     fmt.Sprintf("%d %s", scripted.status, http.StatusText(scripted.status)),
+		Header:     http.Header{},
+		Body:       io.NopCloser(strings.NewReader(scripted.body)),
+		Request:    req,
+	}
+	for key, value := range scripted.headers {
+		res.Header.Set(key, value)
+	}
+	return res, nil
+}
+
+func TestRetryTransport(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	ok := scriptedResponse{status: http.StatusOK, body: `{}`}
+	badGateway := scriptedResponse{status: http.StatusBadGateway}
+	dropped := scriptedResponse{err: errors.New("connection reset by peer")}
+
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		responses      []scriptedResponse
+		expectedStatus int
+		expectedError  bool
+		expectedWaits  []time.Duration
+		expectedBody   string
+	}{
+		{
+			name:           "Server error on a read",
+			method:         http.MethodGet,
+			path:           "/repos/kassett/gh-commit",
+			responses:      []scriptedResponse{badGateway, ok},
+			expectedStatus: http.StatusOK,
+			expectedWaits:  []time.Duration{-1},
+		},
+		{
+			name:           "Server error creating a blob",
+			method:         http.MethodPost,
+			path:           "/repos/kassett/gh-commit/git/blobs",
+			responses:      []scriptedResponse{badGateway, badGateway, ok},
+			expectedStatus: http.StatusOK,
+			expectedWaits:  []time.Duration{-1, -1},
+		},
+		{
+			name:           "Server error opening a pull request",
+			method:         http.MethodPost,
+			path:           "/repos/kassett/gh-commit/pulls",
+			responses:      []scriptedResponse{badGateway, ok},
+			expectedStatus: http.StatusBadGateway,
+		},
+		{
+			name:           "Server error with Retry-After",
+			method:         http.MethodGet,
+			path:           "/repos/kassett/gh-commit",
+			responses:      []scriptedResponse{{status: http.StatusServiceUnavailable, headers: map[string]string{"Retry-After": "7"}}, ok},
+			expectedStatus: http.StatusOK,
+			expectedWaits:  []time.Duration{7 * time.Second},
+		},
+		{
+			name:           "Secondary rate limit with Retry-After opening a pull request",
+			method:         http.MethodPost,
+			path:           "/repos/kassett/gh-commit/pulls",
+			responses:      []scriptedResponse{{status: http.StatusForbidden, headers: map[string]string{"Retry-After": "3"}}, ok},
+			expectedStatus: http.StatusOK,
+			expectedWaits:  []time.Duration{3 * time.Second},
+		},
+		{
+			name:   "Primary rate limit",
+			method: http.MethodGet,
+			path:   "/repos/kassett/gh-commit",
+			responses: []scriptedResponse{{status: http.StatusForbidden, headers: map[string]string{
+				"X-RateLimit-Limit":     "5000",
+				"X-RateLimit-Remaining": "0",
+				"X-RateLimit-Reset":     strconv.FormatInt(now.Add(30*time.Second).Unix(), 10),
+			}}, ok},
+			expectedStatus: http.StatusOK,
+			expectedWaits:  []time.Duration{31 * time.Second},
+		},
+		{
+			name:   "Primary rate limit resetting too late",
+			method: http.MethodGet,
+			path:   "/repos/kassett/gh-commit",
+			responses: []scriptedResponse{{status: http.StatusForbidden, headers: map[string]string{
+				"X-RateLimit-Remaining": "0",
+				"X-RateLimit-Reset":     strconv.FormatInt(now.Add(time.Hour).Unix(), 10),
+			}}, ok},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:   "Primary rate limit without a reset",
+			method: http.MethodGet,
+			path:   "/repos/kassett/gh-commit",
+			responses: []scriptedResponse{{status: http.StatusForbidden, headers: map[string]string{
+				"X-RateLimit-Remaining": "0",
+			}}, ok},
+			expectedStatus: http.StatusOK,
+			expectedWaits:  []time.Duration{-1},
+		},
+		{
+			name:   "Primary rate limit that already reset",
+			method: http.MethodGet,
+			path:   "/repos/kassett/gh-commit",
+			responses: []scriptedResponse{{status: http.StatusForbidden, headers: map[string]string{
+				"X-RateLimit-Remaining": "0",
+				"X-RateLimit-Reset":     strconv.FormatInt(now.Add(-time.Minute).Unix(), 10),
+			}}, {status: http.StatusForbidden, headers: map[string]string{
+				"X-RateLimit-Remaining": "0",
+				"X-RateLimit-Reset":     strconv.FormatInt(now.Add(-time.Minute).Unix(), 10),
+			}}, ok},
+			expectedStatus: http.StatusOK,
+			expectedWaits:  []time.Duration{-1, -1},
+		},
+		{
+			name:           "Secondary rate limit without headers",
+			method:         http.MethodPost,
+			path:           "/repos/kassett/gh-commit/git/refs",
+			responses:      []scriptedResponse{{status: http.StatusForbidden, body: `{"message": "You have exceeded a secondary rate limit."}`}, ok},
+			expectedStatus: http.StatusOK,
+			expectedWaits:  []time.Duration{time.Minute},
+		},
+		{
+			name:   "Secondary rate limit that persists",
+			method: http.MethodPost,
+			path:   "/repos/kassett/gh-commit/git/refs",
+			responses: []scriptedResponse{
+				{status: http.StatusForbidden, body: `{"message": "You have exceeded a secondary rate limit."}`},
+			},
+			expectedStatus: http.StatusForbidden,
+			expectedWaits:  []time.Duration{time.Minute, 2 * time.Minute, 4 * time.Minute, 5 * time.Minute, 5 * time.Minute},
+		},
+		{
+			name:           "Rate limit with a Retry-After too long",
+			method:         http.MethodGet,
+			path:           "/repos/kassett/gh-commit",
+			responses:      []scriptedResponse{{status: http.StatusTooManyRequests, headers: map[string]string{"Retry-After": "3600"}}, ok},
+			expectedStatus: http.StatusTooManyRequests,
+		},
+		{
+			name:           "Forbidden",
+			method:         http.MethodPost,
+			path:           "/repos/kassett/gh-commit/git/refs/heads/main",
+			responses:      []scriptedResponse{{status: http.StatusForbidden, body: `{"message": "Resource not accessible by integration"}`}, ok},
+			expectedStatus: http.StatusForbidden,
+			expectedBody:   `{"message": "Resource not accessible by integration"}`,
+		},
+		{
+			name:           "Dropped connection on a read",
+			method:         http.MethodGet,
+			path:           "/repos/kassett/gh-commit",
+			responses:      []scriptedResponse{dropped, ok},
+			expectedStatus: http.StatusOK,
+			expectedWaits:  []time.Duration{-1},
+		},
+		{
+			name:          "Dropped connection creating a branch",
+			method:        http.MethodPost,
+			path:          "/repos/kassett/gh-commit/git/refs",
+			responses:     []scriptedResponse{dropped, ok},
+			expectedError: true,
+		},
+		{
+			name:           "Persistent server error",
+			method:         http.MethodGet,
+			path:           "/repos/kassett/gh-commit",
+			responses:      []scriptedResponse{badGateway},
+			expectedStatus: http.StatusBadGateway,
+			expectedWaits:  []time.Duration{-1, -1, -1, -1, -1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			base := &scriptedTransport{responses: tt.responses}
+			var waits []time.Duration
+			retrying := newRetryTransport(base)
+			retrying.now = func() time.Time { return now }
+			retrying.sleep = func(ctx context.Context, wait time.Duration) error {
+				waits = append(waits, wait)
+				return nil
+			}
+
+			body := `{"content": "aGVsbG8=", "encoding": "base64"}`
+			req, err := http.NewRequest(tt.method, "https://api.github.com"+tt.path, bytes.NewBufferString(body))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			res, err := retrying.RoundTrip(req)
+			if tt.expectedError {
+				if err == nil {
+					t.Errorf("expected an error, got %s", res.Status)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if res.StatusCode != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, res.StatusCode)
+			}
+
+			if len(waits) != len(tt.expectedWaits) {
+				t.Fatalf("expected %d retries, got %d (%v)", len(tt.expectedWaits), len(waits), waits)
+			}
+			for i, wait := range waits {
+				// Backoff is jittered, so only its range is known
+				if expected := tt.expectedWaits[i]; expected < 0 {
+					if ceiling := time.Second << i; wait < ceiling/2 || wait > ceiling {
+						t.Errorf("expected retry %d to back off between %s and %s, got %s", i+1, ceiling/2, ceiling, wait)
+					}
+				} else if wait != expected {
+					t.Errorf("expected retry %d to wait %s, got %s", i+1, expected, wait)
+				}
+			}
+			for i, sent := range base.bodies {
+				if sent != body {
+					t.Errorf("expected attempt %d to send the whole body, got %q", i+1, sent)
+				}
+			}
+
+			if tt.expectedBody != "" {
+				data, _ := io.ReadAll(res.Body)
+				if string(data) != tt.expectedBody {
+					t.Errorf("expected the body to be left to read, got %q", data)
+				}
+			}
+		})
+	}
+}
+
+func TestRetryTransportRateLimit(t *testing.T) {
+	reset := time.Date(2026, 10, 18, 13, 0, 0, 0, time.UTC)
+	base := &scriptedTransport{responses: []scriptedResponse{
+		{status: http.StatusBadGateway},
+		{status: http.StatusOK, headers: map[string]string{
+			"X-RateLimit-Limit":     "5000",
+			"X-RateLimit-Remaining": "4870",
+			"X-RateLimit-Reset":     strconv.FormatInt(reset.Unix(), 10),
+			"X-RateLimit-Resource":  "core",
+		}},
+		{status: http.StatusOK, headers: map[string]string{
+			"X-RateLimit-Limit":     "30",
+			"X-RateLimit-Remaining": "29",
+			"X-RateLimit-Resource":  "search",
+		}},
+	}}
+	retrying := newRetryTransport(base)
+	retrying.sleep = func(ctx context.Context, wait time.Duration) error { return nil }
+
+	if limit, retries := retrying.RateLimit(); limit != nil || retries != 0 {
+		t.Fatalf("expected no rate limit before any request")
+	}
+	for i := 0; i < 2; i++ {
+		req, _ := http.NewRequest(http.MethodGet, "https://api.github.com/repos/kassett/gh-commit", nil)
+		if _, err := retrying.RoundTrip(req); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	limit, retries := retrying.RateLimit()
+	if limit == nil || limit.Limit != 5000 || limit.Remaining != 4870 || !limit.Reset.Equal(reset) {
+		t.Errorf("expected the budget of the core API, got %+v", limit)
+	}
+	if retries != 1 {
+		t.Errorf("expected 1 retry, got %d", retries)
+	}
+}
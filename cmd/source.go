@@ -0,0 +1,265 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"github.com/fatih/color"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// SplitDirMapping splits a <local-dir>[:<remote-dir>] argument. The remote directory
+// is returned in the slash-separated form used by the remote tree.
+func SplitDirMapping(mapping string) (string, string) {
+	local, remote, _ := cutDirMapping(mapping)
+	return local, remote
+}
+
+// cutDirMapping splits a local:remote argument of --source-dir, --mirror or --map, and
+// reports whether it had a remote part. It is split on the last colon, so that a Windows
+// drive (C:\src:dest) or a colon in a local path stays in the local part.
+func cutDirMapping(mapping string) (string, string, bool) {
+	i := strings.LastIndex(mapping, ":")
+	if i < 0 || isDriveColon(mapping, i) {
+		return mapping, "", false
+	}
+	return mapping[:i], cleanRemotePath(mapping[i+1:]), true
+}
+
+// isDriveColon reports whether the colon at i is the one of a Windows drive letter.
+func isDriveColon(mapping string, i int) bool {
+	if i != 1 {
+		return false
+	}
+	letter := mapping[0]
+	return ('a' <= letter && letter <= 'z') || ('A' <= letter && letter <= 'Z')
+}
+
+// cleanRemotePath normalizes a path of the remote tree, which is always relative to its root.
+func cleanRemotePath(p string) string {
+	p = strings.Trim(path.Clean("/"+filepath.ToSlash(p)), "/")
+	if p == "." {
+		return ""
+	}
+	return p
+}
+
+// ChangesFromPaths maps files of the local checkout to the same paths in the remote tree.
+func ChangesFromPaths(files []string) []FileChange {
+	changes := make([]FileChange, 0, len(files))
+	for _, file := range files {
+		changes = append(changes, FileChange{Path: file, LocalPath: file})
+	}
+	return changes
+}
+
+// ListSourceDirFiles lists every file below dir as a slash-separated path relative to dir.
+func ListSourceDirFiles(dir string) ([]string, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read source directory: %w", err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", dir)
+	}
+
+	var files []string
+	err = filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if d.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		files = append(files, filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read source directory: %w", err)
+	}
+
+	return files, nil
+}
+
+// GetSourceDirSelection selects files from a plain directory rather than a git checkout.
+// Patterns are matched relative to the directory, like pathspecs are to a work tree.
+func GetSourceDirSelection(localDir string, patterns []string, commitAll bool) ([]FileChange, error) {
+	if commitAll && len(patterns) > 0 {
+		return nil, errors.New("`all` cannot be used with explicit file selection")
+	}
+
+	if len(patterns) == 0 {
+		fmt.Fprintln(out, color.New(color.FgYellow).Sprintf("⚠️  No explicit file selection."))
+
+		if !commitAll {
+			return nil, fmt.Errorf("%s %s",
+				color.New(color.FgRed, color.Bold).Sprint("❌ Error:"),
+				"No files were selected for commit",
+			)
+		}
+	}
+
+	files, err := ListSourceDirFiles(localDir)
+	if err != nil {
+		return nil, err
+	}
+
+	pathspecs, err := CompilePathspecs(patterns)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []FileChange
+	for _, file := range files {
+		if !commitAll && !MatchPathspecs(pathspecs, file) {
+			continue
+		}
+		change := FileChange{
+			Path:      file,
+			LocalPath: filepath.Join(localDir, filepath.FromSlash(file)),
+		}
+		// Symlinks are committed as links, even those pointing at directories
+		if info, err := os.Lstat(change.LocalPath); err == nil && info.Mode()&os.ModeSymlink != 0 {
+			if change.Content, change.Mode, err = ReadLocalFile(change.LocalPath); err != nil {
+				return nil, fmt.Errorf("failed to read source directory: %w", err)
+			}
+		}
+		changes = append(changes, change)
+	}
+
+	if len(patterns) > 0 && len(changes) == 0 {
+		return nil, errors.New("the pattern(s) did not match any files")
+	}
+
+	return changes, nil
+}
+
+// matchPathspec follows git's default pathspec rules: the pattern either matches the
+// whole path, with '*' matching across directories, or one of its leading directories.
+func matchPathspec(pattern, name string) bool {
+	pattern = strings.TrimPrefix(strings.TrimSuffix(pattern, "/"), "./")
+	if pattern == "" || pattern == "." {
+		return true
+	}
+
+	if wildmatch(pattern, name, false) {
+		return true
+	}
+
+	for i := 0; i < len(name); i++ {
+		if name[i] == '/' && wildmatch(pattern, name[:i], false) {
+			return true
+		}
+	}
+	return false
+}
+
+// wildmatch matches name against a glob pattern. Unless pathname is set, '*' also
+// matches '/'. With pathname set, '*' stops at '/' and '**' matches across directories.
+func wildmatch(pattern, name string, pathname bool) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			double := strings.HasPrefix(pattern, "**")
+			rest := strings.TrimLeft(pattern, "*")
+			if pathname && double {
+				// "**/" also matches zero directories
+				if strings.HasPrefix(rest, "/") && wildmatch(rest[1:], name, pathname) {
+					return true
+				}
+				for i := 0; i <= len(name); i++ {
+					if wildmatch(rest, name[i:], pathname) {
+						return true
+					}
+				}
+				return false
+			}
+			for i := 0; i <= len(name); i++ {
+				if wildmatch(rest, name[i:], pathname) {
+					return true
+				}
+				if i < len(name) && pathname && name[i] == '/' {
+					return false
+				}
+			}
+			return false
+		case '?':
+			if len(name) == 0 || (pathname && name[0] == '/') {
+				return false
+			}
+			pattern, name = pattern[1:], name[1:]
+		case '[':
+			if end := classEnd(pattern); end > 0 {
+				if len(name) == 0 || (pathname && name[0] == '/') || !matchClass(pattern[1:end], name[0]) {
+					return false
+				}
+				pattern, name = pattern[end+1:], name[1:]
+				continue
+			}
+			// An unterminated class is a literal '['
+			if len(name) == 0 || name[0] != '[' {
+				return false
+			}
+			pattern, name = pattern[1:], name[1:]
+		default:
+			if pattern[0] == '\\' && len(pattern) > 1 {
+				pattern = pattern[1:]
+			}
+			if len(name) == 0 || name[0] != pattern[0] {
+				return false
+			}
+			pattern, name = pattern[1:], name[1:]
+		}
+	}
+	return len(name) == 0
+}
+
+// classEnd returns the index of the ']' closing the class at the start of pattern, or -1.
+func classEnd(pattern string) int {
+	i := 1
+	if i < len(pattern) && (pattern[i] == '!' || pattern[i] == '^') {
+		i++
+	}
+	// A ']' right after the opening bracket is part of the class
+	if i < len(pattern) && pattern[i] == ']' {
+		i++
+	}
+	for ; i < len(pattern); i++ {
+		if pattern[i] == ']' {
+			return i
+		}
+	}
+	return -1
+}
+
+func matchClass(class string, c byte) bool {
+	negate := false
+	if len(class) > 0 && (class[0] == '!' || class[0] == '^') {
+		negate = true
+		class = class[1:]
+	}
+
+	matched := false
+	for i := 0; i < len(class); i++ {
+		if i+2 < len(class) && class[i+1] == '-' {
+			if class[i] <= c && c <= class[i+2] {
+				matched = true
+			}
+			i += 2
+		} else if class[i] == c {
+			matched = true
+		}
+	}
+	return matched != negate
+}
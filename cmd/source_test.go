@@ -0,0 +1,184 @@
+package cmd
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMatchPathspec(t *testing.T) {
+	tests := []struct {
+		name     string
+		pattern  string
+		path     string
+		expected bool
+	}{
+		{name: "Exact match", pattern: "README.md", path: "README.md", expected: true},
+		{name: "Leading directory", pattern: "docs", path: "docs/index.md", expected: true},
+		{name: "Leading directory with slash", pattern: "docs/", path: "docs/api/index.md", expected: true},
+		{name: "Partial directory name", pattern: "doc", path: "docs/index.md", expected: false},
+		{name: "Star crosses directories", pattern: "*.go", path: "cmd/args.go", expected: true},
+		{name: "Star with prefix", pattern: "cmd/*_test.go", path: "cmd/git_test.go", expected: true},
+		{name: "Question mark", pattern: "file?.txt", path: "file1.txt", expected: true},
+		{name: "Character class", pattern: "file[0-9].txt", path: "fileA.txt", expected: false},
+		{name: "Negated character class", pattern: "file[!0-9].txt", path: "fileA.txt", expected: true},
+		{name: "Dot matches everything", pattern: ".", path: "a/b/c", expected: true},
+		{name: "No match", pattern: "*.md", path: "main.go", expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if matched := matchPathspec(tt.pattern, tt.path); matched != tt.expected {
+				t.Errorf("expected %v for %q against %q, got %v", tt.expected, tt.pattern, tt.path, matched)
+			}
+		})
+	}
+}
+
+func TestWildmatchPathname(t *testing.T) {
+	tests := []struct {
+		name     string
+		pattern  string
+		path     string
+		expected bool
+	}{
+		{name: "Star stops at slash", pattern: "*.go", path: "cmd/args.go", expected: false},
+		{name: "Star within directory", pattern: "cmd/*.go", path: "cmd/args.go", expected: true},
+		{name: "Double star crosses directories", pattern: "**/*.go", path: "a/b/c.go", expected: true},
+		{name: "Double star matches zero directories", pattern: "**/*.go", path: "c.go", expected: true},
+		{name: "Trailing double star", pattern: "build/**", path: "build/a/b", expected: true},
+		{name: "Question mark does not match slash", pattern: "a?b", path: "a/b", expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if matched := wildmatch(tt.pattern, tt.path, true); matched != tt.expected {
+				t.Errorf("expected %v for %q against %q, got %v", tt.expected, tt.pattern, tt.path, matched)
+			}
+		})
+	}
+}
+
+func TestGetSourceDirSelection(t *testing.T) {
+	dir := t.TempDir()
+	for _, file := range []string{"a.txt", "sub/b.txt", "sub/c.go", ".git/config"} {
+		p := filepath.Join(dir, filepath.FromSlash(file))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(file), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name          string
+		sourceDir     string
+		patterns      []string
+		commitAll     bool
+		expectedPaths []string
+		expectedError error
+	}{
+		{
+			name:          "All files",
+			sourceDir:     dir,
+			commitAll:     true,
+			expectedPaths: []string{"a.txt", "sub/b.txt", "sub/c.go"},
+		},
+		{
+			name:          "Pattern",
+			sourceDir:     dir,
+			patterns:      []string{"*.txt"},
+			expectedPaths: []string{"a.txt", "sub/b.txt"},
+		},
+		{
+			name:          "No matches",
+			sourceDir:     dir,
+			patterns:      []string{"*.rs"},
+			expectedError: errors.New("the pattern(s) did not match any files"),
+		},
+		{
+			name:          "All with patterns",
+			sourceDir:     dir,
+			patterns:      []string{"*.txt"},
+			commitAll:     true,
+			expectedError: errors.New("`all` cannot be used with explicit file selection"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			changes, err := GetSourceDirSelection(tt.sourceDir, tt.patterns, tt.commitAll)
+
+			if err != nil && tt.expectedError != nil {
+				if err.Error() != tt.expectedError.Error() {
+					t.Errorf("expected error %v, got %v", tt.expectedError, err)
+				}
+			} else if err != nil || tt.expectedError != nil {
+				t.Errorf("expected error %v, got %v", tt.expectedError, err)
+			}
+
+			var paths []string
+			for _, change := range changes {
+				paths = append(paths, change.Path)
+			}
+			if !equal(paths, tt.expectedPaths) {
+				t.Errorf("expected paths %v, got %v", tt.expectedPaths, paths)
+			}
+		})
+	}
+}
+
+func TestSplitDirMapping(t *testing.T) {
+	tests := []struct {
+		mapping           string
+		expectedLocalDir  string
+		expectedRemoteDir string
+	}{
+		{mapping: "build", expectedLocalDir: "build"},
+		{mapping: "build:site", expectedLocalDir: "build", expectedRemoteDir: "site"},
+		{mapping: "build:./site/docs/", expectedLocalDir: "build", expectedRemoteDir: "site/docs"},
+		{mapping: `C:\src`, expectedLocalDir: `C:\src`},
+		{mapping: `C:\src:dest`, expectedLocalDir: `C:\src`, expectedRemoteDir: "dest"},
+		{mapping: "out/v1:2:site", expectedLocalDir: "out/v1:2", expectedRemoteDir: "site"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mapping, func(t *testing.T) {
+			localDir, remoteDir := SplitDirMapping(tt.mapping)
+			if localDir != tt.expectedLocalDir || remoteDir != tt.expectedRemoteDir {
+				t.Errorf("expected %q and %q, got %q and %q", tt.expectedLocalDir, tt.expectedRemoteDir, localDir, remoteDir)
+			}
+		})
+	}
+}
+
+func TestGetSourceDirSelectionSymlinks(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "assets"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "assets", "logo.svg"), []byte("<svg/>"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("assets", filepath.Join(dir, "static")); err != nil {
+		t.Skip("symlinks are not supported:", err)
+	}
+
+	changes, err := GetSourceDirSelection(dir, nil, true)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(changes) != 2 {
+		t.Fatalf("expected 2 changes, got %v", changes)
+	}
+
+	link := changes[1]
+	if link.Path != "static" || link.Mode != "120000" || string(link.Content) != "assets" {
+		t.Errorf("expected static to be committed as a link to assets, got %+v", link)
+	}
+	if content, err := link.Load(); err != nil || string(content) != "assets" {
+		t.Errorf("expected the link to load as its target, got %q, %v", content, err)
+	}
+}
@@ -1,19 +1,84 @@
 package cmd
 
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
 type RepoDescriptionResponse struct {
+	DefaultBranch string           `json:"default_branch"`
+	Private       bool             `json:"private"`
+	Permissions   *RepoPermissions `json:"permissions"`
+}
+
+// RepoPermissions are the rights of the token on a repository. They are missing when the
+// token cannot be tied to a user.
+type RepoPermissions struct {
+	Admin bool `json:"admin"`
+	Push  bool `json:"push"`
+}
+
+type ForkResponse struct {
+	Name          string `json:"name"`
 	DefaultBranch string `json:"default_branch"`
+	Owner         struct {
+		Login string `json:"login"`
+	} `json:"owner"`
 }
 
 type BranchDescriptionResponse struct {
 	Commit struct {
 		SHA string `json:"sha"`
 	} `json:"commit"`
+	Protected bool `json:"protected"`
 }
 
 type ShaResponse struct {
 	Sha string `json:"sha"`
 }
 
+// FileChange is a single file of the commit. The content is read from LocalPath,
+// unless Content is set, and ends up at Path in the remote tree.
+type FileChange struct {
+	Path      string
+	LocalPath string
+	Mode      string
+	Content   []byte
+	Deleted   bool
+}
+
+// Load returns the content of a file, or nil for deletions, including files that no
+// longer exist locally.
+func (fc FileChange) Load() ([]byte, error) {
+	if fc.Deleted {
+		return nil, nil
+	}
+	if fc.Content != nil {
+		return fc.Content, nil
+	}
+
+	if _, err := os.Lstat(fc.LocalPath); os.IsNotExist(err) {
+		return nil, nil
+	}
+	content, err := os.ReadFile(fc.LocalPath)
+	if err != nil {
+		return nil, errors.New(fmt.Sprint("Error reading file: ", err))
+	}
+	if content == nil {
+		content = []byte{}
+	}
+	return content, nil
+}
+
+// Describe shows where a file comes from, if that differs from where it is committed to.
+func (fc FileChange) Describe() string {
+	if fc.LocalPath == "" || fc.LocalPath == fc.Path {
+		return fc.Path
+	}
+	return fmt.Sprintf("%s → %s", fc.LocalPath, fc.Path)
+}
+
 type BlobInfo struct {
 	Path string  `json:"path"`
 	Mode string  `json:"mode"`
@@ -21,9 +86,36 @@ type BlobInfo struct {
 	Sha  *string `json:"sha"`
 }
 
+type TreeEntry struct {
+	Path string `json:"path"`
+	Mode string `json:"mode"`
+	Type string `json:"type"`
+	Sha  string `json:"sha"`
+}
+
+type TreeResponse struct {
+	Sha       string      `json:"sha"`
+	Tree      []TreeEntry `json:"tree"`
+	Truncated bool        `json:"truncated"`
+}
+
+type BlobResponse struct {
+	Content  string `json:"content"`
+	Encoding string `json:"encoding"`
+}
+
+type CommitAuthor struct {
+	Name  string `json:"name"`
+	Email string `json:"email"`
+	Date  string `json:"date,omitempty"`
+}
+
 type PrResponse struct {
-	Url    string `json:"url"`
-	Number int    `json:"number"`
+	Url      string  `json:"url"`
+	HtmlUrl  string  `json:"html_url"`
+	Number   int     `json:"number"`
+	State    string  `json:"state"`
+	MergedAt *string `json:"merged_at"`
 }
 
 type PrRequest struct {
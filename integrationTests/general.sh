@@ -131,4 +131,4 @@ done
 # Purpose: Ensure `gh commit` can push empty changes via PR
 # --------------------------
 echo "[TEST 4] Creating empty PR commit"
-gh commit -P -B random-branch-name -m "Random empty commit" -A -U
+gh commit -P -B random-branch-name -m "Random empty commit" -A -U --allow-empty